@@ -33,6 +33,7 @@ const headerFmt = `# HEADER ----------------------------------
 # SampleRate:     %d
 # Endianness:     %d
 # IndexUnit:      %d
+# Extensions:     %d
 # Reserved:       %x
 # ------------------------------------------
 `
@@ -72,7 +73,7 @@ func main() {
 	if !*csv {
 		// format the header
 		fmt.Printf(headerFmt, header.DataType, header.FormatVersion,
-			header.StorageMode, header.Channels, header.Samples, header.SampleRate, header.Endianness, header.IndexUnit, header.Reserved)
+			header.StorageMode, header.Channels, header.Samples, header.SampleRate, header.Endianness, header.IndexUnit, header.Extensions, header.Reserved)
 	}
 
 	if *seq {
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
@@ -36,7 +37,9 @@ func main() {
 	}
 
 	// connect to it
-	if err := device.Engage(); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultEngageTimeout)
+	defer cancel()
+	if err := device.Engage(ctx); err != nil {
 		log.Printf("Error: %v\n", err)
 		return
 	}
@@ -50,10 +53,10 @@ func main() {
 			log.Printf("Error: %v", err)
 			return
 		}
-		if id, err := r.Wait(); err != nil {
+		if info, err := r.Wait(); err != nil {
 			log.Printf("could not stop")
 		} else {
-			log.Printf("Recorded result to: %s", id)
+			log.Printf("Recorded result to: %s", info.ResourceId)
 		}
 
 	}
@@ -60,7 +60,7 @@ func (b *BlockBuffer) Channels() int {
 
 // The number of samples in this BlockBuffer.
 func (b *BlockBuffer) Samples() int {
-	return len(b.values) / b.channels
+	return len(b.ts)
 }
 
 // The timestamp array of this BlockBuffer. Note
@@ -100,7 +100,9 @@ func (b *BlockBuffer) AppendSample(v []float64, ts int64) {
 // Pops and returns the next n samples and downsamples
 // them according to the down-sampling rate. By default
 // the down-sampling rate is 1, so this should just
-// subset the buffer.
+// subset the buffer. Plucking does not filter the data,
+// so frequencies above the new Nyquist rate will alias;
+// use dsp.Decimator for signals that are not band-limited.
 func (b *BlockBuffer) PopDownSample(n int) (bb *BlockBuffer) {
 	if n < 0 {
 		panic("n must be nonnegative")
@@ -186,6 +188,96 @@ func (b *BlockBuffer) Slice(from, to int) *BlockBuffer {
 	return bb
 }
 
+// ----------------------------------------------------------------- //
+// Channel Operations
+// ----------------------------------------------------------------- //
+
+// SelectChannels creates a new BlockBuffer holding the given
+// channels, in the given order. A channel may be selected more
+// than once. Selecting a channel that does not exist will cause
+// a panic.
+func (b *BlockBuffer) SelectChannels(cs ...int) *BlockBuffer {
+	for _, c := range cs {
+		if c < 0 || c >= b.channels {
+			panic(fmt.Sprintf("channel out of bounds: %d", c))
+		}
+	}
+	samples := b.Samples()
+	bb := NewBlockBuffer(len(cs), samples+1)
+	for s := 0; s < samples; s++ {
+		v := b.values[s*b.channels : (s+1)*b.channels]
+		for _, c := range cs {
+			bb.values = append(bb.values, v[c])
+		}
+	}
+	bb.ts = append(bb.ts, b.ts...)
+	return bb
+}
+
+// ReorderChannels creates a new BlockBuffer whose i-th channel
+// is channel order[i] of this buffer. The order must be a
+// permutation of the channels.
+func (b *BlockBuffer) ReorderChannels(order []int) *BlockBuffer {
+	if len(order) != b.channels {
+		panic("not a permutation of the channels")
+	}
+	seen := make([]bool, b.channels)
+	for _, c := range order {
+		if c < 0 || c >= b.channels || seen[c] {
+			panic("not a permutation of the channels")
+		}
+		seen[c] = true
+	}
+	return b.SelectChannels(order...)
+}
+
+// AppendChannel adds a channel after the existing ones. It
+// must have a value for every sample in the buffer.
+func (b *BlockBuffer) AppendChannel(v []float64) {
+	samples := b.Samples()
+	if len(v) != samples {
+		panic(fmt.Sprintf("wrong number of samples: %d", len(v)))
+	}
+	values := make([]float64, 0, (b.channels+1)*cap(b.ts))
+	for s := 0; s < samples; s++ {
+		values = append(values, b.values[s*b.channels:(s+1)*b.channels]...)
+		values = append(values, v[s])
+	}
+	b.values = values
+	b.channels++
+}
+
+// RemoveChannel removes the c-th channel from the buffer.
+func (b *BlockBuffer) RemoveChannel(c int) {
+	if c < 0 || c >= b.channels {
+		panic(fmt.Sprintf("channel out of bounds: %d", c))
+	}
+	var (
+		samples = b.Samples()
+		values  = b.values[:0]
+	)
+	for s := 0; s < samples; s++ {
+		v := b.values[s*b.channels : (s+1)*b.channels]
+		values = append(values, v[:c]...)
+		values = append(values, v[c+1:]...)
+	}
+	b.values = values
+	b.channels--
+}
+
+// Channel returns a copy of the values of the c-th channel.
+func (b *BlockBuffer) Channel(c int) []float64 {
+	if c < 0 || c >= b.channels {
+		panic(fmt.Sprintf("channel out of bounds: %d", c))
+	}
+	samples := b.Samples()
+	v := make([]float64, samples)
+	for s := range v {
+		v[s] = b.values[s*b.channels+c]
+	}
+	return v
+}
+
 func (b *BlockBuffer) appendBlocks(v []float64, ts []int64) {
 	b.values = append(b.values, v...)
 	b.ts = append(b.ts, ts...)
@@ -304,3 +304,77 @@ func AssertPanic(t *testing.T, f func()) {
 	f()
 	t.Errorf("should have panicked")
 }
+
+func TestBlockBufferSelectChannels(t *testing.T) {
+	b := mockBlockBuffer()
+	b.AppendChannel([]float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	bb := b.SelectChannels(2, 0, 2)
+	if bb.Channels() != 3 || bb.Samples() != 10 {
+		t.Fatalf("wrong dimensions")
+	}
+	if v, ts := bb.Sample(4); v[0] != 4 || v[1] != 5 || v[2] != 4 || ts != 5 {
+		t.Errorf("wrong sample: %v %v", v, ts)
+	}
+	AssertPanic(t, func() {
+		b.SelectChannels(3)
+	})
+}
+
+func TestBlockBufferReorderChannels(t *testing.T) {
+	b := mockBlockBuffer()
+	b.AppendChannel(make([]float64, 10))
+
+	bb := b.ReorderChannels([]int{2, 1, 0})
+	if v, _ := bb.Sample(9); v[0] != 0 || v[2] != 10 {
+		t.Errorf("wrong sample: %v", v)
+	}
+	AssertPanic(t, func() {
+		b.ReorderChannels([]int{0, 0, 1})
+	})
+	AssertPanic(t, func() {
+		b.ReorderChannels([]int{0, 1})
+	})
+}
+
+func TestBlockBufferAppendChannel(t *testing.T) {
+	b := mockBlockBuffer()
+	b.AppendChannel([]float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	if b.Channels() != 3 || b.Samples() != 10 {
+		t.Fatalf("wrong dimensions")
+	}
+	if v, ts := b.Sample(9); v[0] != 10 || v[2] != 9 || ts != 10 {
+		t.Errorf("wrong sample: %v %v", v, ts)
+	}
+
+	// still appendable
+	b.AppendSample([]float64{11, 11, 10}, 11)
+	if c := b.Channel(2); len(c) != 11 || c[10] != 10 {
+		t.Errorf("wrong channel: %v", c)
+	}
+	AssertPanic(t, func() {
+		b.AppendChannel([]float64{1})
+	})
+}
+
+func TestBlockBufferRemoveChannel(t *testing.T) {
+	b := mockBlockBuffer()
+	b.AppendChannel([]float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	b.RemoveChannel(0)
+	if b.Channels() != 2 || b.Samples() != 10 {
+		t.Fatalf("wrong dimensions")
+	}
+	if v, _ := b.Sample(3); v[0] != 4 || v[1] != 3 {
+		t.Errorf("wrong sample: %v", v)
+	}
+
+	// down to nothing
+	b.RemoveChannel(1)
+	b.RemoveChannel(0)
+	if b.Channels() != 0 || b.Samples() != 10 {
+		t.Errorf("wrong dimensions")
+	}
+	AssertPanic(t, func() {
+		b.RemoveChannel(0)
+	})
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"fmt"
+)
+
+// ----------------------------------------------------------------- //
+// Channel Kinds
+// ----------------------------------------------------------------- //
+
+// ChannelKind says what sort of signal a channel carries.
+type ChannelKind string
+
+const (
+	KindEEG     ChannelKind = "eeg"     // electrode data
+	KindTrigger ChannelKind = "trigger" // discrete trigger inputs, like a keypad
+	KindAux     ChannelKind = "aux"     // anything else
+)
+
+// The electrode positions of the international 10-20 system,
+// including the intermediate 10% positions that are commonly
+// used for higher-density montages.
+var TenTwentyPositions = []string{
+	"Fp1", "Fpz", "Fp2",
+	"AF7", "AF3", "AFz", "AF4", "AF8",
+	"F9", "F7", "F5", "F3", "F1", "Fz", "F2", "F4", "F6", "F8", "F10",
+	"FT9", "FT7", "FC5", "FC3", "FC1", "FCz", "FC2", "FC4", "FC6", "FT8", "FT10",
+	"A1", "T9", "T7", "C5", "C3", "C1", "Cz", "C2", "C4", "C6", "T8", "T10", "A2",
+	"TP9", "TP7", "CP5", "CP3", "CP1", "CPz", "CP2", "CP4", "CP6", "TP8", "TP10",
+	"P9", "P7", "P5", "P3", "P1", "Pz", "P2", "P4", "P6", "P8", "P10",
+	"PO7", "PO3", "POz", "PO4", "PO8",
+	"O1", "Oz", "O2",
+	"T3", "T4", "T5", "T6", // old names for T7, T8, P7, P8
+}
+
+// IsTenTwentyPosition returns true if and only if the
+// position is a valid 10-20 electrode position.
+func IsTenTwentyPosition(position string) bool {
+	for _, p := range TenTwentyPositions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------- //
+// Channel Info
+// ----------------------------------------------------------------- //
+
+// ChannelInfo describes a single channel of a DataFrame. The
+// values of the channel are given in Unit; Scale is the number
+// of Units per raw device count, so that value = count * Scale.
+// If the device knows the range of its converter, Min and Max
+// give it in Units; values at either end are saturated.
+type ChannelInfo struct {
+	Label    string      `json:"label"`         // human-readable name, like "Ch1" or "Keypad"
+	Kind     ChannelKind `json:"kind"`          // one of {"eeg", "trigger", "aux"}
+	Unit     string      `json:"unit"`          // physical unit of the values, like "V"
+	Scale    float64     `json:"scale"`         // units per raw count
+	Position string      `json:"position"`      // 10-20 electrode position, if known
+	Min      float64     `json:"min,omitempty"` // lowest value of the converter, if known
+	Max      float64     `json:"max,omitempty"` // highest value of the converter, if known
+}
+
+// HasRange returns true if and only if the range of the
+// converter is known.
+func (info *ChannelInfo) HasRange() bool {
+	return info.Max > info.Min
+}
+
+// Create the ChannelInfos for n EEG channels labeled
+// Ch1, ..., Chn with no known position.
+func EEGChannelInfos(n int, unit string, scale float64) []*ChannelInfo {
+	infos := make([]*ChannelInfo, n)
+	for c := range infos {
+		infos[c] = &ChannelInfo{
+			Label: fmt.Sprintf("Ch%d", c+1),
+			Kind:  KindEEG,
+			Unit:  unit,
+			Scale: scale,
+		}
+	}
+	return infos
+}
+
+// Unranged returns the descriptions without the range of
+// the converter, for channels whose values have been derived
+// from the device values, for instance by filtering. The
+// descriptions are copied only if they have a range.
+func Unranged(infos []*ChannelInfo) []*ChannelInfo {
+	if infos == nil {
+		return nil
+	}
+	out := make([]*ChannelInfo, len(infos))
+	for c, info := range infos {
+		out[c] = info
+		if info.HasRange() {
+			cp := *info
+			cp.Min, cp.Max = 0, 0
+			out[c] = &cp
+		}
+	}
+	return out
+}
@@ -3,16 +3,36 @@
 //
 package datastruct
 
+import (
+	"math"
+)
+
 // A generic data frame interface.
 type DataFrame interface {
 	Buffer() *BlockBuffer
 	SampleRate() int
+
+	// Descriptions of the channels in the buffer, in
+	// order; nil if the channels are not known.
+	ChannelInfos() []*ChannelInfo
+
+	// Events that occurred during the frame, in order
+	// of their timestamps; nil if there were none.
+	Events() []*Event
+
+	// The raw integer samples of the device, if it provides
+	// them; otherwise nil. The values of the buffer are these
+	// counts multiplied by the Scale of each channel.
+	Ints() *IntBuffer
 }
 
 // A generic data frame implementation.
 type dataFrame struct {
 	buffer     *BlockBuffer
 	sampleRate int
+	channels   []*ChannelInfo
+	events     []*Event
+	ints       *IntBuffer
 }
 
 // Create a new generic DataFrame.
@@ -23,6 +43,39 @@ func NewDataFrame(buffer *BlockBuffer, sampleRate int) DataFrame {
 	}
 }
 
+// Create a new generic DataFrame with descriptions
+// of its channels.
+func NewDataFrameWithChannels(buffer *BlockBuffer, sampleRate int, channels []*ChannelInfo) DataFrame {
+	return &dataFrame{
+		buffer:     buffer,
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+}
+
+// Create a new generic DataFrame with descriptions
+// of its channels and the events that occurred.
+func NewDataFrameWithEvents(buffer *BlockBuffer, sampleRate int, channels []*ChannelInfo, events []*Event) DataFrame {
+	return &dataFrame{
+		buffer:     buffer,
+		sampleRate: sampleRate,
+		channels:   channels,
+		events:     events,
+	}
+}
+
+// Create a new generic DataFrame that also carries the
+// raw integer samples of the buffer.
+func NewDataFrameWithInts(buffer *BlockBuffer, ints *IntBuffer, sampleRate int, channels []*ChannelInfo, events []*Event) DataFrame {
+	return &dataFrame{
+		buffer:     buffer,
+		sampleRate: sampleRate,
+		channels:   channels,
+		events:     events,
+		ints:       ints,
+	}
+}
+
 func (df *dataFrame) Buffer() *BlockBuffer {
 	return df.buffer
 }
@@ -30,3 +83,39 @@ func (df *dataFrame) Buffer() *BlockBuffer {
 func (df *dataFrame) SampleRate() int {
 	return df.sampleRate
 }
+
+func (df *dataFrame) ChannelInfos() []*ChannelInfo {
+	return df.channels
+}
+
+func (df *dataFrame) Events() []*Event {
+	return df.events
+}
+
+func (df *dataFrame) Ints() *IntBuffer {
+	return df.ints
+}
+
+// SliceFrame returns a DataFrame holding the samples [from, to)
+// of the frame, with their counts and the events among them. The
+// events that come before the first sample of the frame, like
+// gaps, stay with the slice that starts the frame.
+func SliceFrame(df DataFrame, from, to int) DataFrame {
+	var (
+		buf    = df.Buffer().Slice(from, to)
+		ts     = buf.Timestamps()
+		events []*Event
+	)
+	if len(ts) > 0 {
+		first := ts[0]
+		if from == 0 {
+			first = math.MinInt64
+		}
+		events = EventsBetween(df.Events(), first, ts[len(ts)-1])
+	}
+	var ints *IntBuffer
+	if df.Ints() != nil {
+		ints = df.Ints().Slice(from, to)
+	}
+	return NewDataFrameWithInts(buf, ints, df.SampleRate(), df.ChannelInfos(), events)
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"sort"
+)
+
+// ----------------------------------------------------------------- //
+// Events
+// ----------------------------------------------------------------- //
+
+// Event codes.
+const (
+	EventTriggerOn  = 1 // a trigger input became active
+	EventTriggerOff = 2 // a trigger input became inactive
+	EventGap        = 3 // samples are missing from the stream
+	EventArtifact   = 4 // a channel is contaminated, like by a blink
+	EventPause      = 5 // a recording was paused after this sample
+	EventResume     = 6 // a recording was resumed at this sample
+	EventMarker     = 7 // a named marker, like the onset of a stimulus
+)
+
+// Event is a discrete occurrence during a stream, like a
+// keypad press, with the time of the sample at which it
+// occurred.
+type Event struct {
+	Timestamp int64  `json:"timestamp"`          // in nanoseconds, like sample timestamps
+	Code      int    `json:"code"`               // what happened, like EventTriggerOn
+	Label     string `json:"label"`              // human-readable description
+	Source    string `json:"source"`             // what produced it, like the label of a trigger channel
+	Duration  int64  `json:"duration,omitempty"` // in nanoseconds, for events that span time, like gaps
+}
+
+// Sort the events by timestamp, keeping the order of
+// events that occurred at the same time.
+func SortEvents(events []*Event) {
+	sort.Stable(eventsByTime(events))
+}
+
+type eventsByTime []*Event
+
+func (e eventsByTime) Len() int           { return len(e) }
+func (e eventsByTime) Less(i, j int) bool { return e[i].Timestamp < e[j].Timestamp }
+func (e eventsByTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// EventsBetween returns the events with timestamps in
+// the range [from, to].
+func EventsBetween(events []*Event, from, to int64) (result []*Event) {
+	for _, e := range events {
+		if e.Timestamp >= from && e.Timestamp <= to {
+			result = append(result, e)
+		}
+	}
+	return
+}
+
+// TriggerEvents finds the edges of a trigger channel, a
+// nonzero value being active. The value of the channel
+// before the buffer is given by last, and its last value
+// is returned so that edges across buffers are found.
+func TriggerEvents(b *BlockBuffer, c int, source string, last float64) ([]*Event, float64) {
+	var events []*Event
+	for s := 0; s < b.Samples(); s++ {
+		v, ts := b.Sample(s)
+		x := v[c]
+		if (x != 0) != (last != 0) {
+			e := &Event{
+				Timestamp: ts,
+				Code:      EventTriggerOn,
+				Label:     source + " on",
+				Source:    source,
+			}
+			if x == 0 {
+				e.Code = EventTriggerOff
+				e.Label = source + " off"
+			}
+			events = append(events, e)
+		}
+		last = x
+	}
+	return events, last
+}
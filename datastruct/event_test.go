@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"testing"
+)
+
+func triggerBuffer(values ...float64) *BlockBuffer {
+	b := NewBlockBuffer(2, len(values))
+	for s, x := range values {
+		b.AppendSample([]float64{0, x}, int64(s+1))
+	}
+	return b
+}
+
+func TestTriggerEvents(t *testing.T) {
+	events, last := TriggerEvents(triggerBuffer(0, 2, 2, 0), 1, "Keypad", 0)
+	if len(events) != 2 || last != 0 {
+		t.Fatalf("wrong events: %v", events)
+	}
+	if e := events[0]; e.Code != EventTriggerOn || e.Timestamp != 2 || e.Source != "Keypad" || e.Label != "Keypad on" {
+		t.Errorf("wrong event: %+v", e)
+	}
+	if e := events[1]; e.Code != EventTriggerOff || e.Timestamp != 4 {
+		t.Errorf("wrong event: %+v", e)
+	}
+
+	// no events on the other channel
+	if events, _ = TriggerEvents(triggerBuffer(0, 2), 0, "Optical", 0); events != nil {
+		t.Errorf("should not have events")
+	}
+}
+
+func TestTriggerEvents__AcrossBuffers(t *testing.T) {
+	_, last := TriggerEvents(triggerBuffer(0, 2), 1, "Keypad", 0)
+	events, _ := TriggerEvents(triggerBuffer(2, 2, 0), 1, "Keypad", last)
+	if len(events) != 1 || events[0].Code != EventTriggerOff || events[0].Timestamp != 3 {
+		t.Errorf("wrong events: %v", events)
+	}
+}
+
+func TestSortEvents(t *testing.T) {
+	events := []*Event{
+		{Timestamp: 3, Label: "c"},
+		{Timestamp: 1, Label: "a"},
+		{Timestamp: 3, Label: "d"},
+		{Timestamp: 2, Label: "b"},
+	}
+	SortEvents(events)
+	for i, label := range []string{"a", "b", "c", "d"} {
+		if events[i].Label != label {
+			t.Errorf("wrong order at %d: %s", i, events[i].Label)
+		}
+	}
+
+	if e := EventsBetween(events, 2, 3); len(e) != 3 || e[0].Label != "b" {
+		t.Errorf("wrong events between: %v", e)
+	}
+}
@@ -0,0 +1,127 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"fmt"
+	"math"
+)
+
+// ----------------------------------------------------------------- //
+// Gap Policies
+// ----------------------------------------------------------------- //
+
+// GapPolicy decides what a device does about samples that
+// it knows are missing from its stream, like frames dropped
+// by the transport. In every case a gap event is published.
+type GapPolicy int
+
+const (
+	GapMark        GapPolicy = iota // only publish the gap event
+	GapNaN                          // stand in NaN for the missing samples
+	GapInterpolate                  // stand in a straight line for the missing samples
+)
+
+func (p GapPolicy) String() string {
+	switch p {
+	case GapMark:
+		return "mark"
+	case GapNaN:
+		return "nan"
+	case GapInterpolate:
+		return "interpolate"
+	}
+	return fmt.Sprintf("GapPolicy(%d)", int(p))
+}
+
+// ParseGapPolicy parses one of {"mark", "nan", "interpolate"}.
+func ParseGapPolicy(s string) (GapPolicy, error) {
+	for _, p := range []GapPolicy{GapMark, GapNaN, GapInterpolate} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return GapMark, fmt.Errorf("unknown gap policy: %s", s)
+}
+
+// ----------------------------------------------------------------- //
+// Gaps
+// ----------------------------------------------------------------- //
+
+// Create the event for n missing samples, spaced by period,
+// following the sample at ts.
+func NewGapEvent(ts int64, n int, period int64, source, reason string) *Event {
+	return &Event{
+		Timestamp: ts + period,
+		Code:      EventGap,
+		Label:     fmt.Sprintf("%d samples missing (%s)", n, reason),
+		Source:    source,
+		Duration:  int64(n) * period,
+	}
+}
+
+// FillGap creates the samples that stand in for n missing
+// samples, spaced by period, between the sample v0 at ts0 and
+// the sample v1 that follows the gap. The trigger channels
+// among the given descriptions, which may be nil, hold their
+// level from v0, since any other value would make up edges.
+// It returns nil under GapMark.
+func FillGap(policy GapPolicy, v0 []float64, ts0 int64, v1 []float64, n int, period int64, infos []*ChannelInfo) *BlockBuffer {
+	if policy == GapMark || n < 1 {
+		return nil
+	}
+	if len(v0) != len(v1) {
+		panic("not comparable")
+	}
+	var (
+		b = NewBlockBuffer(len(v0), n)
+		v = make([]float64, len(v0))
+	)
+	for k := 1; k <= n; k++ {
+		for c := range v {
+			if c < len(infos) && infos[c].Kind == KindTrigger {
+				v[c] = v0[c]
+			} else if policy == GapNaN {
+				v[c] = math.NaN()
+			} else {
+				v[c] = v0[c] + (v1[c]-v0[c])*float64(k)/float64(n+1)
+			}
+		}
+		b.AppendSample(v, ts0+int64(k)*period)
+	}
+	return b
+}
+
+// SplitAtGaps cuts the buffer into the runs of samples that
+// lie between the gap events, leaving out the samples within
+// the gaps, so that analyses do not run across them. The
+// events must be in order.
+func SplitAtGaps(b *BlockBuffer, events []*Event) (runs []*BlockBuffer) {
+	var (
+		ts   = b.Timestamps()
+		from = 0
+	)
+	for _, e := range events {
+		if e.Code != EventGap {
+			continue
+		}
+		// the run ends before the gap
+		to := from
+		for to < len(ts) && ts[to] < e.Timestamp {
+			to++
+		}
+		if to > from {
+			runs = append(runs, b.Slice(from, to))
+		}
+		// and the next one starts after it
+		from = to
+		for from < len(ts) && ts[from] < e.Timestamp+e.Duration {
+			from++
+		}
+	}
+	if from < len(ts) {
+		runs = append(runs, b.Slice(from, len(ts)))
+	}
+	return
+}
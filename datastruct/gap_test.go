@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseGapPolicy(t *testing.T) {
+	for _, p := range []GapPolicy{GapMark, GapNaN, GapInterpolate} {
+		if pp, err := ParseGapPolicy(p.String()); err != nil || pp != p {
+			t.Errorf("could not parse %v", p)
+		}
+	}
+	if _, err := ParseGapPolicy("zero"); err == nil {
+		t.Errorf("should not parse")
+	}
+}
+
+func TestFillGap(t *testing.T) {
+	if b := FillGap(GapMark, []float64{0}, 0, []float64{1}, 3, 1, nil); b != nil {
+		t.Errorf("should not fill")
+	}
+
+	b := FillGap(GapInterpolate, []float64{0, 4}, 10, []float64{4, 0}, 3, 2, nil)
+	if b.Samples() != 3 {
+		t.Fatalf("wrong size: %d", b.Samples())
+	}
+	if v, ts := b.Sample(2); v[0] != 3 || v[1] != 1 || ts != 16 {
+		t.Errorf("wrong sample: %v %v", v, ts)
+	}
+
+	b = FillGap(GapNaN, []float64{0}, 10, []float64{4}, 1, 2, nil)
+	if v, _ := b.Sample(0); !math.IsNaN(v[0]) {
+		t.Errorf("should be NaN")
+	}
+
+	// the trigger channels hold their level
+	infos := []*ChannelInfo{{Kind: KindEEG}, {Kind: KindTrigger}}
+	for _, p := range []GapPolicy{GapNaN, GapInterpolate} {
+		b = FillGap(p, []float64{0, 1}, 10, []float64{4, 0}, 3, 2, infos)
+		for s := 0; s < b.Samples(); s++ {
+			if v, _ := b.Sample(s); v[1] != 1 {
+				t.Errorf("%v: trigger should hold, got %v", p, v)
+			}
+		}
+	}
+}
+
+func TestSplitAtGaps(t *testing.T) {
+	var (
+		b      = mockBlockBuffer()
+		events = []*Event{
+			{Timestamp: 1, Code: EventTriggerOn},
+			NewGapEvent(2, 2, 1, "test", "dropped"), // 3 and 4
+			NewGapEvent(9, 5, 1, "test", "dropped"), // past the end
+		}
+		runs = SplitAtGaps(b, events)
+	)
+	if len(runs) != 2 {
+		t.Fatalf("wrong number of runs: %d", len(runs))
+	}
+	if runs[0].Samples() != 2 || runs[1].Samples() != 5 {
+		t.Errorf("wrong runs: %d %d", runs[0].Samples(), runs[1].Samples())
+	}
+	if _, ts := runs[1].Sample(0); ts != 5 {
+		t.Errorf("wrong start: %d", ts)
+	}
+	if runs = SplitAtGaps(b, nil); len(runs) != 1 || runs[0].Samples() != 10 {
+		t.Errorf("should not split")
+	}
+}
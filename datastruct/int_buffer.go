@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"fmt"
+)
+
+// ----------------------------------------------------------------- //
+// IntBuffer
+// ----------------------------------------------------------------- //
+
+// IntBuffer holds the raw integer samples of a device, like
+// the counts of an analog-to-digital converter, laid out like
+// the values of a BlockBuffer. It does not keep timestamps; it
+// accompanies a BlockBuffer of the same samples, whose values
+// are the counts multiplied by the Scale of each channel (see
+// ChannelInfo).
+type IntBuffer struct {
+	channels int     // number of channels per sample
+	samples  int     // number of samples
+	values   []int64 // data
+}
+
+// Create a new IntBuffer anticipating the given
+// number of channels and the given sample size.
+func NewIntBuffer(channels, samples int) *IntBuffer {
+	if channels < 0 || samples < 1 {
+		str := fmt.Sprintf("bad parameters: channels (%d); samples (%d)", channels, samples)
+		panic(str)
+	}
+	return &IntBuffer{
+		channels: channels,
+		values:   make([]int64, 0, channels*samples),
+	}
+}
+
+// Get the number of channels in this data.
+func (b *IntBuffer) Channels() int {
+	return b.channels
+}
+
+// The number of samples in this IntBuffer.
+func (b *IntBuffer) Samples() int {
+	return b.samples
+}
+
+// Append a single sample.
+func (b *IntBuffer) AppendSample(v []int64) {
+	if len(v) != b.channels {
+		panic("not comparable")
+	}
+	b.values = append(b.values, v...)
+	b.samples++
+}
+
+// Returns the s-th sample from the buffer, backed by
+// the buffer.
+func (b *IntBuffer) Sample(s int) []int64 {
+	return b.values[s*b.channels : (s+1)*b.channels]
+}
+
+// Create a new IntBuffer holding a copy of the samples
+// in the range [from, to).
+func (b *IntBuffer) Slice(from, to int) *IntBuffer {
+	if from >= to {
+		panic("from must be > to")
+	}
+	bb := NewIntBuffer(b.channels, to-from)
+	bb.values = append(bb.values, b.values[from*b.channels:to*b.channels]...)
+	bb.samples = to - from
+	return bb
+}
+
+// Arrays transforms the data into "sequential" channel
+// arrays, like BlockBuffer.Arrays().
+func (b *IntBuffer) Arrays() [][]int64 {
+	samples := b.Samples()
+	arr := make([][]int64, b.channels)
+	for c := range arr {
+		arr[c] = make([]int64, samples)
+		for s := range arr[c] {
+			arr[c][s] = b.values[s*b.channels+c]
+		}
+	}
+	return arr
+}
+
+// BlockBuffer converts the counts to floating point values,
+// unscaled, with the given timestamps.
+func (b *IntBuffer) BlockBuffer(ts []int64) *BlockBuffer {
+	samples := b.Samples()
+	if len(ts) != samples {
+		panic("wrong number of timestamps")
+	}
+	bb := NewBlockBuffer(b.channels, samples+1)
+	for _, x := range b.values {
+		bb.values = append(bb.values, float64(x))
+	}
+	bb.ts = append(bb.ts, ts...)
+	return bb
+}
@@ -0,0 +1,49 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"testing"
+)
+
+func mockIntBuffer() *IntBuffer {
+	b := NewIntBuffer(2, 3)
+	b.AppendSample([]int64{1, -1})
+	b.AppendSample([]int64{2, -2})
+	b.AppendSample([]int64{3, -3})
+	return b
+}
+
+func TestIntBuffer__Normal(t *testing.T) {
+	b := mockIntBuffer()
+	if b.Channels() != 2 || b.Samples() != 3 {
+		t.Fatalf("wrong dimensions")
+	}
+	if v := b.Sample(1); v[0] != 2 || v[1] != -2 {
+		t.Errorf("wrong sample: %v", v)
+	}
+	if arr := b.Arrays(); arr[1][2] != -3 || len(arr[0]) != 3 {
+		t.Errorf("wrong arrays: %v", arr)
+	}
+	AssertPanic(t, func() {
+		b.AppendSample([]int64{1})
+	})
+}
+
+func TestIntBuffer__Slice(t *testing.T) {
+	bb := mockIntBuffer().Slice(1, 3)
+	if bb.Samples() != 2 || bb.Sample(0)[0] != 2 {
+		t.Errorf("bad slice")
+	}
+}
+
+func TestIntBuffer__BlockBuffer(t *testing.T) {
+	bb := mockIntBuffer().BlockBuffer([]int64{10, 20, 30})
+	if v, ts := bb.Sample(2); v[1] != -3 || ts != 30 {
+		t.Errorf("wrong sample: %v %v", v, ts)
+	}
+	AssertPanic(t, func() {
+		mockIntBuffer().BlockBuffer([]int64{10})
+	})
+}
@@ -0,0 +1,291 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ----------------------------------------------------------------- //
+// Overflow Policies
+// ----------------------------------------------------------------- //
+
+// OverflowPolicy decides what a RingBuffer does when
+// data is appended to it while it is at capacity.
+type OverflowPolicy int
+
+const (
+	OverwriteOldest OverflowPolicy = iota // discard the oldest samples to make room
+	RejectWhenFull                        // refuse the append and return BufferFullErr
+)
+
+var BufferFullErr = errors.New("ring buffer is full")
+
+// ----------------------------------------------------------------- //
+// RingBuffer
+// ----------------------------------------------------------------- //
+
+// RingBuffer is a fixed-capacity variant of the BlockBuffer.
+// All of its storage is allocated up front, so appending and
+// popping samples does not allocate; this makes it suitable
+// for streams that run for hours. Like the BlockBuffer, it
+// keeps the channel values of a sample next to each other and
+// supports down-sampling with a pluck rate.
+type RingBuffer struct {
+	channels  int            // number of channels per sample
+	capacity  int            // maximum number of samples
+	policy    OverflowPolicy // what to do when full
+	parity    int            // plucking offset
+	pluckRate int            // downsampling, or plucking rate
+
+	head    int       // position of the oldest sample
+	size    int       // number of samples held
+	values  []float64 // data, capacity*channels
+	ts      []int64   // timestamps, capacity
+	dropped uint64    // samples discarded to make room
+}
+
+// Create a new RingBuffer holding at most capacity samples
+// of the given number of channels.
+func NewRingBuffer(channels, capacity int, policy OverflowPolicy) *RingBuffer {
+	if channels < 0 || capacity < 1 {
+		str := fmt.Sprintf("bad parameters: channels (%d); capacity (%d)", channels, capacity)
+		panic(str)
+	}
+	return &RingBuffer{
+		channels:  channels,
+		capacity:  capacity,
+		policy:    policy,
+		pluckRate: 1,
+		values:    make([]float64, channels*capacity),
+		ts:        make([]int64, capacity),
+	}
+}
+
+// Set the downsampling rate. This means that down
+// sampling will select 1 out of k samples.
+func (r *RingBuffer) PluckRate(k int) {
+	r.pluckRate = k
+}
+
+// Get the number of channels in this data.
+func (r *RingBuffer) Channels() int {
+	return r.channels
+}
+
+// The number of samples currently in this RingBuffer.
+func (r *RingBuffer) Samples() int {
+	return r.size
+}
+
+// The maximum number of samples this RingBuffer can hold.
+func (r *RingBuffer) Capacity() int {
+	return r.capacity
+}
+
+// Full returns true if and only if the buffer is at capacity.
+func (r *RingBuffer) Full() bool {
+	return r.size == r.capacity
+}
+
+// The number of samples that OverwriteOldest has discarded
+// to make room since the buffer was created.
+func (r *RingBuffer) Dropped() uint64 {
+	return r.dropped
+}
+
+// Reset discards all the samples in the buffer, keeping
+// the storage.
+func (r *RingBuffer) Reset() {
+	r.head = 0
+	r.size = 0
+	r.parity = 0
+}
+
+// The timestamps in this RingBuffer, oldest first. Since
+// the underlying storage wraps around, this returns a copy.
+func (r *RingBuffer) Timestamps() []int64 {
+	ts := make([]int64, r.size)
+	for s := range ts {
+		ts[s] = r.ts[r.index(s)]
+	}
+	return ts
+}
+
+// Append the data from a BlockBuffer to the RingBuffer. The
+// buffers must be comparable in the sense of channels. If the
+// data does not fit, then under OverwriteOldest the oldest
+// samples are discarded; under RejectWhenFull nothing is
+// appended and BufferFullErr is returned.
+func (r *RingBuffer) Append(bb *BlockBuffer) error {
+	if bb.channels != r.channels {
+		panic("not comparable")
+	}
+	samples := bb.Samples()
+	if r.policy == RejectWhenFull && r.size+samples > r.capacity {
+		return BufferFullErr
+	}
+
+	// only the last capacity samples can survive
+	from := 0
+	if samples > r.capacity {
+		from = samples - r.capacity
+		r.dropped += uint64(from)
+	}
+	for s := from; s < samples; s++ {
+		v, ts := bb.Sample(s)
+		r.put(v, ts)
+	}
+	return nil
+}
+
+// Append a single sample to the RingBuffer. Under
+// RejectWhenFull, BufferFullErr is returned if there
+// is no room.
+func (r *RingBuffer) AppendSample(v []float64, ts int64) error {
+	if len(v) != r.channels {
+		panic("not comparable")
+	}
+	if r.policy == RejectWhenFull && r.size == r.capacity {
+		return BufferFullErr
+	}
+	r.put(v, ts)
+	return nil
+}
+
+// Returns the s-th sample from the buffer, counting from
+// the oldest. The returned slice is backed by the buffer
+// and is only valid until the sample is overwritten. Going
+// out of bounds will cause a panic.
+func (r *RingBuffer) Sample(s int) (v []float64, ts int64) {
+	if s < 0 || s >= r.size {
+		panic("sample out of bounds")
+	}
+	i := r.index(s)
+	return r.values[i*r.channels : (i+1)*r.channels], r.ts[i]
+}
+
+// Pops and returns the oldest sample from the buffer. The
+// returned slice is backed by the buffer and is only valid
+// until the next append.
+func (r *RingBuffer) PopSample() (v []float64, ts int64) {
+	v, ts = r.Sample(0)
+	r.head = (r.head + 1) % r.capacity
+	r.size--
+	return
+}
+
+// Pops the next n samples and downsamples them according
+// to the down-sampling rate into a new BlockBuffer, just
+// like BlockBuffer.PopDownSample().
+func (r *RingBuffer) PopDownSample(n int) (bb *BlockBuffer) {
+	if n < 0 {
+		panic("n must be nonnegative")
+	}
+	bb = NewBlockBuffer(r.channels, n/r.pluckRate+1)
+	if n > r.size {
+		n = r.size
+	}
+
+	for s := 0; s < n; s++ {
+		if r.parity == 0 {
+			v, ts := r.PopSample()
+			bb.AppendSample(v, ts)
+		} else {
+			r.PopSample()
+		}
+
+		// increment the parity
+		r.parity = (r.parity + 1) % r.pluckRate
+	}
+	return
+}
+
+// Pops the next n samples and downsamples them like
+// PopDownSample(), but into "sequential" channel arrays like
+// those of Arrays(). The storage of the given arrays is reused,
+// so that popping batches of the same size does not allocate;
+// the arrays that are returned replace the given ones.
+func (r *RingBuffer) PopArrays(n int, values [][]float64) [][]float64 {
+	if n < 0 {
+		panic("n must be nonnegative")
+	}
+	if len(values) != r.channels {
+		values = make([][]float64, r.channels)
+	}
+	for c := range values {
+		values[c] = values[c][:0]
+	}
+	if n > r.size {
+		n = r.size
+	}
+
+	for s := 0; s < n; s++ {
+		if r.parity == 0 {
+			v, _ := r.PopSample()
+			for c, x := range v {
+				values[c] = append(values[c], x)
+			}
+		} else {
+			r.PopSample()
+		}
+
+		// increment the parity
+		r.parity = (r.parity + 1) % r.pluckRate
+	}
+	return values
+}
+
+// Create a new BlockBuffer holding a copy of the samples
+// in the range [from, to).
+func (r *RingBuffer) Slice(from, to int) *BlockBuffer {
+	if from >= to {
+		panic("from must be > to")
+	}
+	if from < 0 || to > r.size {
+		panic("slice out of bounds")
+	}
+	bb := NewBlockBuffer(r.channels, to-from)
+	for s := from; s < to; s++ {
+		v, ts := r.Sample(s)
+		bb.AppendSample(v, ts)
+	}
+	return bb
+}
+
+// Arrays transforms the data into "sequential" channel
+// arrays, oldest sample first, just like BlockBuffer.Arrays().
+func (r *RingBuffer) Arrays() ([][]float64, []int64) {
+	values := make([][]float64, r.channels)
+	for c := range values {
+		values[c] = make([]float64, r.size)
+	}
+	for s := 0; s < r.size; s++ {
+		v, _ := r.Sample(s)
+		for c, value := range v {
+			values[c][s] = value
+		}
+	}
+	return values, r.Timestamps()
+}
+
+// Write a sample at the tail, overwriting the
+// oldest sample if the buffer is full.
+func (r *RingBuffer) put(v []float64, ts int64) {
+	i := (r.head + r.size) % r.capacity
+	copy(r.values[i*r.channels:(i+1)*r.channels], v)
+	r.ts[i] = ts
+	if r.size < r.capacity {
+		r.size++
+	} else {
+		r.head = (r.head + 1) % r.capacity
+		r.dropped++
+	}
+}
+
+// Physical position of the s-th sample.
+func (r *RingBuffer) index(s int) int {
+	return (r.head + s) % r.capacity
+}
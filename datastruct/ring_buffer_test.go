@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"testing"
+)
+
+func TestNewRingBuffer__BadParameters(t *testing.T) {
+	AssertPanic(t, func() {
+		NewRingBuffer(-1, 10, OverwriteOldest)
+	})
+	AssertPanic(t, func() {
+		NewRingBuffer(2, 0, OverwriteOldest)
+	})
+}
+
+func TestRingBufferAppend__Normal(t *testing.T) {
+	r := NewRingBuffer(2, 20, OverwriteOldest)
+	if err := r.Append(mockBlockBuffer()); err != nil {
+		t.Errorf("could not append: %v", err)
+	}
+	if r.Samples() != 10 || r.Full() {
+		t.Errorf("wrong size: %d", r.Samples())
+	}
+
+	v, ts := r.Sample(9)
+	if v[0] != 10 || v[1] != 10 || ts != 10 {
+		t.Errorf("wrong read")
+	}
+}
+
+func TestRingBufferAppend__NotComparable(t *testing.T) {
+	r := NewRingBuffer(3, 20, OverwriteOldest)
+	AssertPanic(t, func() {
+		r.Append(mockBlockBuffer())
+	})
+	AssertPanic(t, func() {
+		r.AppendSample([]float64{1, 2}, 1)
+	})
+}
+
+func TestRingBufferAppend__OverwriteOldest(t *testing.T) {
+	r := NewRingBuffer(2, 4, OverwriteOldest)
+	if err := r.Append(mockBlockBuffer()); err != nil {
+		t.Errorf("should not reject: %v", err)
+	}
+	if r.Samples() != 4 || !r.Full() {
+		t.Errorf("wrong size: %d", r.Samples())
+	}
+	if r.Dropped() != 6 {
+		t.Errorf("expected 6 dropped samples, got %d", r.Dropped())
+	}
+
+	// only the last four should survive
+	_, ts := r.Arrays()
+	for i, expected := range []int64{7, 8, 9, 10} {
+		if ts[i] != expected {
+			t.Errorf("wrong timestamps: %v", ts)
+		}
+	}
+
+	// and keep wrapping
+	r.AppendSample([]float64{11, 11}, 11)
+	if v, ts := r.Sample(0); v[0] != 8 || ts != 8 {
+		t.Errorf("wrong oldest sample after wrap")
+	}
+	if v, ts := r.Sample(3); v[0] != 11 || ts != 11 {
+		t.Errorf("wrong newest sample after wrap")
+	}
+	if r.Dropped() != 7 {
+		t.Errorf("expected 7 dropped samples, got %d", r.Dropped())
+	}
+}
+
+func TestRingBufferAppend__RejectWhenFull(t *testing.T) {
+	r := NewRingBuffer(2, 12, RejectWhenFull)
+	if err := r.Append(mockBlockBuffer()); err != nil {
+		t.Errorf("should have fit: %v", err)
+	}
+	if err := r.Append(mockBlockBuffer()); err != BufferFullErr {
+		t.Errorf("should have rejected")
+	}
+	if r.Samples() != 10 {
+		t.Errorf("rejected append should not change the buffer")
+	}
+
+	r.AppendSample([]float64{1, 1}, 1)
+	r.AppendSample([]float64{1, 1}, 1)
+	if err := r.AppendSample([]float64{1, 1}, 1); err != BufferFullErr {
+		t.Errorf("should have rejected")
+	}
+}
+
+func TestRingBufferPopDownSample__Normal(t *testing.T) {
+	r := NewRingBuffer(2, 6, OverwriteOldest)
+	r.PluckRate(3)
+
+	// wraps the storage
+	r.Append(mockBlockBuffer().Slice(0, 4))
+	r.PopDownSample(3)
+	r.Append(mockBlockBuffer().Slice(4, 10))
+
+	out := r.PopDownSample(10)
+	if out.Samples() != 2 || r.Samples() != 0 {
+		t.Errorf("wrong PopDownSample size: %d", out.Samples())
+	}
+
+	v, ts := out.PopSample()
+	if v[0] != 5 || v[1] != 5 || ts != 5 {
+		t.Errorf("wrong read: %v %v", v, ts)
+	}
+
+	v, ts = out.PopSample()
+	if v[0] != 8 || v[1] != 8 || ts != 8 {
+		t.Errorf("wrong read: %v %v", v, ts)
+	}
+}
+
+func TestRingBufferPopArrays(t *testing.T) {
+	r := NewRingBuffer(2, 20, OverwriteOldest)
+	r.PluckRate(2)
+	r.Append(mockBlockBuffer())
+
+	values := r.PopArrays(4, nil)
+	if len(values) != 2 || len(values[0]) != 2 || r.Samples() != 6 {
+		t.Fatalf("wrong dimensions: %v", values)
+	}
+	if values[0][0] != 1 || values[1][1] != 3 {
+		t.Errorf("wrong values: %v", values)
+	}
+
+	// the arrays are reused
+	bb := mockBlockBuffer().Slice(0, 4)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Append(bb)
+		values = r.PopArrays(4, values)
+	})
+	if allocs != 0 {
+		t.Errorf("popping should reuse the arrays, got %v allocations", allocs)
+	}
+}
+
+func TestRingBufferSlice(t *testing.T) {
+	r := NewRingBuffer(2, 5, OverwriteOldest)
+	r.Append(mockBlockBuffer())
+
+	bb := r.Slice(1, 3)
+	if bb.Samples() != 2 {
+		t.Errorf("bad slice: %d", bb.Samples())
+	}
+	if v, ts := bb.Sample(0); v[0] != 7 || ts != 7 {
+		t.Errorf("bad slice contents")
+	}
+	AssertPanic(t, func() {
+		r.Slice(3, 6)
+	})
+}
+
+func TestRingBufferArrays(t *testing.T) {
+	r := NewRingBuffer(2, 3, OverwriteOldest)
+	r.Append(mockBlockBuffer())
+
+	values, ts := r.Arrays()
+	if len(values) != 2 || len(values[0]) != 3 || len(ts) != 3 {
+		t.Errorf("wrong dimensions")
+	}
+	if values[1][0] != 8 || values[1][2] != 10 || ts[0] != 8 {
+		t.Errorf("wrong values: %v %v", values, ts)
+	}
+}
+
+func TestRingBufferAppend__NoAllocs(t *testing.T) {
+	var (
+		r  = NewRingBuffer(2, 32, OverwriteOldest)
+		bb = mockBlockBuffer()
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Append(bb)
+		r.Sample(0)
+		r.PopSample()
+	})
+	if allocs != 0 {
+		t.Errorf("append should not allocate, got %v", allocs)
+	}
+}
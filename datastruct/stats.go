@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"math"
+	"sync"
+)
+
+// ----------------------------------------------------------------- //
+// Channel Statistics
+// ----------------------------------------------------------------- //
+
+// ChannelStats holds summary statistics of the values of a
+// channel. Values that are NaN, like those standing in for a
+// gap, are left out.
+type ChannelStats struct {
+	Count    int64   `json:"count"`    // number of values
+	Mean     float64 `json:"mean"`     // arithmetic mean
+	Variance float64 `json:"variance"` // population variance
+	Min      float64 `json:"min"`      // smallest value
+	Max      float64 `json:"max"`      // largest value
+	Rms      float64 `json:"rms"`      // root mean square
+}
+
+// The standard deviation of the values.
+func (cs *ChannelStats) StdDev() float64 {
+	return math.Sqrt(cs.Variance)
+}
+
+// A Welford accumulator for a single channel.
+type welford struct {
+	n        int64
+	mean, m2 float64
+	min, max float64
+}
+
+func (w *welford) add(x float64) {
+	if math.IsNaN(x) {
+		return
+	}
+	if w.n == 0 || x < w.min {
+		w.min = x
+	}
+	if w.n == 0 || x > w.max {
+		w.max = x
+	}
+	w.n++
+	d := x - w.mean
+	w.mean += d / float64(w.n)
+	w.m2 += d * (x - w.mean)
+}
+
+func (w *welford) stats() *ChannelStats {
+	cs := &ChannelStats{
+		Count: w.n,
+		Mean:  w.mean,
+		Min:   w.min,
+		Max:   w.max,
+	}
+	if w.n > 0 {
+		cs.Variance = w.m2 / float64(w.n)
+		cs.Rms = math.Sqrt(cs.Variance + w.mean*w.mean)
+	}
+	return cs
+}
+
+// ComputeStats computes the statistics of every channel of
+// the buffer.
+func ComputeStats(b *BlockBuffer) []*ChannelStats {
+	ws := make([]welford, b.Channels())
+	for s := 0; s < b.Samples(); s++ {
+		v, _ := b.Sample(s)
+		for c, x := range v {
+			ws[c].add(x)
+		}
+	}
+	stats := make([]*ChannelStats, len(ws))
+	for c := range ws {
+		stats[c] = ws[c].stats()
+	}
+	return stats
+}
+
+// ----------------------------------------------------------------- //
+// Running Statistics
+// ----------------------------------------------------------------- //
+
+// Stats accumulates per-channel statistics over a stream of
+// BlockBuffers, both over the whole stream (the session) and
+// over a sliding window of its most recent samples. The number
+// of channels is set by the first buffer; a buffer with another
+// number of channels starts the statistics over.
+//
+// Stats is thread-safe, so it may be read while it is being
+// fed.
+type Stats struct {
+	sync.Mutex
+	session []welford
+	window  *RingBuffer
+	size    int // samples in the window
+}
+
+// Create a new Stats with a sliding window of the given
+// number of samples. A window of 0 keeps no window.
+func NewStats(window int) *Stats {
+	if window < 0 {
+		panic("window cannot be negative")
+	}
+	return &Stats{size: window}
+}
+
+// Add the samples of the buffer to the statistics.
+func (st *Stats) Add(b *BlockBuffer) {
+	st.Lock()
+	defer st.Unlock()
+	if b.Channels() != len(st.session) {
+		st.session = make([]welford, b.Channels())
+		st.window = nil
+		if st.size > 0 {
+			st.window = NewRingBuffer(b.Channels(), st.size, OverwriteOldest)
+		}
+	}
+	for s := 0; s < b.Samples(); s++ {
+		v, _ := b.Sample(s)
+		for c, x := range v {
+			st.session[c].add(x)
+		}
+	}
+	if st.window != nil {
+		st.window.Append(b)
+	}
+}
+
+// The statistics of every channel over the whole stream,
+// or nil if nothing has been added.
+func (st *Stats) Session() []*ChannelStats {
+	st.Lock()
+	defer st.Unlock()
+	if st.session == nil {
+		return nil
+	}
+	stats := make([]*ChannelStats, len(st.session))
+	for c := range st.session {
+		stats[c] = st.session[c].stats()
+	}
+	return stats
+}
+
+// The statistics of every channel over the sliding window,
+// or nil if there is no window or nothing has been added.
+func (st *Stats) Window() []*ChannelStats {
+	st.Lock()
+	defer st.Unlock()
+	if st.window == nil || st.window.Samples() == 0 {
+		return nil
+	}
+	return ComputeStats(st.window.Slice(0, st.window.Samples()))
+}
+
+// Forget everything that was added.
+func (st *Stats) Reset() {
+	st.Lock()
+	defer st.Unlock()
+	st.session = nil
+	st.window = nil
+}
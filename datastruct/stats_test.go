@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package datastruct
+
+import (
+	"math"
+	"testing"
+)
+
+func near(x, y float64) bool {
+	return math.Abs(x-y) <= 1e-9*math.Max(1, math.Abs(y))
+}
+
+func TestComputeStats(t *testing.T) {
+	b := NewBlockBuffer(2, 5)
+	for s, x := range []float64{2, 4, 4, math.NaN(), 6} {
+		b.AppendSample([]float64{x, -x}, int64(s))
+	}
+	stats := ComputeStats(b)
+	cs := stats[0]
+	if cs.Count != 4 || cs.Mean != 4 || cs.Variance != 2 || cs.Min != 2 || cs.Max != 6 {
+		t.Errorf("wrong stats: %+v", cs)
+	}
+	if !near(cs.Rms, math.Sqrt(18)) || !near(cs.StdDev(), math.Sqrt(2)) {
+		t.Errorf("wrong rms: %+v", cs)
+	}
+	if cs := stats[1]; cs.Mean != -4 || cs.Min != -6 || cs.Max != -2 {
+		t.Errorf("wrong stats: %+v", cs)
+	}
+}
+
+func TestStats(t *testing.T) {
+	st := NewStats(4)
+	if st.Session() != nil || st.Window() != nil {
+		t.Errorf("expected no stats")
+	}
+
+	// a large offset should not spoil the variance
+	b := NewBlockBuffer(1, 10)
+	for s := 0; s < 10; s++ {
+		b.AppendSample([]float64{1e6 + float64(s%2)}, int64(s))
+	}
+	st.Add(b.Slice(0, 3))
+	st.Add(b.Slice(3, 10))
+
+	session := st.Session()[0]
+	if session.Count != 10 || !near(session.Mean, 1e6+0.5) || !near(session.Variance, 0.25) {
+		t.Errorf("wrong session stats: %+v", session)
+	}
+	window := st.Window()[0]
+	if window.Count != 4 || window.Min != 1e6 || window.Max != 1e6+1 {
+		t.Errorf("wrong window stats: %+v", window)
+	}
+
+	// other channels start over
+	c := NewBlockBuffer(2, 1)
+	c.AppendSample([]float64{1, 2}, 10)
+	st.Add(c)
+	if s := st.Session(); len(s) != 2 || s[0].Count != 1 || st.Window()[1].Max != 2 {
+		t.Errorf("should start over: %+v", s)
+	}
+
+	st.Reset()
+	if st.Session() != nil {
+		t.Errorf("expected no stats after reset")
+	}
+
+	st = NewStats(0)
+	st.Add(b)
+	if st.Window() != nil || st.Session()[0].Count != 10 {
+		t.Errorf("expected session stats only")
+	}
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Constants
+// ----------------------------------------------------------------- //
+
+const (
+	// The number of observations after which an observation
+	// carries half of its original weight in the estimates.
+	DefaultClockHalfLife = 2048
+
+	// Observations whose offset deviates from the prediction by
+	// more than this many jitters (and ClockMinOutlier) are not
+	// used in the estimates, since they are most likely frames
+	// held up by the operating system.
+	ClockOutlierJitters = 10
+	ClockMinOutlier     = 5 * time.Millisecond
+
+	// After this many outliers in a row, the host clock is
+	// assumed to have stepped and the estimates start over.
+	ClockMaxOutliers = 32
+
+	// The number of observations needed before outliers are
+	// rejected.
+	clockWarmup = 16
+)
+
+// ----------------------------------------------------------------- //
+// Clocked Frames
+// ----------------------------------------------------------------- //
+
+// ClockedFrame is a DataFrame that knows both when it was
+// generated, according to the clock of the device, and when it
+// was received, according to the clock of the host.
+type ClockedFrame interface {
+	DataFrame
+	Generated() time.Time
+	Received() time.Time
+}
+
+// ----------------------------------------------------------------- //
+// Clock Sync -- device clock to host clock synchronization
+// ----------------------------------------------------------------- //
+
+// ClockEstimate is the current estimate of the relationship
+// between the device clock and the host clock.
+type ClockEstimate struct {
+	Offset   time.Duration // host time minus device time, at the latest observation
+	Drift    float64       // the rate at which the offset changes, in parts per million
+	Jitter   time.Duration // the deviation of the observations from the estimate
+	Pairs    int           // the number of observations used
+	Outliers int           // the number of observations rejected
+}
+
+func (e *ClockEstimate) String() string {
+	return fmt.Sprintf("offset=%v drift=%.2fppm jitter=%v pairs=%d outliers=%d",
+		e.Offset, e.Drift, e.Jitter, e.Pairs, e.Outliers)
+}
+
+// ClockSync maps device timestamps into host time. It fits
+// the offset between the clocks as a line in device time by
+// exponentially-weighted least squares over the (generated,
+// received) pairs of the frames it observes, so the fit follows
+// slow changes in the drift. Since a frame can only be received
+// after it was generated, the offset includes the average
+// transport latency of the frames.
+//
+// ClockSync is thread-safe.
+type ClockSync struct {
+	sync.Mutex
+	λ float64 // forgetting factor
+	clockState
+}
+
+type clockState struct {
+	g0   int64   // device time of the first observation, ns
+	off0 int64   // offset of the first observation, ns
+	last float64 // device time of the latest observation, s
+
+	// weighted running moments of x = device time (s)
+	// and y = offset (s), relative to g0 and off0
+	w, mx, my, cxx, cxy float64
+
+	// weighted mean squared residual
+	jw, jss float64
+
+	pairs    int
+	outliers int
+	run      int // consecutive outliers
+}
+
+// Create a new ClockSync whose observations lose half of
+// their weight after halfLife further observations.
+func NewClockSync(halfLife int) *ClockSync {
+	if halfLife < 1 {
+		panic("half life must be positive")
+	}
+	return &ClockSync{
+		λ: math.Pow(0.5, 1/float64(halfLife)),
+	}
+}
+
+// Forget all observations, for instance when the device
+// is engaged anew.
+func (cs *ClockSync) Reset() {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.reset()
+}
+
+func (cs *ClockSync) reset() {
+	cs.clockState = clockState{}
+}
+
+// Observe a frame that was generated and received at the
+// given times, in nanoseconds.
+func (cs *ClockSync) Observe(generated, received int64) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.observe(generated, received)
+}
+
+func (cs *ClockSync) observe(generated, received int64) {
+	if cs.pairs == 0 {
+		cs.g0 = generated
+		cs.off0 = received - generated
+	}
+
+	var (
+		x = float64(generated-cs.g0) / 1e9
+		y = float64(received-generated-cs.off0) / 1e9
+		r = y - cs.predict(x)
+	)
+
+	// reject the frames that were held up
+	if cs.pairs >= clockWarmup {
+		limit := math.Max(ClockOutlierJitters*cs.jitter(), ClockMinOutlier.Seconds())
+		if math.Abs(r) > limit {
+			cs.outliers++
+			cs.run++
+			if cs.run >= ClockMaxOutliers {
+				log.Printf("clock sync: host clock stepped by %v, starting over",
+					time.Duration(r*1e9))
+				cs.reset()
+				cs.observe(generated, received)
+			}
+			return
+		}
+	}
+	cs.run = 0
+
+	if cs.pairs > 0 {
+		cs.jw = cs.λ*cs.jw + 1
+		cs.jss = cs.λ*cs.jss + r*r
+	}
+
+	cs.w = cs.λ*cs.w + 1
+	dx, dy := x-cs.mx, y-cs.my
+	cs.mx += dx / cs.w
+	cs.my += dy / cs.w
+	cs.cxx = cs.λ*cs.cxx + dx*(x-cs.mx)
+	cs.cxy = cs.λ*cs.cxy + dx*(y-cs.my)
+
+	cs.last = x
+	cs.pairs++
+}
+
+// The fitted slope, which is zero until the observations
+// span some device time.
+func (cs *ClockSync) slope() float64 {
+	if cs.cxx <= 1e-12 {
+		return 0
+	}
+	return cs.cxy / cs.cxx
+}
+
+// The fitted offset at device time x, relative to off0.
+func (cs *ClockSync) predict(x float64) float64 {
+	return cs.my + cs.slope()*(x-cs.mx)
+}
+
+func (cs *ClockSync) jitter() float64 {
+	if cs.jw == 0 {
+		return 0
+	}
+	return math.Sqrt(cs.jss / cs.jw)
+}
+
+// Convert a device timestamp into host time. Before any
+// observations, timestamps are returned unchanged.
+func (cs *ClockSync) ToHost(ts int64) int64 {
+	cs.Lock()
+	defer cs.Unlock()
+	return cs.toHost(ts)
+}
+
+func (cs *ClockSync) toHost(ts int64) int64 {
+	if cs.pairs == 0 {
+		return ts
+	}
+	x := float64(ts-cs.g0) / 1e9
+	return ts + cs.off0 + int64(cs.predict(x)*1e9)
+}
+
+// Rewrite the timestamps of the buffer into host time.
+func (cs *ClockSync) SyncBuffer(b *BlockBuffer) {
+	cs.Lock()
+	defer cs.Unlock()
+	b.TransformTs(func(s int, ts int64) int64 {
+		return cs.toHost(ts)
+	})
+}
+
+// Observe the frame and rewrite the timestamps of its
+// buffer and events into host time, in place.
+func (cs *ClockSync) Synchronize(df ClockedFrame) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.observe(df.Generated().UnixNano(), df.Received().UnixNano())
+	df.Buffer().TransformTs(func(s int, ts int64) int64 {
+		return cs.toHost(ts)
+	})
+	for _, e := range df.Events() {
+		e.Timestamp = cs.toHost(e.Timestamp)
+	}
+}
+
+// The current estimate of the clock relationship.
+func (cs *ClockSync) Estimate() *ClockEstimate {
+	cs.Lock()
+	defer cs.Unlock()
+	e := &ClockEstimate{
+		Drift:    cs.slope() * 1e6,
+		Jitter:   time.Duration(cs.jitter() * 1e9),
+		Pairs:    cs.pairs,
+		Outliers: cs.outliers,
+	}
+	if cs.pairs > 0 {
+		e.Offset = time.Duration(cs.off0 + int64(cs.predict(cs.last)*1e9))
+	}
+	return e
+}
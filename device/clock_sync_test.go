@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const (
+	testOffset  = int64(2 * time.Second)
+	testDrift   = 50e-6
+	testPeriod  = int64(64 * time.Millisecond)
+	testLatency = int64(2 * time.Millisecond)
+)
+
+// The host time at which the device generated a frame, for a
+// device clock that is ahead and slow.
+func hostTime(generated int64) int64 {
+	return generated + testOffset + int64(float64(generated)*testDrift)
+}
+
+// Feed the clock sync n frames from frame k, received with a
+// latency of 1 to 3 ms.
+func observeFrames(cs *ClockSync, r *rand.Rand, k, n int) {
+	for i := k; i < k+n; i++ {
+		g := int64(i) * testPeriod
+		latency := testLatency + r.Int63n(int64(2*time.Millisecond)) - int64(time.Millisecond)
+		cs.Observe(g, hostTime(g)+latency)
+	}
+}
+
+type clockedFrame struct {
+	MockFrame
+	events              []*Event
+	generated, received time.Time
+}
+
+func (f *clockedFrame) Events() []*Event     { return f.events }
+func (f *clockedFrame) Generated() time.Time { return f.generated }
+func (f *clockedFrame) Received() time.Time  { return f.received }
+
+func TestClockSync__Estimate(t *testing.T) {
+	var (
+		cs = NewClockSync(DefaultClockHalfLife)
+		r  = rand.New(rand.NewSource(1))
+	)
+	if e := cs.Estimate(); e.Pairs != 0 || e.Offset != 0 || cs.ToHost(42) != 42 {
+		t.Errorf("expected an empty estimate")
+	}
+
+	observeFrames(cs, r, 0, 10000)
+	e := cs.Estimate()
+	if e.Pairs != 10000 || e.Outliers != 0 {
+		t.Errorf("wrong counts: %v", e)
+	}
+	if math.Abs(e.Drift-testDrift*1e6) > 1 {
+		t.Errorf("wrong drift: %v", e)
+	}
+	if e.Jitter < 400*time.Microsecond || e.Jitter > 800*time.Microsecond {
+		t.Errorf("wrong jitter: %v", e)
+	}
+
+	// the offset includes the average latency
+	g := int64(9999) * testPeriod
+	if d := time.Duration(int64(e.Offset) - (hostTime(g) + testLatency - g)); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("wrong offset: %v (off by %v)", e, d)
+	}
+	if d := time.Duration(cs.ToHost(g) - hostTime(g) - testLatency); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("wrong host time: off by %v", d)
+	}
+}
+
+func TestClockSync__Outliers(t *testing.T) {
+	var (
+		cs = NewClockSync(DefaultClockHalfLife)
+		r  = rand.New(rand.NewSource(2))
+	)
+	observeFrames(cs, r, 0, 1000)
+	before := cs.Estimate()
+
+	// a frame that was held up
+	g := int64(1000) * testPeriod
+	cs.Observe(g, hostTime(g)+int64(300*time.Millisecond))
+	after := cs.Estimate()
+	if after.Outliers != 1 || after.Pairs != before.Pairs || after.Offset != before.Offset {
+		t.Errorf("outlier was not rejected: %v", after)
+	}
+
+	// the host clock steps by a second
+	observeFrames(cs, r, 1001, 1)
+	for i := 1002; i < 1002+ClockMaxOutliers; i++ {
+		g := int64(i) * testPeriod
+		cs.Observe(g, hostTime(g)+testLatency+int64(time.Second))
+	}
+	e := cs.Estimate()
+	if e.Pairs != 1 {
+		t.Errorf("expected to start over: %v", e)
+	}
+	g = int64(1001+ClockMaxOutliers) * testPeriod
+	if d := e.Offset - time.Duration(hostTime(g)+testLatency+int64(time.Second)-g); d != 0 {
+		t.Errorf("wrong offset after the step: off by %v", d)
+	}
+}
+
+func TestClockSync__Synchronize(t *testing.T) {
+	var (
+		cs  = NewClockSync(DefaultClockHalfLife)
+		r   = rand.New(rand.NewSource(3))
+		g   = int64(5000) * testPeriod
+		δ   = int64(4 * time.Millisecond)
+		buf = NewBlockBuffer(1, 16)
+	)
+	observeFrames(cs, r, 0, 5000)
+	for s := 0; s < 16; s++ {
+		buf.AppendSample([]float64{float64(s)}, g+int64(s)*δ)
+	}
+	df := &clockedFrame{
+		MockFrame: MockFrame{buf: buf},
+		events:    []*Event{&Event{Timestamp: g + 3*δ, Code: EventTriggerOn}},
+		generated: time.Unix(0, g),
+		received:  time.Unix(0, hostTime(g)+testLatency),
+	}
+	cs.Synchronize(df)
+
+	if e := cs.Estimate(); e.Pairs != 5001 {
+		t.Errorf("frame was not observed: %v", e)
+	}
+	for s := 0; s < 16; s++ {
+		_, ts := buf.Sample(s)
+		want := hostTime(g+int64(s)*δ) + testLatency
+		if d := time.Duration(ts - want); d < -time.Millisecond || d > time.Millisecond {
+			t.Errorf("sample %d is off by %v", s, d)
+		}
+	}
+	if _, ts := buf.Sample(3); df.events[0].Timestamp != ts {
+		t.Errorf("event was not rewritten with its sample: %d != %d", df.events[0].Timestamp, ts)
+	}
+}
@@ -4,11 +4,13 @@
 package device
 
 import (
+	"context"
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/repo"
 	"log"
 	"sync"
+	"time"
 )
 
 func init() {
@@ -21,6 +23,10 @@ func init() {
 
 const DataFrameBufferSize = 1024
 
+// How long engaging may take by default, including the
+// handshake in which the device sends its DeviceInfo.
+const DefaultEngageTimeout = 10 * time.Second
+
 // ----------------------------------------------------------------- //
 // Device -- interface for devices
 // ----------------------------------------------------------------- //
@@ -38,10 +44,10 @@ type Device interface {
 	// Obtain the device information
 	Info() *DeviceInfo
 
-	// Engage to the device and return the output channel.
-	// Engageing to a device that is already engaged is
-	// an error.
-	Engage() error
+	// Engage to the device. Engageing to a device that is
+	// already engaged is an error, as is a device that does
+	// not send its DeviceInfo before the context is done.
+	Engage(context.Context) error
 
 	// Disengages from the device, closes the output channel,
 	// and cleans relevant resources. Calls to disengage are
@@ -52,11 +58,72 @@ type Device interface {
 	// currently engaged.
 	Engaged() bool
 
-	// Subscribe to device data.
+	// The stage of the lifecycle of the device. The device
+	// is engaged while it is streaming or reconnecting.
+	State() DeviceState
+
+	// Subscribe to the changes of state of the device.
+	SubscribeState(string) (chan *StateChange, error)
+
+	// Unsubscribe from the changes of state of the device.
+	UnsubscribeState(string)
+
+	// Set the policy for reconnecting when the stream fails,
+	// or nil to disengage instead.
+	SetReconnectPolicy(*ReconnectPolicy)
+
+	// The settings that the device supports, or nil if the
+	// device cannot be configured.
+	Capabilities() *DeviceCapabilities
+
+	// Choose the settings of the device, which take effect
+	// when it is next engaged. Configuring an engaged device
+	// is an error.
+	Configure(DeviceConfig) error
+
+	// The current settings of the device.
+	Config() DeviceConfig
+
+	// Subscribe to device data. The subscription blocks
+	// the device when the subscriber is slow.
 	Subscribe(string) (chan DataFrame, error)
 
+	// Subscribe to device data with the given policy for
+	// when the subscriber is slow.
+	SubscribeWithPolicy(string, DeliveryPolicy) (chan DataFrame, error)
+
+	// Subscribe to device data as it comes out of the
+	// processor, with the given policy.
+	SubscribeProcessed(string, DeliveryPolicy, Processor) (chan DataFrame, error)
+
+	// Subscribe to device data with the given policy, and
+	// get the frames of the given length of the stream that
+	// came right before.
+	SubscribeWithHistory(string, DeliveryPolicy, time.Duration) (chan DataFrame, []DataFrame, error)
+
+	// Set how much of the stream the device keeps.
+	SetHistory(time.Duration)
+
+	// The frames of the given length of the stream, up to
+	// the latest one.
+	History(time.Duration) []DataFrame
+
+	// The counters of every subscription.
+	Subscriptions() []*SubscriptionStats
+
 	// Unsubscribe from device data.
 	Unsubscribe(string)
+
+	// The current estimate of the device clock relative to
+	// the host clock. Devices whose frames do not carry both
+	// clocks report an empty estimate.
+	Clock() *ClockEstimate
+
+	// The current metrics of the link to the device.
+	Metrics() *MetricsSnapshot
+
+	// Mark the stream with a named marker.
+	Mark(string)
 }
 
 // ----------------------------------------------------------------- //
@@ -67,8 +134,9 @@ type Device interface {
 type DeviceImpl interface {
 	// Performs the low-level operation to engage
 	// to the device. This usually means opening the port of the
-	// device for reading.
-	Engage() error
+	// device for reading. It should give up when the context
+	// is done.
+	Engage(context.Context) error
 
 	// Perfoms the low-level operation to disengage
 	// from the device. This usually means closing the port of the
@@ -80,10 +148,11 @@ type DeviceImpl interface {
 	// expected to obey the following contract with the Control:
 	//
 	// (1) The first possible call shalt be to SendInfo(), or else
-	//     the device Engage() function will wait indefinitely.
+	//     the device Engage() function will time out.
 	// (2) It shalt not perform any resource cleanup, this is the
 	//     job of Disengage(). It shalt NOT try to disengage the device.
-	// (3) It shalt obey c.ShouldTerminate() and exit without error.
+	// (3) It shalt exit without error when c.Context() is done, as
+	//     reported by c.ShouldTerminate().
 	// (4) Upon any error, it shalt return that error.
 	//
 	// Note returning DeviceInfo in this way is a hardware limitation.
@@ -124,15 +193,34 @@ type BaseDevice struct {
 	control    *Control
 	deviceImpl DeviceImpl
 	info       *DeviceInfo
+	config     DeviceConfig
 	ps         *PubSub
+	clock      *ClockSync
+	metrics    *Metrics
+	state      *stateMachine
+	rc         reconnector
+
+	// kept by the streamer, to mark reconnections
+	lastTs    int64 // timestamp of the last sample published
+	published bool  // whether any sample was published
+	resumed   bool  // whether the stream was just reconnected
+
+	// markers waiting for the next frame
+	marksLock sync.Mutex
+	marks     []*Event
 }
 
 // Create a new device based on some given
 // device implementation.
 func NewDevice(deviceImpl DeviceImpl) Device {
+	ps := NewPubSub()
+	ps.SetHistory(DefaultHistory)
 	return &BaseDevice{
 		deviceImpl: deviceImpl,
-		ps:         NewPubSub(),
+		ps:         ps,
+		clock:      NewClockSync(DefaultClockHalfLife),
+		metrics:    NewMetrics(),
+		state:      newStateMachine(),
 	}
 }
 
@@ -153,7 +241,7 @@ func (d *BaseDevice) Info() *DeviceInfo {
 	return d.info
 }
 
-func (d *BaseDevice) Engage() (err error) {
+func (d *BaseDevice) Engage(ctx context.Context) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
@@ -163,71 +251,139 @@ func (d *BaseDevice) Engage() (err error) {
 	}
 
 	log.Printf("%s: CONNECT", d.Name())
+	d.state.move(StateEngaging, "engage requested", StateIdle, StateError)
 
 	// perform engage
-	if err = d.deviceImpl.Engage(); err != nil {
+	if err = d.deviceImpl.Engage(ctx); err != nil {
+		d.state.move(StateError, err.Error(), StateEngaging)
 		return fmt.Errorf("could not engage to the device: %v", err)
 	}
 
-	// create the controller
+	// create the controller; the device clock
+	// may have been reset since the last session
 	d.control = newControl(d)
+	d.clock.Reset()
+	d.metrics.Reset()
+	d.ps.resetHistory()
+	d.published, d.resumed = false, false
+	d.rc.reset()
+	d.takeMarks()
 
 	// begin to stream
-	go func() {
-		// run the streamer and listen for errors
-		if err := d.deviceImpl.Stream(d.control); err != nil {
-			log.Printf("error in streamer: %v", err)
+	go d.stream(d.control)
+
+	// listen for info, which the driver may never send
+	var info *DeviceInfo
+	select {
+	case info = <-d.control.info:
+	case <-d.control.stopped:
+		// the info is sent before the stream ends
+		select {
+		case info = <-d.control.info:
+		default:
+			err = fmt.Errorf("stream ended before the device info: %v", d.control.err)
 		}
-
-		// on error or exit, we will disengage the device;
-		// since we know the streamer has exited we will
-		// not send the done signal
-		if err := d.disengage(true); err != nil {
-			log.Printf("error on disengage: %v", err)
+	case <-ctx.Done():
+		err = fmt.Errorf("no device info: %v", ctx.Err())
+	}
+	if err != nil {
+		if e := d.stop(); e != nil {
+			log.Printf("error on disengage: %v", e)
 		}
-
-	}()
-
-	// listen for info
-	info := <-d.control.info
+		d.state.move(StateError, err.Error(), StateEngaging, StateReconnecting)
+		return fmt.Errorf("could not engage to the device: %v", err)
+	}
 
 	d.info = info
 	log.Printf("%s: DEVICE INFO %+v", d.Name(), info)
 
-	// mark engaged
+	// mark engaged; the stream may already
+	// have failed
 	d.engaged = true
+	d.state.move(StateStreaming, "engaged", StateEngaging)
 	return nil
 }
 
+// Run the streamer and, whenever it fails after the
+// handshake, reconnect according to the policy.
+func (d *BaseDevice) stream(c *Control) {
+	err := d.deviceImpl.Stream(c)
+	for err != nil && c.handshake != nil && !c.ShouldTerminate() {
+		log.Printf("error in streamer: %v", err)
+		errc := d.reconnect(c, err)
+		if errc == nil {
+			break
+		}
+		err = <-errc
+	}
+	c.err = err
+	close(c.stopped)
+
+	// on error or exit, we will disengage the device
+	if err := d.disengage(c, err); err != nil {
+		log.Printf("error on disengage: %v", err)
+	}
+}
+
 func (d *BaseDevice) Disengage() (err error) {
-	return d.disengage(false)
+	return d.disengage(nil, nil)
 }
 
-func (d *BaseDevice) disengage(ignoreDone bool) (err error) {
+// Disengage the device, because of the cause if it is not
+// nil. A streamer passes its Control, so that it does not
+// disengage a later engagement.
+func (d *BaseDevice) disengage(c *Control, cause error) (err error) {
 	d.Lock()
 	defer d.Unlock()
 
 	// check for idempotency
-	if !d.engaged {
+	if !d.engaged || (c != nil && c != d.control) {
 		return
 	}
 
 	log.Printf("%s: DISCONNECT", d.Name())
-
-	// when we know the streamer goroutine has
-	// exited, we should skip this step
-	if !ignoreDone {
-		d.control.done <- true
+	reason := "disengage requested"
+	if cause != nil {
+		reason = cause.Error()
+	}
+	d.state.move(StateDisengaging, reason, StateEngaging, StateStreaming, StateReconnecting)
+	if e := d.clock.Estimate(); e.Pairs > 0 {
+		log.Printf("%s: CLOCK %v", d.Name(), e)
 	}
 
-	d.ps.UnsubscribeAll()
+	// tell the streamer to stop, if it has not
+	err = d.stop()
 
-	// disengage
-	err = d.deviceImpl.Disengage()
+	for _, s := range d.ps.Subscriptions() {
+		if s.Dropped > 0 {
+			log.Printf("%s: DROPPED %d of %d frames for '%s' (%v)",
+				d.Name(), s.Dropped, s.Dropped+s.Delivered, s.Name, s.Policy)
+		}
+	}
+	d.ps.UnsubscribeAll()
 	d.engaged = false
+
+	switch {
+	case err != nil:
+		d.state.move(StateError, err.Error(), StateDisengaging)
+	case cause != nil:
+		d.state.move(StateError, cause.Error(), StateDisengaging)
+	default:
+		d.state.move(StateIdle, "disengaged", StateDisengaging)
+	}
 	return err
 }
 
+// Stop the streamer and disengage the implementation, unless
+// a failed reconnection already has. A streamer that is blocked
+// on the port stops once the port is closed.
+func (d *BaseDevice) stop() (err error) {
+	d.control.cancel()
+	err = d.release()
+	<-d.control.stopped
+	return
+}
+
 func (d *BaseDevice) Engaged() bool {
 	d.Lock()
 	defer d.Unlock()
@@ -238,10 +394,38 @@ func (d *BaseDevice) Subscribe(name string) (chan DataFrame, error) {
 	return d.ps.Subscribe(name)
 }
 
+func (d *BaseDevice) SubscribeWithPolicy(name string, policy DeliveryPolicy) (chan DataFrame, error) {
+	return d.ps.SubscribeWithPolicy(name, policy)
+}
+
+func (d *BaseDevice) Subscriptions() []*SubscriptionStats {
+	return d.ps.Subscriptions()
+}
+
 func (d *BaseDevice) Unsubscribe(name string) {
 	d.ps.Unsubscribe(name)
 }
 
+func (d *BaseDevice) Clock() *ClockEstimate {
+	return d.clock.Estimate()
+}
+
+// Frames that carry both the device and the host clock
+// are rewritten into host time before they are published.
+// The first frame after a reconnection carries a gap event.
 func (d *BaseDevice) publish(df DataFrame) {
+	if cf, ok := df.(ClockedFrame); ok {
+		d.metrics.AddLatency(cf.Generated().UnixNano(), cf.Received().UnixNano())
+		d.clock.Synchronize(cf)
+	}
+	if d.resumed {
+		df = d.markResumption(df)
+	}
+	df = d.addMarks(df)
+	if b := df.Buffer(); b != nil && b.Samples() > 0 {
+		_, d.lastTs = b.Sample(b.Samples() - 1)
+		d.published = true
+		d.metrics.AddFrame(b.Samples())
+	}
 	d.ps.publish(df)
 }
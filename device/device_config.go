@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	"log"
+)
+
+// ----------------------------------------------------------------- //
+// Device Configuration
+// ----------------------------------------------------------------- //
+
+// DeviceConfig holds the settings of a device, which take
+// effect when the device is next engaged. The zero value
+// is the default configuration of every device.
+type DeviceConfig struct {
+	SampleRate int   `json:"sample_rate"` // samples per second, per channel, or 0 for the default
+	Channels   []int `json:"channels"`    // the data channels to stream, counting from 0, or empty for all
+	Trigger    bool  `json:"trigger"`     // whether to stream the trigger channels
+}
+
+// DeviceCapabilities describes the settings that a device
+// supports.
+type DeviceCapabilities struct {
+	SampleRates []int `json:"sample_rates"` // the supported sample rates, the first being the default
+	Channels    int   `json:"channels"`     // the number of data channels
+	Trigger     bool  `json:"trigger"`      // whether the device has trigger channels
+}
+
+// Check that the device supports the configuration.
+func (caps *DeviceCapabilities) Validate(cfg DeviceConfig) error {
+	if cfg.SampleRate != 0 && !containsInt(caps.SampleRates, cfg.SampleRate) {
+		return fmt.Errorf("unsupported sample rate %d, expected one of %v", cfg.SampleRate, caps.SampleRates)
+	}
+	for i, c := range cfg.Channels {
+		if c < 0 || c >= caps.Channels {
+			return fmt.Errorf("no channel %d, expected 0 to %d", c, caps.Channels-1)
+		}
+		if i > 0 && c <= cfg.Channels[i-1] {
+			return fmt.Errorf("channels should be distinct and in order: %v", cfg.Channels)
+		}
+	}
+	if cfg.Trigger && !caps.Trigger {
+		return fmt.Errorf("no trigger channels")
+	}
+	return nil
+}
+
+// The sample rate of the configuration, which is the
+// first supported one by default.
+func (caps *DeviceCapabilities) SampleRate(cfg DeviceConfig) int {
+	if cfg.SampleRate == 0 && len(caps.SampleRates) > 0 {
+		return caps.SampleRates[0]
+	}
+	return cfg.SampleRate
+}
+
+// The data channels of the configuration, which are all
+// of them by default.
+func (caps *DeviceCapabilities) DataChannels(cfg DeviceConfig) []int {
+	if len(cfg.Channels) > 0 {
+		return cfg.Channels
+	}
+	cs := make([]int, caps.Channels)
+	for c := range cs {
+		cs[c] = c
+	}
+	return cs
+}
+
+func containsInt(arr []int, x int) bool {
+	for _, v := range arr {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// Configurable is implemented by the device implementations
+// whose settings can be chosen.
+type Configurable interface {
+	// The settings that the device supports.
+	Capabilities() *DeviceCapabilities
+
+	// Adopt a configuration, which has been validated against
+	// the capabilities, on the next call to Engage().
+	Configure(DeviceConfig) error
+}
+
+// ----------------------------------------------------------------- //
+// Device Methods
+// ----------------------------------------------------------------- //
+
+// The settings that the device supports, or nil if the
+// device cannot be configured.
+func (d *BaseDevice) Capabilities() *DeviceCapabilities {
+	if c, ok := d.deviceImpl.(Configurable); ok {
+		return c.Capabilities()
+	}
+	return nil
+}
+
+// Configure the device, which must not be engaged.
+func (d *BaseDevice) Configure(cfg DeviceConfig) error {
+	d.Lock()
+	defer d.Unlock()
+	c, ok := d.deviceImpl.(Configurable)
+	if !ok {
+		return fmt.Errorf("device cannot be configured")
+	}
+	if d.engaged {
+		return fmt.Errorf("cannot configure an engaged device")
+	}
+	if err := c.Capabilities().Validate(cfg); err != nil {
+		return err
+	}
+	if err := c.Configure(cfg); err != nil {
+		return err
+	}
+	d.config = cfg
+	log.Printf("%s: CONFIG %+v", d.Name(), cfg)
+	return nil
+}
+
+func (d *BaseDevice) Config() DeviceConfig {
+	d.Lock()
+	defer d.Unlock()
+	return d.config
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	"testing"
+)
+
+// A device that takes any configuration that it supports.
+type configurableDevice struct {
+	emptyDevice
+	config *DeviceConfig
+}
+
+func (cd *configurableDevice) Capabilities() *DeviceCapabilities {
+	return &DeviceCapabilities{
+		SampleRates: []int{250, 500},
+		Channels:    4,
+	}
+}
+
+func (cd *configurableDevice) Configure(cfg DeviceConfig) error {
+	cd.config = &cfg
+	return nil
+}
+
+func TestDeviceCapabilities__Validate(t *testing.T) {
+	caps := &DeviceCapabilities{SampleRates: []int{250, 500}, Channels: 4}
+	good := []DeviceConfig{
+		{},
+		{SampleRate: 500},
+		{Channels: []int{0, 3}},
+	}
+	for _, cfg := range good {
+		if err := caps.Validate(cfg); err != nil {
+			t.Errorf("%+v should be valid: %v", cfg, err)
+		}
+	}
+	bad := []DeviceConfig{
+		{SampleRate: 1000},
+		{Channels: []int{4}},
+		{Channels: []int{-1}},
+		{Channels: []int{2, 1}},
+		{Channels: []int{1, 1}},
+		{Trigger: true},
+	}
+	for _, cfg := range bad {
+		if err := caps.Validate(cfg); err == nil {
+			t.Errorf("%+v should be invalid", cfg)
+		}
+	}
+
+	if sr := caps.SampleRate(DeviceConfig{}); sr != 250 {
+		t.Errorf("wrong default sample rate: %d", sr)
+	}
+	if cs := caps.DataChannels(DeviceConfig{}); len(cs) != 4 || cs[3] != 3 {
+		t.Errorf("wrong default channels: %v", cs)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	if err := newEmptyDevice().Configure(DeviceConfig{}); err == nil {
+		t.Errorf("should not configure a device that cannot be configured")
+	}
+
+	impl := &configurableDevice{emptyDevice: emptyDevice{name: "ConfigurableDevice"}}
+	d := NewDevice(impl)
+	if d.Capabilities() == nil {
+		t.Fatalf("expected capabilities")
+	}
+	if err := d.Configure(DeviceConfig{SampleRate: 1000}); err == nil || impl.config != nil {
+		t.Errorf("should not accept an unsupported configuration")
+	}
+
+	cfg := DeviceConfig{SampleRate: 500, Channels: []int{1, 2}}
+	if err := d.Configure(cfg); err != nil {
+		t.Fatalf("could not configure: %v", err)
+	}
+	if impl.config == nil || impl.config.SampleRate != 500 || d.Config().SampleRate != 500 {
+		t.Errorf("the configuration was not adopted")
+	}
+
+	d.Engage(context.Background())
+	defer d.Disengage()
+	if err := d.Configure(DeviceConfig{}); err == nil {
+		t.Errorf("should not configure an engaged device")
+	}
+}
@@ -4,7 +4,10 @@
 package device
 
 import (
+	"context"
 	. "github.com/jbrukh/goavatar/datastruct"
+	"io"
+	"os"
 )
 
 // ----------------------------------------------------------------- //
@@ -13,31 +16,40 @@ import (
 // ----------------------------------------------------------------- //
 
 // Control is a control structure used by client workers
-// that stream data.
+// that stream data. Its context is cancelled when the
+// device disengages.
 type Control struct {
-	done chan bool
-	info chan *DeviceInfo
-	d    *BaseDevice
+	ctx       context.Context
+	cancel    context.CancelFunc
+	info      chan *DeviceInfo
+	stopped   chan bool // closed once the streamer is done
+	err       error     // the last error of the streamer, once it is done
+	d         *BaseDevice
+	handshake *DeviceInfo // the info sent first
 }
 
 // Create a new Control.
 func newControl(d *BaseDevice) *Control {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Control{
-		done: make(chan bool),
-		info: make(chan *DeviceInfo, 1),
-		d:    d,
+		ctx:     ctx,
+		cancel:  cancel,
+		info:    make(chan *DeviceInfo, 1),
+		stopped: make(chan bool),
+		d:       d,
 	}
 }
 
+// The context of the stream, which is done when the
+// Device is calling for streaming operations to stop.
+func (c *Control) Context() context.Context {
+	return c.ctx
+}
+
 // ShouldTerminate returns true if and only if the
 // Device is calling for streaming operations to stop.
 func (c *Control) ShouldTerminate() bool {
-	select {
-	case <-c.done:
-		return true
-	default:
-	}
-	return false
+	return c.ctx.Err() != nil
 }
 
 // The client worker should send data frames to the
@@ -46,8 +58,52 @@ func (c *Control) Send(df DataFrame) {
 	c.d.publish(df)
 }
 
+// The metrics of the device, which the client worker
+// should feed with what it reads and rejects.
+func (c *Control) Metrics() *Metrics {
+	return c.d.metrics
+}
+
 // The client must send DeviceInfo before sending
-// data.
+// data, and again whenever the device reconnects.
 func (c *Control) SendInfo(info *DeviceInfo) {
+	if c.handshake == nil {
+		c.handshake = info
+	}
 	c.info <- info
 }
+
+// ----------------------------------------------------------------- //
+// Ports
+// ----------------------------------------------------------------- //
+
+// OpenPort opens a serial port for reading. Opening the port
+// of a Bluetooth device may block until the device answers, so
+// if the context is done first, OpenPort gives up, and closes
+// the port whenever it does open.
+func OpenPort(ctx context.Context, name string) (io.ReadCloser, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		f, err := os.Open(name)
+		opened <- result{f, err}
+	}()
+
+	select {
+	case r := <-opened:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.f, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-opened; r.err == nil {
+				r.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
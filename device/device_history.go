@@ -0,0 +1,147 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Constants
+// ----------------------------------------------------------------- //
+
+// How much of the stream a device keeps by default, so that
+// recordings may start in the past.
+const DefaultHistory = 30 * time.Second
+
+// ----------------------------------------------------------------- //
+// Frame History -- the most recent frames of the stream
+// ----------------------------------------------------------------- //
+
+// frameHistory is a ring buffer of the most recent frames,
+// which keeps the frames that reach back at least the length
+// of the history from the newest sample. It is not thread-safe;
+// the PubSub guards it.
+type frameHistory struct {
+	length time.Duration
+	frames []DataFrame // ring of the frames, oldest at head
+	head   int
+	n      int
+}
+
+func newFrameHistory(length time.Duration) *frameHistory {
+	return &frameHistory{length: length}
+}
+
+// The newest sample of the history, if any.
+func (h *frameHistory) newest() (ts int64, ok bool) {
+	for i := h.n - 1; i >= 0; i-- {
+		if b := h.at(i).Buffer(); b.Samples() > 0 {
+			_, ts = b.Sample(b.Samples() - 1)
+			return ts, true
+		}
+	}
+	return 0, false
+}
+
+func (h *frameHistory) at(i int) DataFrame {
+	return h.frames[(h.head+i)%len(h.frames)]
+}
+
+// Add a frame, forgetting the frames that are no
+// longer needed.
+func (h *frameHistory) add(df DataFrame) {
+	if h.length <= 0 || df.Buffer() == nil {
+		return
+	}
+
+	// grow the ring, if it is full
+	if h.n == len(h.frames) {
+		frames := make([]DataFrame, 2*len(h.frames)+1)
+		for i := 0; i < h.n; i++ {
+			frames[i] = h.at(i)
+		}
+		h.frames, h.head = frames, 0
+	}
+	h.frames[(h.head+h.n)%len(h.frames)] = df
+	h.n++
+
+	// the oldest frame goes when the next one alone
+	// reaches back far enough
+	ts, ok := h.newest()
+	if !ok {
+		return
+	}
+	cutoff := ts - int64(h.length)
+	for h.n > 1 {
+		b := h.at(1).Buffer()
+		if b.Samples() > 0 && b.Timestamps()[0] > cutoff {
+			break
+		}
+		h.frames[h.head] = nil
+		h.head = (h.head + 1) % len(h.frames)
+		h.n--
+	}
+}
+
+// The frames holding the samples up to pre before the newest
+// one; the oldest frame is cut at the first of those samples.
+func (h *frameHistory) since(pre time.Duration) []DataFrame {
+	ts, ok := h.newest()
+	if !ok || pre <= 0 {
+		return nil
+	}
+	return h.from(ts - int64(pre))
+}
+
+// The frames holding the samples from the cutoff on; the
+// oldest frame is cut at the first of those samples.
+func (h *frameHistory) from(cutoff int64) (frames []DataFrame) {
+	for i := 0; i < h.n; i++ {
+		var (
+			df = h.at(i)
+			b  = df.Buffer()
+			s  = 0
+		)
+		for s < b.Samples() && b.Timestamps()[s] < cutoff {
+			s++
+		}
+		if s == b.Samples() {
+			continue
+		}
+		if s > 0 {
+			df = SliceFrame(df, s, b.Samples())
+		}
+		frames = append(frames, df)
+	}
+	return
+}
+
+func (h *frameHistory) reset() {
+	h.frames, h.head, h.n = nil, 0, 0
+}
+
+// ----------------------------------------------------------------- //
+// Device Methods
+// ----------------------------------------------------------------- //
+
+// Set how much of the stream the device keeps, or 0 to
+// keep none of it.
+func (d *BaseDevice) SetHistory(length time.Duration) {
+	d.ps.SetHistory(length)
+}
+
+// The frames of the last pre of the stream, as far as the
+// history reaches.
+func (d *BaseDevice) History(pre time.Duration) []DataFrame {
+	return d.ps.History(pre)
+}
+
+// Subscribe to device data like SubscribeWithPolicy(), and also
+// return the frames of the last pre of the stream, which come
+// right before the first frame of the subscription.
+func (d *BaseDevice) SubscribeWithHistory(name string, policy DeliveryPolicy, pre time.Duration) (chan DataFrame, []DataFrame, error) {
+	return d.ps.SubscribeWithHistory(name, policy, pre)
+}
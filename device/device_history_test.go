@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"testing"
+	"time"
+)
+
+func TestFrameHistory(t *testing.T) {
+	h := newFrameHistory(10)
+	for k := 0; k < 10; k++ {
+		b := NewBlockBuffer(1, 4)
+		for s := 0; s < 4; s++ {
+			b.AppendSample([]float64{1}, int64(4*k+s))
+		}
+		h.add(NewDataFrame(b, 250))
+	}
+
+	// the frames that reach back 10 from 39
+	if h.n != 3 || h.at(0).Buffer().Timestamps()[0] != 28 {
+		t.Errorf("wrong frames kept: %d", h.n)
+	}
+
+	frames := h.since(5)
+	if len(frames) != 2 {
+		t.Fatalf("wrong number of frames: %d", len(frames))
+	}
+	if ts := frames[0].Buffer().Timestamps(); len(ts) != 2 || ts[0] != 34 {
+		t.Errorf("wrong first frame: %v", ts)
+	}
+	if frames := h.since(0); frames != nil {
+		t.Errorf("expected no frames")
+	}
+
+	h.reset()
+	if frames := h.since(5); frames != nil {
+		t.Errorf("expected no frames")
+	}
+}
+
+func TestRecord__Pre(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+	time.Sleep(50 * time.Millisecond)
+
+	mr := new(memoryRecorder)
+	r := NewDeviceRecorder(d, mr)
+	r.SetPre(20 * time.Millisecond)
+	r.SetMax(5)
+	start := time.Now().UnixNano()
+	if err := r.RecordAsync(); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if _, err := r.Wait(); err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+
+	// the history comes first, without a hole or an overlap
+	ts := mr.timestamps()
+	if len(ts) <= 5 || ts[0] > start-int64(15*time.Millisecond) {
+		t.Errorf("expected the history: %d samples from %d", len(ts), start-ts[0])
+	}
+	for i := 1; i < len(ts); i++ {
+		if ts[i] <= ts[i-1] {
+			t.Errorf("timestamps out of order at %d", i)
+		}
+	}
+	if ts[len(ts)-1] < start {
+		t.Errorf("expected samples after the start")
+	}
+}
@@ -0,0 +1,249 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Constants
+// ----------------------------------------------------------------- //
+
+// Rates are measured over intervals of this length, and are
+// taken to be 0 after two intervals without any frames.
+const MetricsRateInterval = time.Second
+
+// ----------------------------------------------------------------- //
+// Metrics -- the health of the link to a device
+// ----------------------------------------------------------------- //
+
+// Metrics counts what happens on the link to a device since it
+// was engaged. The device counts the frames and samples that it
+// publishes, and the latency of the frames that carry both
+// clocks; the drivers count the bytes that they read and the
+// errors and resynchronizations of their parsers.
+//
+// Metrics is thread-safe.
+type Metrics struct {
+	sync.Mutex
+	metricsState
+}
+
+type metricsState struct {
+	started    time.Time
+	frames     uint64
+	samples    uint64
+	bytesRead  uint64
+	crcErrors  uint64
+	sizeErrors uint64
+	resyncs    uint64
+
+	frameRate  rateMeter
+	sampleRate rateMeter
+
+	// received minus generated, in nanoseconds
+	latency    int64
+	latencySum float64
+	latencyMin int64
+	latencyMax int64
+	latencies  uint64
+}
+
+// MetricsSnapshot holds the values of the Metrics at one time.
+// The latencies are the time between a frame being generated,
+// according to the clock of the device, and it being received,
+// according to the clock of the host, so they include the offset
+// between the clocks; their spread is what varies with the link.
+type MetricsSnapshot struct {
+	UptimeMs      int64   `json:"uptime_ms"`       // time since the device was engaged
+	Frames        uint64  `json:"frames"`          // frames published
+	Samples       uint64  `json:"samples"`         // samples published, per channel
+	BytesRead     uint64  `json:"bytes_read"`      // bytes read from the port
+	CrcErrors     uint64  `json:"crc_errors"`      // frames rejected for their CRC
+	SizeErrors    uint64  `json:"size_errors"`     // frames rejected for their size
+	Resyncs       uint64  `json:"resyncs"`         // times that bytes were skipped to find a frame
+	FrameRate     float64 `json:"frame_rate"`      // frames per second
+	SampleRate    float64 `json:"sample_rate"`     // samples per second, per channel
+	LatencyMs     float64 `json:"latency_ms"`      // latency of the last frame
+	MeanLatencyMs float64 `json:"mean_latency_ms"` // mean latency of the frames
+	MinLatencyMs  float64 `json:"min_latency_ms"`  // lowest latency of the frames
+	MaxLatencyMs  float64 `json:"max_latency_ms"`  // highest latency of the frames
+}
+
+// Create new Metrics, starting now.
+func NewMetrics() *Metrics {
+	m := new(Metrics)
+	m.started = time.Now()
+	return m
+}
+
+// Start counting anew.
+func (m *Metrics) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.metricsState = metricsState{started: time.Now()}
+}
+
+// Count a published frame of the given number of samples.
+func (m *Metrics) AddFrame(samples int) {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	m.frames++
+	m.samples += uint64(samples)
+	m.frameRate.add(now, 1)
+	m.sampleRate.add(now, uint64(samples))
+}
+
+// Record the latency of a frame that was generated and
+// received at the given times, in nanoseconds.
+func (m *Metrics) AddLatency(generated, received int64) {
+	m.Lock()
+	defer m.Unlock()
+	l := received - generated
+	if m.latencies == 0 || l < m.latencyMin {
+		m.latencyMin = l
+	}
+	if m.latencies == 0 || l > m.latencyMax {
+		m.latencyMax = l
+	}
+	m.latency = l
+	m.latencySum += float64(l)
+	m.latencies++
+}
+
+// Count bytes read from the port.
+func (m *Metrics) AddBytes(n int) {
+	m.Lock()
+	defer m.Unlock()
+	m.bytesRead += uint64(n)
+}
+
+// Count a frame that was rejected for its CRC.
+func (m *Metrics) AddCrcError() {
+	m.Lock()
+	defer m.Unlock()
+	m.crcErrors++
+}
+
+// Count a frame that was rejected for its size.
+func (m *Metrics) AddSizeError() {
+	m.Lock()
+	defer m.Unlock()
+	m.sizeErrors++
+}
+
+// Count bytes being skipped to find the next frame.
+func (m *Metrics) AddResync() {
+	m.Lock()
+	defer m.Unlock()
+	m.resyncs++
+}
+
+// CountingReader returns a reader that counts the bytes that
+// are read from r.
+func (m *Metrics) CountingReader(r io.Reader) io.Reader {
+	return &countingReader{r, m}
+}
+
+type countingReader struct {
+	r io.Reader
+	m *Metrics
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.m.AddBytes(n)
+	return
+}
+
+// The current values of the metrics.
+func (m *Metrics) Snapshot() *MetricsSnapshot {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	s := &MetricsSnapshot{
+		UptimeMs:   int64(now.Sub(m.started) / time.Millisecond),
+		Frames:     m.frames,
+		Samples:    m.samples,
+		BytesRead:  m.bytesRead,
+		CrcErrors:  m.crcErrors,
+		SizeErrors: m.sizeErrors,
+		Resyncs:    m.resyncs,
+		FrameRate:  m.frameRate.current(now),
+		SampleRate: m.sampleRate.current(now),
+	}
+	if m.latencies > 0 {
+		s.LatencyMs = nanosToMs(float64(m.latency))
+		s.MeanLatencyMs = nanosToMs(m.latencySum / float64(m.latencies))
+		s.MinLatencyMs = nanosToMs(float64(m.latencyMin))
+		s.MaxLatencyMs = nanosToMs(float64(m.latencyMax))
+	}
+	return s
+}
+
+func nanosToMs(ns float64) float64 {
+	return math.Floor(ns/1e3+0.5) / 1e3
+}
+
+// Write the metrics as text, one "name value" pair per line.
+func (s *MetricsSnapshot) WriteText(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, `uptime_ms %d
+frames %d
+samples %d
+bytes_read %d
+crc_errors %d
+size_errors %d
+resyncs %d
+frame_rate %g
+sample_rate %g
+latency_ms %g
+mean_latency_ms %g
+min_latency_ms %g
+max_latency_ms %g
+`,
+		s.UptimeMs, s.Frames, s.Samples, s.BytesRead, s.CrcErrors, s.SizeErrors, s.Resyncs,
+		s.FrameRate, s.SampleRate, s.LatencyMs, s.MeanLatencyMs, s.MinLatencyMs, s.MaxLatencyMs)
+	return
+}
+
+// A rateMeter measures a rate over successive intervals.
+type rateMeter struct {
+	start time.Time // start of the current interval
+	count uint64    // count during the current interval
+	rate  float64   // rate during the last complete interval
+}
+
+func (rm *rateMeter) add(now time.Time, n uint64) {
+	if rm.start.IsZero() {
+		rm.start = now
+	}
+	rm.count += n
+	if elapsed := now.Sub(rm.start); elapsed >= MetricsRateInterval {
+		rm.rate = float64(rm.count) / elapsed.Seconds()
+		rm.start, rm.count = now, 0
+	}
+}
+
+func (rm *rateMeter) current(now time.Time) float64 {
+	if rm.start.IsZero() || now.Sub(rm.start) >= 2*MetricsRateInterval {
+		return 0
+	}
+	return rm.rate
+}
+
+// ----------------------------------------------------------------- //
+// Device Methods
+// ----------------------------------------------------------------- //
+
+// The current metrics of the link to the device, since
+// it was last engaged.
+func (d *BaseDevice) Metrics() *MetricsSnapshot {
+	return d.metrics.Snapshot()
+}
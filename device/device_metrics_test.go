@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.AddFrame(16)
+	m.AddFrame(16)
+	m.AddLatency(0, 2e6)
+	m.AddLatency(0, 4e6)
+	m.AddCrcError()
+	m.AddResync()
+	ioutil.ReadAll(m.CountingReader(strings.NewReader("twelve bytes")))
+
+	s := m.Snapshot()
+	if s.Frames != 2 || s.Samples != 32 || s.BytesRead != 12 {
+		t.Errorf("wrong counts: %+v", s)
+	}
+	if s.CrcErrors != 1 || s.SizeErrors != 0 || s.Resyncs != 1 {
+		t.Errorf("wrong errors: %+v", s)
+	}
+	if s.LatencyMs != 4 || s.MeanLatencyMs != 3 || s.MinLatencyMs != 2 || s.MaxLatencyMs != 4 {
+		t.Errorf("wrong latencies: %+v", s)
+	}
+
+	var buf bytes.Buffer
+	s.WriteText(&buf)
+	if !strings.Contains(buf.String(), "\ncrc_errors 1\n") {
+		t.Errorf("wrong text: %s", buf.String())
+	}
+
+	m.Reset()
+	if s := m.Snapshot(); s.Frames != 0 || s.LatencyMs != 0 {
+		t.Errorf("expected no metrics: %+v", s)
+	}
+}
+
+func TestMetrics__Rates(t *testing.T) {
+	var (
+		rm  rateMeter
+		now = time.Now()
+	)
+	for i := 0; i <= 10; i++ {
+		rm.add(now.Add(time.Duration(i)*MetricsRateInterval/10), 5)
+	}
+	if r := rm.current(now.Add(MetricsRateInterval)); r != 55 {
+		t.Errorf("wrong rate: %v", r)
+	}
+	if r := rm.current(now.Add(3 * MetricsRateInterval)); r != 0 {
+		t.Errorf("expected no rate: %v", r)
+	}
+}
+
+func TestMetrics__Device(t *testing.T) {
+	d := newEmptyDevice()
+	out, _ := d.Subscribe("test")
+	d.Engage(context.Background())
+	for i := 0; i < 10; i++ {
+		<-out
+	}
+	d.Disengage()
+	drain(out)
+	if s := d.Metrics(); s.Frames < 10 || s.Samples != s.Frames {
+		t.Errorf("wrong metrics: %+v", s)
+	}
+}
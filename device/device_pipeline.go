@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"log"
+)
+
+// ----------------------------------------------------------------- //
+// Processors -- stateful DataFrame transformations
+// ----------------------------------------------------------------- //
+
+// Processor transforms a stream of DataFrames one frame at a
+// time, like a filter, a montage or a channel selection. Its
+// state carries across frames. Frames are shared between the
+// subscribers of a device, so a Processor must not change the
+// frames that it is given.
+type Processor interface {
+	// Process the frame, returning a new one, or nil if there
+	// is nothing to pass on yet.
+	Process(df DataFrame) DataFrame
+
+	// Forget the state of the processor, for instance when
+	// the stream is discontinuous.
+	Reset()
+}
+
+// ProcessorFunc makes a Processor of a function, whose
+// state, if any, is never reset.
+type ProcessorFunc func(df DataFrame) DataFrame
+
+func (f ProcessorFunc) Process(df DataFrame) DataFrame {
+	return f(df)
+}
+
+func (f ProcessorFunc) Reset() {}
+
+// ----------------------------------------------------------------- //
+// Pipelines
+// ----------------------------------------------------------------- //
+
+// A Pipeline applies its processors one after another. A
+// frame that a processor holds back goes no further.
+type Pipeline []Processor
+
+// Create a new pipeline.
+func NewPipeline(ps ...Processor) Pipeline {
+	return Pipeline(ps)
+}
+
+// Then returns the pipeline followed by the given processors,
+// for building pipelines step by step:
+//
+//	p := NewPipeline(filter).Then(montage, selector)
+func (p Pipeline) Then(ps ...Processor) Pipeline {
+	out := make(Pipeline, 0, len(p)+len(ps))
+	out = append(out, p...)
+	return append(out, ps...)
+}
+
+func (p Pipeline) Process(df DataFrame) DataFrame {
+	for _, proc := range p {
+		if df = proc.Process(df); df == nil {
+			return nil
+		}
+	}
+	return df
+}
+
+func (p Pipeline) Reset() {
+	for _, proc := range p {
+		proc.Reset()
+	}
+}
+
+// ----------------------------------------------------------------- //
+// Channel Selection
+// ----------------------------------------------------------------- //
+
+// ChannelSelector is a Processor that keeps some of the channels
+// of the frames, in the given order, along with their counts and
+// descriptions.
+type ChannelSelector struct {
+	channels []int
+}
+
+// Create a new ChannelSelector of the given channels, counting
+// from 0.
+func NewChannelSelector(cs ...int) *ChannelSelector {
+	for _, c := range cs {
+		if c < 0 {
+			panic(fmt.Sprintf("bad channel: %d", c))
+		}
+	}
+	return &ChannelSelector{channels: cs}
+}
+
+// Frames that lack any of the channels are dropped.
+func (cs *ChannelSelector) Process(df DataFrame) DataFrame {
+	b := df.Buffer()
+	for _, c := range cs.channels {
+		if c >= b.Channels() {
+			log.Printf("dropping a frame without channel %d", c)
+			return nil
+		}
+	}
+
+	var infos []*ChannelInfo
+	if in := df.ChannelInfos(); in != nil {
+		infos = make([]*ChannelInfo, len(cs.channels))
+		for i, c := range cs.channels {
+			infos[i] = in[c]
+		}
+	}
+
+	var ints *IntBuffer
+	if in := df.Ints(); in != nil {
+		ints = NewIntBuffer(len(cs.channels), in.Samples()+1)
+		q := make([]int64, len(cs.channels))
+		for s := 0; s < in.Samples(); s++ {
+			v := in.Sample(s)
+			for i, c := range cs.channels {
+				q[i] = v[c]
+			}
+			ints.AppendSample(q)
+		}
+	}
+
+	bb := b.SelectChannels(cs.channels...)
+	return NewDataFrameWithInts(bb, ints, df.SampleRate(), infos, df.Events())
+}
+
+func (cs *ChannelSelector) Reset() {}
+
+// ----------------------------------------------------------------- //
+// Processed Subscriptions
+// ----------------------------------------------------------------- //
+
+// SubscribeProcessed subscribes to the device under the given name
+// and delivery policy, and returns a channel of the frames that come
+// out of the processor. The channel is closed when the subscription
+// ends. The processor should not be shared with other subscriptions.
+func (d *BaseDevice) SubscribeProcessed(name string, policy DeliveryPolicy, p Processor) (chan DataFrame, error) {
+	in, err := d.SubscribeWithPolicy(name, policy)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan DataFrame, DataFrameBufferSize)
+	go func() {
+		defer close(out)
+		for df := range in {
+			if df = p.Process(df); df != nil {
+				out <- df
+			}
+		}
+		log.Printf("processed subscription '%s' closed", name)
+	}()
+	return out, nil
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"testing"
+)
+
+// Doubles the values of the frames.
+var doubler = ProcessorFunc(func(df DataFrame) DataFrame {
+	b := df.Buffer()
+	bb := NewBlockBuffer(b.Channels(), b.Samples()+1)
+	for s := 0; s < b.Samples(); s++ {
+		v, ts := b.Sample(s)
+		vv := make([]float64, len(v))
+		for c := range v {
+			vv[c] = 2 * v[c]
+		}
+		bb.AppendSample(vv, ts)
+	}
+	return NewDataFrameWithEvents(bb, df.SampleRate(), df.ChannelInfos(), df.Events())
+})
+
+func TestPipeline(t *testing.T) {
+	b := NewBlockBuffer(3, 2)
+	b.AppendSample([]float64{1, 2, 3}, 10)
+	b.AppendSample([]float64{4, 5, 6}, 20)
+	ints := NewIntBuffer(3, 2)
+	ints.AppendSample([]int64{1, 2, 3})
+	ints.AppendSample([]int64{4, 5, 6})
+	df := NewDataFrameWithInts(b, ints, 250, EEGChannelInfos(3, "V", 1), nil)
+
+	p := NewPipeline(NewChannelSelector(2, 0)).Then(doubler)
+	out := p.Process(df)
+	if out.Buffer().Channels() != 2 || out.SampleRate() != 250 {
+		t.Fatalf("wrong frame: %v", out.Buffer())
+	}
+	if v, ts := out.Buffer().Sample(1); v[0] != 12 || v[1] != 8 || ts != 20 {
+		t.Errorf("wrong sample: %v %d", v, ts)
+	}
+	if infos := out.ChannelInfos(); infos[0].Label != "Ch3" || infos[1].Label != "Ch1" {
+		t.Errorf("wrong channels: %v", infos)
+	}
+	if v, _ := df.Buffer().Sample(1); v[0] != 4 {
+		t.Errorf("the frame should not change: %v", v)
+	}
+
+	// the selector keeps the counts, which the doubler drops
+	if q := NewChannelSelector(2, 0).Process(df).Ints().Sample(0); q[0] != 3 || q[1] != 1 {
+		t.Errorf("wrong counts: %v", q)
+	}
+
+	// frames that are held back go no further
+	if out := p.Then(NewChannelSelector(3)).Process(df); out != nil {
+		t.Errorf("expected no frame")
+	}
+}
+
+func TestSubscribeProcessed(t *testing.T) {
+	d := newEmptyDevice()
+	raw, _ := d.Subscribe("raw")
+	doubled, err := d.SubscribeProcessed("doubled", DeliverBlock, doubler)
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	d.Engage(context.Background())
+
+	if v, _ := (<-raw).Buffer().Sample(0); v[0] != 42 {
+		t.Errorf("wrong raw value: %v", v)
+	}
+	if v, _ := (<-doubled).Buffer().Sample(0); v[0] != 84 {
+		t.Errorf("wrong processed value: %v", v)
+	}
+
+	d.Disengage()
+	drain(raw)
+	if _, ok := <-drain(doubled); ok {
+		t.Errorf("expected the subscription to close")
+	}
+}
@@ -7,35 +7,115 @@ import (
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	"log"
+	"sort"
 	"sync"
+	"time"
 )
 
+// ----------------------------------------------------------------- //
+// Delivery Policies
+// ----------------------------------------------------------------- //
+
+// DeliveryPolicy says what the PubSub does when a subscriber
+// has fallen so far behind that its channel is full.
+type DeliveryPolicy int
+
+const (
+	DeliverBlock      DeliveryPolicy = iota // wait for the subscriber, holding up everyone
+	DeliverDropNewest                       // drop the frame being published
+	DeliverDropOldest                       // drop the oldest frame in the channel
+	DeliverDisconnect                       // unsubscribe the subscriber, closing its channel
+)
+
+var deliveryPolicyNames = []string{"block", "drop-newest", "drop-oldest", "disconnect"}
+
+func (p DeliveryPolicy) String() string {
+	if p < 0 || int(p) >= len(deliveryPolicyNames) {
+		return fmt.Sprintf("DeliveryPolicy(%d)", int(p))
+	}
+	return deliveryPolicyNames[p]
+}
+
+// SubscriptionStats holds the counters of a subscription.
+type SubscriptionStats struct {
+	Name      string         // name of the subscription
+	Policy    DeliveryPolicy // what happens when the subscriber is slow
+	Delivered uint64         // frames put on the channel
+	Dropped   uint64         // frames lost to the policy
+	Queued    int            // frames on the channel, not yet taken
+}
+
+// ----------------------------------------------------------------- //
+// PubSub
+// ----------------------------------------------------------------- //
+
 // PubSub is a thread-safe publisher-subscriber. It is
 // used by Devices to stream data frames to interested
 // parties (streamers and recorders).
+//
+// Every subscription has a DeliveryPolicy. Frames are
+// published while holding the lock, so a blocking subscriber
+// that falls behind holds up the device and every other
+// subscriber; subscribers that can afford to lose data, like
+// displays, should not block.
 type PubSub struct {
 	sync.Mutex
-	subs map[string]chan DataFrame
+	subs    map[string]*subscription
+	history *frameHistory // the most recent frames
+}
+
+type subscription struct {
+	out       chan DataFrame
+	policy    DeliveryPolicy
+	delivered uint64
+	dropped   uint64
 }
 
 // Create a new PubSub.
 func NewPubSub() *PubSub {
 	return &PubSub{
-		subs: make(map[string]chan DataFrame),
+		subs:    make(map[string]*subscription),
+		history: newFrameHistory(0),
 	}
 }
 
 // Subscribe to this PubSub with the given name. The data
-// channel will be returned.
+// channel will be returned. The subscription blocks when
+// the subscriber is slow, so it never loses data.
 func (ps *PubSub) Subscribe(name string) (out chan DataFrame, err error) {
+	return ps.SubscribeWithPolicy(name, DeliverBlock)
+}
+
+// Subscribe to this PubSub with the given name and delivery
+// policy. The data channel will be returned.
+func (ps *PubSub) SubscribeWithPolicy(name string, policy DeliveryPolicy) (out chan DataFrame, err error) {
 	ps.Lock()
 	defer ps.Unlock()
+	return ps.subscribe(name, policy)
+}
+
+// Subscribe like SubscribeWithPolicy(), and also return the
+// frames of the last pre of the history, so that the subscriber
+// gets the stream without a hole or an overlap.
+func (ps *PubSub) SubscribeWithHistory(name string, policy DeliveryPolicy, pre time.Duration) (out chan DataFrame, history []DataFrame, err error) {
+	ps.Lock()
+	defer ps.Unlock()
+	if out, err = ps.subscribe(name, policy); err != nil {
+		return
+	}
+	return out, ps.history.since(pre), nil
+}
+
+func (ps *PubSub) subscribe(name string, policy DeliveryPolicy) (out chan DataFrame, err error) {
 	if _, ok := ps.subs[name]; ok {
 		log.Printf("subscription '%s' already exists", name)
 		return nil, fmt.Errorf("subscription already exists")
 	}
 	out = make(chan DataFrame, DataFrameBufferSize)
-	ps.subs[name] = out
+	ps.subs[name] = &subscription{
+		out:    out,
+		policy: policy,
+	}
 	return
 }
 
@@ -48,8 +128,8 @@ func (ps *PubSub) Unsubscribe(name string) {
 }
 
 func (ps *PubSub) unsubscribe(name string) {
-	if out, ok := ps.subs[name]; ok {
-		close(out)
+	if sub, ok := ps.subs[name]; ok {
+		close(sub.out)
 	}
 	delete(ps.subs, name)
 }
@@ -58,16 +138,94 @@ func (ps *PubSub) unsubscribe(name string) {
 func (ps *PubSub) UnsubscribeAll() {
 	ps.Lock()
 	defer ps.Unlock()
-	for name, out := range ps.subs {
-		close(out)
+	for name, sub := range ps.subs {
+		close(sub.out)
 		delete(ps.subs, name)
 	}
 }
 
+// The frames of the last pre of the history.
+func (ps *PubSub) History(pre time.Duration) []DataFrame {
+	ps.Lock()
+	defer ps.Unlock()
+	return ps.history.since(pre)
+}
+
+// Keep the given length of the stream, forgetting
+// what is kept so far.
+func (ps *PubSub) SetHistory(length time.Duration) {
+	ps.Lock()
+	defer ps.Unlock()
+	ps.history = newFrameHistory(length)
+}
+
+func (ps *PubSub) resetHistory() {
+	ps.Lock()
+	defer ps.Unlock()
+	ps.history.reset()
+}
+
+// The counters of every subscription, ordered by name.
+func (ps *PubSub) Subscriptions() []*SubscriptionStats {
+	ps.Lock()
+	defer ps.Unlock()
+	stats := make([]*SubscriptionStats, 0, len(ps.subs))
+	for name, sub := range ps.subs {
+		stats = append(stats, &SubscriptionStats{
+			Name:      name,
+			Policy:    sub.policy,
+			Delivered: sub.delivered,
+			Dropped:   sub.dropped,
+			Queued:    len(sub.out),
+		})
+	}
+	sort.Sort(subscriptionsByName(stats))
+	return stats
+}
+
+type subscriptionsByName []*SubscriptionStats
+
+func (s subscriptionsByName) Len() int           { return len(s) }
+func (s subscriptionsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s subscriptionsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func (ps *PubSub) publish(df DataFrame) {
 	ps.Lock()
 	defer ps.Unlock()
-	for _, v := range ps.subs {
-		v <- df
+	ps.history.add(df)
+	for name, sub := range ps.subs {
+		if sub.policy == DeliverBlock {
+			sub.out <- df
+			sub.delivered++
+			continue
+		}
+
+		// the subscriber is keeping up
+		select {
+		case sub.out <- df:
+			sub.delivered++
+			continue
+		default:
+		}
+
+		// the subscriber is behind
+		switch sub.policy {
+		case DeliverDropNewest:
+			sub.dropped++
+		case DeliverDropOldest:
+			// only we send on the channel, so once a
+			// frame is taken out there is room
+			select {
+			case <-sub.out:
+				sub.dropped++
+			default:
+			}
+			sub.out <- df
+			sub.delivered++
+		case DeliverDisconnect:
+			log.Printf("subscription '%s' is too slow, disconnecting", name)
+			sub.dropped++
+			ps.unsubscribe(name)
+		}
 	}
 }
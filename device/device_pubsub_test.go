@@ -115,3 +115,54 @@ func TestPubSub__UnsubscribeAll(t *testing.T) {
 		ensureClosed(t, v)
 	}
 }
+
+func TestPubSub__Policies(t *testing.T) {
+	ps := NewPubSub()
+	newest, _ := ps.SubscribeWithPolicy("newest", DeliverDropNewest)
+	oldest, _ := ps.SubscribeWithPolicy("oldest", DeliverDropOldest)
+	slow, _ := ps.SubscribeWithPolicy("slow", DeliverDisconnect)
+
+	// nobody reads, so every channel fills up
+	frames := make([]DataFrame, DataFrameBufferSize+2)
+	for i := range frames {
+		frames[i] = &MockFrame{}
+		ps.publish(frames[i])
+	}
+
+	stats := ps.Subscriptions()
+	if len(stats) != 2 || stats[0].Name != "newest" || stats[1].Name != "oldest" {
+		t.Fatalf("expected the slow subscriber to be gone: %v", stats)
+	}
+	if s := stats[0]; s.Policy != DeliverDropNewest || s.Delivered != DataFrameBufferSize ||
+		s.Dropped != 2 || s.Queued != DataFrameBufferSize {
+		t.Errorf("wrong counters: %+v", s)
+	}
+	if s := stats[1]; s.Policy != DeliverDropOldest || s.Delivered != DataFrameBufferSize+2 ||
+		s.Dropped != 2 || s.Queued != DataFrameBufferSize {
+		t.Errorf("wrong counters: %+v", s)
+	}
+
+	if df := <-newest; df != frames[0] {
+		t.Errorf("expected the first frame to be kept")
+	}
+	if df := <-oldest; df != frames[2] {
+		t.Errorf("expected the first frames to be dropped")
+	}
+	for i := 0; i < DataFrameBufferSize; i++ {
+		if _, ok := <-slow; !ok {
+			t.Fatalf("expected the queued frames before closing")
+		}
+	}
+	if _, ok := <-slow; ok {
+		t.Errorf("expected the slow subscriber to be closed")
+	}
+}
+
+func TestDeliveryPolicy__String(t *testing.T) {
+	if s := DeliverDropOldest.String(); s != "drop-oldest" {
+		t.Errorf("wrong name: %s", s)
+	}
+	if s := DeliveryPolicy(9).String(); s != "DeliveryPolicy(9)" {
+		t.Errorf("wrong name: %s", s)
+	}
+}
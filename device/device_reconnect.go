@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"log"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Reconnect Policies
+// ----------------------------------------------------------------- //
+
+// ReconnectPolicy says how a device engages again after its
+// stream fails. The delay before each attempt grows by the
+// multiplier, up to the maximum delay.
+type ReconnectPolicy struct {
+	Attempts   int           // attempts before giving up, or 0 to never give up
+	Delay      time.Duration // delay before the first attempt
+	MaxDelay   time.Duration // longest delay between attempts, or 0 for no limit
+	Multiplier float64       // growth of the delay after every attempt
+}
+
+// The default policy never gives up, waiting half a second
+// at first and doubling the delay up to half a minute.
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		Attempts:   0,
+		Delay:      500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+		Multiplier: 2,
+	}
+}
+
+// The delay before the given attempt, counting from 1.
+func (p *ReconnectPolicy) Backoff(attempt int) time.Duration {
+	delay := float64(p.Delay)
+	for i := 1; i < attempt; i++ {
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+		delay *= p.Multiplier
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// ----------------------------------------------------------------- //
+// Reconnection
+// ----------------------------------------------------------------- //
+
+// The state of reconnection has its own lock, because the
+// implementation is engaged and disengaged both by the device,
+// under its lock, and by the streamer, which reconnects.
+type reconnector struct {
+	sync.Mutex
+	policy   *ReconnectPolicy
+	released bool // whether the implementation is disengaged
+}
+
+// Prepare for a new engagement.
+func (r *reconnector) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.released = false
+}
+
+// Engage the implementation, unless it is already.
+func (d *BaseDevice) renew(ctx context.Context) error {
+	d.rc.Lock()
+	defer d.rc.Unlock()
+	if !d.rc.released {
+		return nil
+	}
+	if err := d.deviceImpl.Engage(ctx); err != nil {
+		return err
+	}
+	d.rc.released = false
+	return nil
+}
+
+// Disengage the implementation, unless it is already.
+func (d *BaseDevice) release() error {
+	d.rc.Lock()
+	defer d.rc.Unlock()
+	if d.rc.released {
+		return nil
+	}
+	d.rc.released = true
+	return d.deviceImpl.Disengage()
+}
+
+// Set the policy for reconnecting after the stream fails,
+// or nil to disengage instead, which is the default.
+func (d *BaseDevice) SetReconnectPolicy(p *ReconnectPolicy) {
+	d.rc.Lock()
+	defer d.rc.Unlock()
+	d.rc.policy = p
+}
+
+// Engage the implementation again after its stream failed
+// because of the cause, according to the policy, and replay
+// the handshake. The
+// subscriptions are left alone. Returns the channel on which
+// the new stream will report its exit, or nil if the device
+// should disengage, because there is no policy, because the
+// attempts ran out, or because it was told to.
+func (d *BaseDevice) reconnect(c *Control, cause error) <-chan error {
+	d.rc.Lock()
+	p := d.rc.policy
+	d.rc.Unlock()
+	if p == nil {
+		return nil
+	}
+
+	d.state.move(StateReconnecting, cause.Error(), StateEngaging, StateStreaming)
+	if err := d.release(); err != nil {
+		log.Printf("error on disengage: %v", err)
+	}
+
+	for attempt := 1; p.Attempts == 0 || attempt <= p.Attempts; attempt++ {
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-time.After(p.Backoff(attempt)):
+		}
+
+		log.Printf("%s: RECONNECT (attempt %d)", d.Name(), attempt)
+		errc, err := d.resume(c)
+		if err == nil {
+			d.state.move(StateStreaming, "reconnected", StateReconnecting)
+			return errc
+		}
+		log.Printf("%s: could not reconnect: %v", d.Name(), err)
+		if c.ShouldTerminate() {
+			return nil
+		}
+	}
+	log.Printf("%s: RECONNECT gave up after %d attempts", d.Name(), p.Attempts)
+	return nil
+}
+
+// Engage the implementation and replay the handshake, within
+// the engage timeout. On success, returns the channel on which
+// the new stream will report its exit; otherwise, leaves the
+// implementation disengaged.
+func (d *BaseDevice) resume(c *Control) (<-chan error, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, DefaultEngageTimeout)
+	defer cancel()
+	if err := d.renew(ctx); err != nil {
+		return nil, err
+	}
+
+	// the device clock may have been reset, and the
+	// next frame is marked as following a gap
+	d.clock.Reset()
+	d.resumed = d.published
+
+	// an info left over from a failed attempt is not
+	// the handshake of this stream
+	select {
+	case <-c.info:
+	default:
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.deviceImpl.Stream(c)
+	}()
+
+	var err error
+	select {
+	case info := <-c.info:
+		if err = checkInfo(c.handshake, info); err == nil {
+			log.Printf("%s: DEVICE INFO %+v", d.Name(), info)
+			return errc, nil
+		}
+	case err = <-errc:
+		err = fmt.Errorf("stream ended before the device info: %v", err)
+	case <-ctx.Done():
+		err = fmt.Errorf("no device info: %v", ctx.Err())
+	}
+
+	// a stream blocked on the port stops once it is closed
+	if e := d.release(); e != nil {
+		log.Printf("error on disengage: %v", e)
+	}
+	select {
+	case <-errc:
+	case <-c.ctx.Done():
+	}
+	return nil, err
+}
+
+// Subscribers can only carry on if the device streams
+// the same channels at the same rate.
+func checkInfo(expected, info *DeviceInfo) error {
+	if expected == nil || info == nil {
+		return fmt.Errorf("missing device info")
+	}
+	if info.Channels != expected.Channels || info.SampleRate != expected.SampleRate {
+		return fmt.Errorf("device info changed from %+v to %+v", expected, info)
+	}
+	return nil
+}
+
+// Mark the discontinuity between the last sample published
+// before the reconnection and the first sample of the frame
+// with a gap event.
+func (d *BaseDevice) markResumption(df DataFrame) DataFrame {
+	b := df.Buffer()
+	if b == nil || b.Samples() == 0 || df.SampleRate() < 1 {
+		return df
+	}
+	d.resumed = false
+
+	var (
+		_, first = b.Sample(0)
+		period   = int64(time.Second) / int64(df.SampleRate())
+		missing  = int((first-d.lastTs+period/2)/period) - 1
+	)
+	if missing < 0 {
+		missing = 0
+	}
+	events := []*Event{NewGapEvent(d.lastTs, missing, period, d.Name(), "reconnected")}
+	events = append(events, df.Events()...)
+	SortEvents(events)
+	return NewDataFrameWithInts(b, df.Ints(), df.SampleRate(), df.ChannelInfos(), events)
+}
@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"testing"
+	"time"
+)
+
+const flakyRate = 250
+
+// A device whose stream fails after a few samples, the
+// given number of times, and whose first attempt to engage
+// again fails too.
+type flakyDevice struct {
+	emptyDevice
+	failures int // streams left to fail
+	engages  int // calls to Engage()
+	sample   int // samples, sent or lost
+}
+
+func (fd *flakyDevice) Engage(ctx context.Context) error {
+	fd.engages++
+	if fd.engages == 2 {
+		return fmt.Errorf("not yet")
+	}
+	return nil
+}
+
+func (fd *flakyDevice) Stream(c *Control) (err error) {
+	c.SendInfo(&DeviceInfo{
+		Channels:   1,
+		SampleRate: flakyRate,
+	})
+	for i := 0; !c.ShouldTerminate(); i++ {
+		if fd.failures > 0 && i == 10 {
+			// samples are lost while the device is away
+			fd.failures--
+			fd.sample += 10
+			return fmt.Errorf("flaky device is flaky")
+		}
+		b := NewBlockBuffer(1, 1)
+		b.AppendSample([]float64{42}, int64(fd.sample)*int64(time.Second)/flakyRate)
+		fd.sample++
+		c.Send(NewDataFrame(b, flakyRate))
+		time.Sleep(time.Millisecond)
+	}
+	return
+}
+
+func TestReconnectPolicy__Backoff(t *testing.T) {
+	p := &ReconnectPolicy{Delay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, x := range expected {
+		if d := p.Backoff(i + 1); d != x {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, x, d)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	d := NewDevice(&flakyDevice{failures: 1})
+	d.SetReconnectPolicy(&ReconnectPolicy{Delay: time.Millisecond, Multiplier: 1})
+	if err := d.Engage(context.Background()); err != nil {
+		t.Fatalf("could not engage: %v", err)
+	}
+	out, err := d.Subscribe("test")
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	// the subscription lives through the reconnection
+	var gap *Event
+	for i := 0; i < 20; i++ {
+		df := <-out
+		if len(df.Events()) > 0 {
+			gap = df.Events()[0]
+			if _, ts := df.Buffer().Sample(0); ts != 20*int64(time.Second)/flakyRate {
+				t.Errorf("wrong first sample: %d", ts)
+			}
+		}
+	}
+	if gap == nil {
+		t.Fatalf("expected a gap event")
+	}
+	if gap.Code != EventGap || gap.Timestamp != 10*int64(time.Second)/flakyRate ||
+		gap.Duration != 10*int64(time.Second)/flakyRate {
+		t.Errorf("wrong gap: %+v", gap)
+	}
+	if !d.Engaged() || d.State() != StateStreaming {
+		t.Errorf("expected the device to be streaming")
+	}
+
+	d.Disengage()
+	if _, ok := <-drain(out); ok {
+		t.Errorf("expected the subscription to close")
+	}
+}
+
+func TestReconnect__GiveUp(t *testing.T) {
+	d := NewDevice(&flakyDevice{failures: 2})
+	d.SetReconnectPolicy(&ReconnectPolicy{Attempts: 1, Delay: time.Millisecond})
+	out, _ := d.Subscribe("test")
+	if err := d.Engage(context.Background()); err != nil {
+		t.Fatalf("could not engage: %v", err)
+	}
+	if _, ok := <-drain(out); ok {
+		t.Errorf("expected the subscription to close")
+	}
+	if d.Engaged() {
+		t.Errorf("expected the device to disengage")
+	}
+}
+
+func TestReconnect__StaleInfo(t *testing.T) {
+	var (
+		d    = NewDevice(&emptyDevice{name: "SilentDevice", silent: true}).(*BaseDevice)
+		c    = newControl(d)
+		info = &DeviceInfo{Channels: 1, SampleRate: 250}
+	)
+	c.handshake = info
+	d.rc.released = true
+
+	// a failed attempt left its info behind, but this
+	// stream never sends one
+	c.info <- info
+	time.AfterFunc(50*time.Millisecond, c.cancel)
+	if _, err := d.resume(c); err == nil {
+		t.Errorf("should not resume on the info of another stream")
+	}
+}
+
+// Read the channel until it closes, and return it.
+func drain(out chan DataFrame) chan DataFrame {
+	for _ = range out {
+	}
+	return out
+}
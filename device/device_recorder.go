@@ -7,11 +7,20 @@ import (
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	"log"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// The subscriptions of the recorders of a device are named
+// after this prefix and a number, so that a device can have
+// several recorders at once.
 const RecorderName = "recorder"
 
+// the number of recorders created so far
+var recorders uint64
+
 // A real-time recorder of dataframes. This recorder
 // should support calling the given methods in the
 // given order: Init, RecordFrame (multiple times),
@@ -24,9 +33,17 @@ type Recorder interface {
 	// return the recording length, since
 	// the last time Init() was called
 	Stats() (ms uint32)
+
+	// Pause the recording after the last frame, and mark
+	// the pause, so that the recording continues as one
+	// resource with a jump of its timestamps when Resume()
+	// is called. No frames are recorded in between.
+	Pause() error
+	Resume() error
 }
 
 type RecordingInfo struct {
+	RecorderId string
 	ResourceId string
 	DurationMs uint32
 }
@@ -35,21 +52,42 @@ type RecordingInfo struct {
 // operates on a device and a Recorder implementation.
 type DeviceRecorder struct {
 	sync.Mutex
+	id        string // the name of the subscription
 	device    Device
 	r         Recorder
 	cerr      chan error
 	recording bool
-	max       int // max samples
+	paused    bool // frames are not being recorded for now
+	max       int  // max samples
+
+	processor Processor     // the view of the stream to record, if not the raw one
+	pre       time.Duration // how much of the history of the device to record first
+
+	// arming: when to start and stop recording, and
+	// whether the recording is waiting for its start
+	start Trigger
+	stop  Trigger
+	post  time.Duration
+	armed bool
 }
 
-// Create a new DeviceRecorder.
+// Create a new DeviceRecorder, which records independently
+// of the other recorders of the device.
 func NewDeviceRecorder(device Device, r Recorder) *DeviceRecorder {
+	n := atomic.AddUint64(&recorders, 1)
 	return &DeviceRecorder{
+		id:     fmt.Sprintf("%s-%d", RecorderName, n),
 		device: device,
 		r:      r,
 	}
 }
 
+// The id of the recorder, which is unique within the
+// process, and names its subscription to the device.
+func (d *DeviceRecorder) Id() string {
+	return d.id
+}
+
 // Set the maximum number of samples that the recorder will
 // read. If this number is set to 0 (default), the recorder
 // will record indefinitely until such time that Stop() is
@@ -62,6 +100,39 @@ func (d *DeviceRecorder) SetMax(max int) {
 	}
 }
 
+// Set how much of the stream before the start of the next
+// recording to record, as far as the history of the device
+// reaches (see Device.SetHistory()). The history does not
+// count towards the maximum of SetMax().
+func (d *DeviceRecorder) SetPre(pre time.Duration) {
+	d.Lock()
+	defer d.Unlock()
+	d.pre = pre
+}
+
+// Set the processor of the frames before they are recorded,
+// or nil to record the frames of the device. It takes effect
+// when the next recording starts.
+func (d *DeviceRecorder) SetProcessor(p Processor) {
+	d.Lock()
+	defer d.Unlock()
+	d.processor = p
+}
+
+// Arm the recorder, so that its recordings wait for the start
+// trigger to fire, and record from the sample at which it does,
+// along with the stream before it (see SetPre()). They stop post
+// after the start, if post is positive, or at the sample at which
+// the stop trigger fires, if stop is not nil, unless the maximum of
+// SetMax() or a call to Stop() comes first. The maximum counts the
+// samples from the start. If start is nil, recordings start at
+// once. It takes effect when the next recording starts.
+func (d *DeviceRecorder) Arm(start, stop Trigger, post time.Duration) {
+	d.Lock()
+	defer d.Unlock()
+	d.start, d.stop, d.post = start, stop, post
+}
+
 // Recording returns true if and only if this
 // device is currently recording.
 func (d *DeviceRecorder) Recording() bool {
@@ -70,6 +141,51 @@ func (d *DeviceRecorder) Recording() bool {
 	return d.recording
 }
 
+// Paused returns true if and only if this device
+// is recording, but paused.
+func (d *DeviceRecorder) Paused() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.recording && d.paused
+}
+
+// Pause the recording; the frames that arrive until
+// Resume() is called are not recorded.
+func (d *DeviceRecorder) Pause() error {
+	d.Lock()
+	defer d.Unlock()
+	if !d.recording {
+		return fmt.Errorf("not recording")
+	}
+	if d.paused {
+		return fmt.Errorf("already paused")
+	}
+	d.paused = true
+	return nil
+}
+
+// Resume a paused recording.
+func (d *DeviceRecorder) Resume() error {
+	d.Lock()
+	defer d.Unlock()
+	if !d.recording {
+		return fmt.Errorf("not recording")
+	}
+	if !d.paused {
+		return fmt.Errorf("not paused")
+	}
+	d.paused = false
+	return nil
+}
+
+// Armed returns true if and only if this device is
+// recording, but waiting for the start trigger to fire.
+func (d *DeviceRecorder) Armed() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.recording && d.armed
+}
+
 // RecordingTimed returns true if and only if this
 // device is currently recording a fixed-time
 // recording.
@@ -79,6 +195,16 @@ func (d *DeviceRecorder) RecordingTimed() bool {
 	return d.recording && d.max > 0
 }
 
+// RecordingFinite returns true if and only if this
+// device is currently recording a recording that stops
+// by itself: a fixed-time one, or one that stops after
+// the start trigger.
+func (d *DeviceRecorder) RecordingFinite() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.recording && (d.max > 0 || d.post > 0 || d.stop != nil)
+}
+
 // RecordAsync will subscribe to its device and begin to record
 // asynchronously. An error is returned if the device
 // cannot be subscribed to. If the subscription is closed (for
@@ -93,8 +219,9 @@ func (d *DeviceRecorder) RecordAsync() (err error) {
 		return fmt.Errorf("already recording")
 	}
 
-	// subscribe to the device
-	out, err := d.device.Subscribe(RecorderName)
+	// subscribe to the device, never dropping data,
+	// starting with the history that was asked for
+	out, history, err := d.device.SubscribeWithHistory(d.id, DeliverBlock, d.pre)
 	if err != nil {
 		return
 	}
@@ -102,27 +229,123 @@ func (d *DeviceRecorder) RecordAsync() (err error) {
 	// initialize the underlying recorder
 	err = d.r.Init()
 	if err != nil {
+		d.device.Unsubscribe(d.id)
 		return
 	}
 
 	// record asynchronously
+	rec := &recording{
+		r:       d.r,
+		p:       d.processor,
+		history: history,
+		pre:     d.pre,
+		max:     d.max,
+		start:   d.start,
+		stop:    d.stop,
+		post:    d.post,
+		paused:  d.Paused,
+		fired:   d.fired,
+		release: d.Release,
+	}
+	if rec.start == nil {
+		rec.start = immediately{}
+	}
+	rec.reset()
 	d.cerr = make(chan error, 1)
-	go worker(d.r, out, d.cerr, d.max)
+	go rec.work(out, d.cerr)
 	d.recording = true
+	d.paused = false
+	d.armed = d.start != nil
 	return
 }
 
-// worker will read the frames one by one and write them
-// to the Recorder; if we have reached max frames, he will
-// stop.
-func worker(r Recorder, out chan DataFrame, cerr chan error, max int) {
-	defer close(cerr)
+// The start trigger fired.
+func (d *DeviceRecorder) fired() {
+	d.Lock()
+	defer d.Unlock()
+	d.armed = false
+}
+
+// recording holds what a recording needs to know,
+// as it was when the recording started.
+type recording struct {
+	r       Recorder
+	p       Processor
+	history []DataFrame // the stream before the recording started
+	pre     time.Duration
+	max     int // max samples after the start
+	start   Trigger
+	stop    Trigger // nil if there is none
+	post    time.Duration
+	paused  func() bool // whether the recording is paused
+	fired   func()      // called when the start trigger fires
+	release func()      // unsubscribes from the device
+}
+
+func (rec *recording) reset() {
+	if rec.p != nil {
+		rec.p.Reset()
+	}
+	rec.start.Reset()
+	if rec.stop != nil {
+		rec.stop.Reset()
+	}
+}
+
+// Unsubscribe from the device, however the recording ended,
+// so that the device is not held up by the frames that no one
+// takes; they are taken until the subscription closes.
+func (rec *recording) unsubscribe(out chan DataFrame) {
+	done := make(chan bool)
+	go func() {
+		for _ = range out {
+		}
+		close(done)
+	}()
+	rec.release()
+	<-done
+}
+
+// Run the frame through the processor, if any.
+func (rec *recording) process(df DataFrame) DataFrame {
+	if rec.p != nil {
+		return rec.p.Process(df)
+	}
+	return df
+}
+
+// work will read the frames one by one, run them through the
+// processor, if any, and keep the last pre of them until the
+// start trigger fires; then, he will write them and the frames
+// from the start to the Recorder, unless the recording is paused,
+// until he reaches the stop or max samples.
+func (rec *recording) work(out chan DataFrame, cerr chan error) {
+	// the outcome goes to the first waiter only; the
+	// others find the channel closed
+	var err error
+	defer func() {
+		cerr <- err
+		close(cerr)
+	}()
+	defer rec.unsubscribe(out)
 	var (
-		df      DataFrame
-		ok      bool
-		count   int
-		samples int
+		df        DataFrame
+		ok        bool
+		count     int
+		samples   int
+		wasPaused bool
+
+		before  = newFrameHistory(rec.pre) // the stream until the start
+		fired   bool                       // whether the start trigger fired
+		started bool                       // whether the frames reached the start
+		from    int64                      // the timestamp of the start
+		until   = int64(math.MaxInt64)     // the timestamp of the stop
 	)
+	for _, df = range rec.history {
+		if df = rec.process(df); df != nil {
+			before.add(df)
+		}
+	}
 	for {
 		// take a data frame from the device
 		df, ok = <-out
@@ -130,32 +353,125 @@ func worker(r Recorder, out chan DataFrame, cerr chan error, max int) {
 			return
 		}
 
+		// follow the pauses of the recording; the processor
+		// starts over after each, since the stream jumps
+		if now := rec.paused(); now != wasPaused {
+			if now {
+				err = rec.r.Pause()
+			} else {
+				err = rec.r.Resume()
+				if rec.p != nil {
+					rec.p.Reset()
+				}
+			}
+			if err != nil {
+				return
+			}
+			wasPaused = now
+		}
+		if wasPaused {
+			continue
+		}
+
+		// look for the start, and then for the stop after it,
+		// in the frames of the device
+		rest := df
+		if !fired {
+			if from, fired = rec.start.Fire(df); fired {
+				rec.fired()
+				if rec.post > 0 {
+					until = from + int64(rec.post)
+				}
+				_, rest = splitFrame(df, from+1)
+			}
+		}
+		if fired && rest != nil && rec.stop != nil {
+			if ts, ok := rec.stop.Fire(rest); ok && ts < until {
+				until = ts
+			}
+		}
+
+		if df = rec.process(df); df == nil {
+			continue
+		}
+
+		// record the stream before the start, once the
+		// frames reach it
+		if !started {
+			if !fired {
+				before.add(df)
+				continue
+			}
+			var head DataFrame
+			head, df = splitFrame(df, from)
+			if head != nil {
+				before.add(head)
+			}
+			for _, h := range before.from(from - int64(rec.pre)) {
+				if err = rec.r.RecordFrame(h); err != nil {
+					return
+				}
+			}
+			before.reset()
+			started = true
+			if df == nil {
+				continue
+			}
+		}
+
+		// respect the stop
+		var past DataFrame
+		if df, past = splitFrame(df, until); df == nil {
+			return
+		}
+
 		// count the samples
 		samples = df.Buffer().Samples()
 		count += samples
 
 		// respect max samples
-		frame, proceed := nextFrame(df, max, count, samples)
+		frame, more := nextFrame(df, rec.max, count, samples)
 
 		// record the frame
-		if err := r.RecordFrame(frame); err != nil {
-			cerr <- err
+		if err = rec.r.RecordFrame(frame); err != nil {
 			return
 		}
 
-		if !proceed {
+		if past != nil || !more {
 			return
 		}
 	}
 }
 
+// Split the frame into its samples before the timestamp and
+// the rest, either of which is nil if it has no samples.
+func splitFrame(df DataFrame, ts int64) (head, tail DataFrame) {
+	b := df.Buffer()
+	if b == nil {
+		return df, nil
+	}
+	var (
+		n = b.Samples()
+		s = 0
+	)
+	for s < n && b.Timestamps()[s] < ts {
+		s++
+	}
+	switch s {
+	case n:
+		return df, nil
+	case 0:
+		return nil, df
+	}
+	return SliceFrame(df, 0, s), SliceFrame(df, s, n)
+}
+
 // nextFrame will decide if we need to proceed writing frames
 // with respect to the max frames
 func nextFrame(df DataFrame, max, count, samples int) (DataFrame, bool) {
 	if max > 0 && count >= max {
 		if needed := (samples - count + max); needed < samples {
-			buf := df.Buffer().Slice(0, needed)
-			df = NewDataFrame(buf, df.SampleRate())
+			df = SliceFrame(df, 0, needed)
 		}
 		return df, false
 	}
@@ -180,16 +496,19 @@ func (d *DeviceRecorder) Wait() (info *RecordingInfo, err error) {
 		return nil, fmt.Errorf("not recording")
 	}
 
-	// wait for the worker
-	err, _ = <-d.cerr
-	if err != nil {
-		log.Printf("wait err: %v", err)
-		return
+	// wait for the worker; the recording is over
+	// either way, and another may start
+	err, ok := <-d.cerr
+	if !ok {
+		return nil, fmt.Errorf("not recording")
 	}
-
 	d.Lock()
 	d.recording = false
 	defer d.Unlock()
+	if err != nil {
+		log.Printf("wait err: %v", err)
+		return
+	}
 
 	// stop
 	id, err := d.r.Stop()
@@ -202,14 +521,16 @@ func (d *DeviceRecorder) Wait() (info *RecordingInfo, err error) {
 	ms := d.r.Stats()
 
 	return &RecordingInfo{
+		RecorderId: d.id,
 		ResourceId: id,
 		DurationMs: ms,
 	}, nil
 }
 
-// Release the worker.
+// Release the worker. The worker releases itself when
+// the recording stops by itself.
 func (d *DeviceRecorder) Release() {
-	d.device.Unsubscribe(RecorderName)
+	d.device.Unsubscribe(d.id)
 }
 
 // Stop will stop recording and return the details of the
@@ -4,15 +4,69 @@
 package device
 
 import (
+	"context"
+	"fmt"
 	//"log"
+	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/obf/recorder"
 	"testing"
 	"time"
 )
 
+// A Recorder that keeps the frames in memory.
+type memoryRecorder struct {
+	frames []DataFrame
+	pauses []int // the number of frames at each pause and resume
+}
+
+func (mr *memoryRecorder) Init() error {
+	mr.frames, mr.pauses = nil, nil
+	return nil
+}
+
+func (mr *memoryRecorder) Pause() error {
+	mr.pauses = append(mr.pauses, len(mr.frames))
+	return nil
+}
+
+func (mr *memoryRecorder) Resume() error {
+	mr.pauses = append(mr.pauses, len(mr.frames))
+	return nil
+}
+
+func (mr *memoryRecorder) RecordFrame(df DataFrame) error {
+	mr.frames = append(mr.frames, df)
+	return nil
+}
+
+func (mr *memoryRecorder) Stop() (string, error) {
+	return "memory", nil
+}
+
+func (mr *memoryRecorder) Stats() uint32 {
+	return 0
+}
+
+// A Recorder that fails to record any frame.
+type failingRecorder struct {
+	memoryRecorder
+}
+
+func (fr *failingRecorder) RecordFrame(df DataFrame) error {
+	return fmt.Errorf("cannot record")
+}
+
+// The timestamps of the frames, in order.
+func (mr *memoryRecorder) timestamps() (ts []int64) {
+	for _, df := range mr.frames {
+		ts = append(ts, df.Buffer().Timestamps()...)
+	}
+	return
+}
+
 func TestRecord(t *testing.T) {
 	d := newEmptyDevice()
-	if err := d.Engage(); err != nil || !d.Engaged() {
+	if err := d.Engage(context.Background()); err != nil || !d.Engaged() {
 		t.Errorf("could not engage")
 	}
 	defer d.Disengage()
@@ -40,7 +94,7 @@ func TestRecord(t *testing.T) {
 
 func TestRecord__MaxSamples(t *testing.T) {
 	d := newEmptyDevice()
-	if err := d.Engage(); err != nil || !d.Engaged() {
+	if err := d.Engage(context.Background()); err != nil || !d.Engaged() {
 		t.Errorf("could not engage")
 	}
 	defer d.Disengage()
@@ -63,9 +117,47 @@ func TestRecord__MaxSamples(t *testing.T) {
 	}
 }
 
+func TestRecord__MaxReleases(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	r := NewDeviceRecorder(d, new(memoryRecorder))
+	r.SetMax(10)
+	r.RecordAsync()
+	if _, err := r.Wait(); err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+	assertPublishing(t, d, r.Id())
+}
+
+// Check that the recorder no longer subscribes to the device,
+// and that the device keeps publishing for longer than it
+// would take to fill the channel of the subscription.
+func assertPublishing(t *testing.T, d Device, id string) {
+	for _, s := range d.Subscriptions() {
+		if s.Name == id {
+			t.Errorf("the recorder is still subscribed: %+v", s)
+		}
+	}
+	out, err := d.Subscribe("after")
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	defer d.Unsubscribe("after")
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < DataFrameBufferSize+100; i++ {
+		select {
+		case <-out:
+		case <-timeout:
+			t.Fatalf("the device stopped publishing after %d frames", i)
+		}
+	}
+}
+
 func TestRecord__WaitFail(t *testing.T) {
 	d := newEmptyDevice()
-	if err := d.Engage(); err != nil || !d.Engaged() {
+	if err := d.Engage(context.Background()); err != nil || !d.Engaged() {
 		t.Errorf("could not engage")
 	}
 	defer d.Disengage()
@@ -88,7 +180,7 @@ func TestRecord__WaitFail(t *testing.T) {
 
 	go func() {
 		if _, err := r.Wait(); err != nil {
-			t.Fatalf("this should have succeeded")
+			t.Errorf("this should have succeeded")
 		}
 	}()
 
@@ -98,3 +190,108 @@ func TestRecord__WaitFail(t *testing.T) {
 		t.Fatalf("this should have failed")
 	}
 }
+
+func TestRecord__WaitError(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	r := NewDeviceRecorder(d, new(failingRecorder))
+	if err := r.RecordAsync(); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if _, err := r.Wait(); err == nil {
+		t.Errorf("expected the error of the recorder")
+	}
+	if r.Recording() {
+		t.Errorf("the recording should be over")
+	}
+	if _, err := r.Wait(); err == nil || err.Error() != "not recording" {
+		t.Errorf("expected no recording to wait on: %v", err)
+	}
+	if err := r.RecordAsync(); err != nil {
+		t.Errorf("failed to record again: %v", err)
+	}
+	r.Stop()
+}
+
+func TestRecord__Concurrent(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	var (
+		mr1, mr2 = new(memoryRecorder), new(memoryRecorder)
+		r1, r2   = NewDeviceRecorder(d, mr1), NewDeviceRecorder(d, mr2)
+	)
+	if r1.Id() == r2.Id() {
+		t.Fatalf("recorders should have distinct ids: %s", r1.Id())
+	}
+	r1.SetMax(4)
+	r2.SetProcessor(NewChannelSelector(0))
+	if err := r1.RecordAsync(); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if err := r2.RecordAsync(); err != nil {
+		t.Fatalf("failed to record alongside another recorder: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// stopping one leaves the other recording
+	info, err := r2.Stop()
+	if err != nil || info.RecorderId != r2.Id() {
+		t.Fatalf("could not stop: %v, %+v", err, info)
+	}
+	if !r1.Recording() {
+		t.Errorf("the other recorder should still be recording")
+	}
+	if _, err := r1.Wait(); err != nil {
+		t.Fatalf("could not finish: %v", err)
+	}
+
+	if len(mr1.timestamps()) != 4 || len(mr2.frames) == 0 {
+		t.Fatalf("expected frames from both recorders: %d, %d", len(mr1.frames), len(mr2.frames))
+	}
+	if c := mr2.frames[0].Buffer().Channels(); c != 1 {
+		t.Errorf("expected the selected channel only, got %d", c)
+	}
+}
+
+func TestRecord__Pause(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	mr := new(memoryRecorder)
+	r := NewDeviceRecorder(d, mr)
+	if err := r.Pause(); err == nil {
+		t.Errorf("should not pause without recording")
+	}
+	r.RecordAsync()
+	time.Sleep(10 * time.Millisecond)
+	if err := r.Pause(); err != nil || !r.Paused() {
+		t.Fatalf("could not pause: %v", err)
+	}
+	if err := r.Pause(); err == nil {
+		t.Errorf("should not pause twice")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := r.Resume(); err != nil || r.Paused() {
+		t.Fatalf("could not resume: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.Stop()
+
+	// the frames around the pause are apart
+	if len(mr.pauses) != 2 {
+		t.Fatalf("expected a pause and a resume: %v", mr.pauses)
+	}
+	i := mr.pauses[0]
+	if i == 0 || i != mr.pauses[1] || i == len(mr.frames) {
+		t.Fatalf("expected frames before and after the pause: %v of %d", mr.pauses, len(mr.frames))
+	}
+	before, after := mr.frames[i-1].Buffer().Timestamps()[0], mr.frames[i].Buffer().Timestamps()[0]
+	if after-before < int64(15*time.Millisecond) {
+		t.Errorf("expected a jump of the timestamps: %v", time.Duration(after-before))
+	}
+}
@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Device States
+// ----------------------------------------------------------------- //
+
+// DeviceState is the stage of the lifecycle of a device.
+// A device moves through the states as follows:
+//
+//	idle, error   -> engaging
+//	engaging      -> streaming, reconnecting, disengaging, error
+//	streaming     -> reconnecting, disengaging
+//	reconnecting  -> streaming, disengaging
+//	disengaging   -> idle, error
+type DeviceState int
+
+const (
+	StateIdle         DeviceState = iota // not engaged
+	StateEngaging                        // waiting for the handshake
+	StateStreaming                       // publishing frames
+	StateReconnecting                    // lost the stream and trying to engage again
+	StateDisengaging                     // releasing the device
+	StateError                           // not engaged, because of an error
+)
+
+var stateNames = []string{"idle", "engaging", "streaming", "reconnecting", "disengaging", "error"}
+
+func (s DeviceState) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("DeviceState(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// StateChange describes a move from one state to another.
+type StateChange struct {
+	From      DeviceState // the previous state
+	To        DeviceState // the new state
+	Reason    string      // what caused the move
+	Timestamp int64       // when the move happened, in nanoseconds
+}
+
+func (sc *StateChange) String() string {
+	return fmt.Sprintf("%v -> %v (%s)", sc.From, sc.To, sc.Reason)
+}
+
+// The capacity of the channels of state subscriptions.
+const StateChangeBufferSize = 16
+
+// ----------------------------------------------------------------- //
+// State Machine
+// ----------------------------------------------------------------- //
+
+// The state machine has its own lock, because it is moved
+// both while the lock of the device is held and by the
+// streamer, which does not take that lock.
+type stateMachine struct {
+	sync.Mutex
+	state DeviceState
+	subs  map[string]chan *StateChange
+}
+
+func newStateMachine() *stateMachine {
+	return &stateMachine{
+		subs: make(map[string]chan *StateChange),
+	}
+}
+
+func (sm *stateMachine) current() DeviceState {
+	sm.Lock()
+	defer sm.Unlock()
+	return sm.state
+}
+
+// Move to the state if the machine is in one of the given
+// states, and tell the subscribers. Returns whether it moved.
+func (sm *stateMachine) move(to DeviceState, reason string, from ...DeviceState) bool {
+	sm.Lock()
+	defer sm.Unlock()
+	for _, s := range from {
+		if s != sm.state {
+			continue
+		}
+		sc := &StateChange{
+			From:      sm.state,
+			To:        to,
+			Reason:    reason,
+			Timestamp: time.Now().UnixNano(),
+		}
+		sm.state = to
+		for name, out := range sm.subs {
+			select {
+			case out <- sc:
+			default:
+				log.Printf("state subscription '%s' is full, dropping %v", name, sc)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (sm *stateMachine) subscribe(name string) (chan *StateChange, error) {
+	sm.Lock()
+	defer sm.Unlock()
+	if _, ok := sm.subs[name]; ok {
+		return nil, fmt.Errorf("state subscription already exists")
+	}
+	out := make(chan *StateChange, StateChangeBufferSize)
+	sm.subs[name] = out
+	return out, nil
+}
+
+func (sm *stateMachine) unsubscribe(name string) {
+	sm.Lock()
+	defer sm.Unlock()
+	if out, ok := sm.subs[name]; ok {
+		close(out)
+		delete(sm.subs, name)
+	}
+}
+
+// ----------------------------------------------------------------- //
+// Device Methods
+// ----------------------------------------------------------------- //
+
+func (d *BaseDevice) State() DeviceState {
+	return d.state.current()
+}
+
+// Subscribe to the changes of state of the device under the
+// given name. Changes are dropped if the subscriber lets the
+// channel fill up.
+func (d *BaseDevice) SubscribeState(name string) (chan *StateChange, error) {
+	return d.state.subscribe(name)
+}
+
+func (d *BaseDevice) UnsubscribeState(name string) {
+	d.state.unsubscribe(name)
+}
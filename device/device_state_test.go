@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeviceState__String(t *testing.T) {
+	if s := StateReconnecting.String(); s != "reconnecting" {
+		t.Errorf("wrong name: %s", s)
+	}
+	if s := DeviceState(42).String(); s != "DeviceState(42)" {
+		t.Errorf("wrong name: %s", s)
+	}
+}
+
+func TestDeviceState__Lifecycle(t *testing.T) {
+	d := newEmptyDevice()
+	changes, err := d.SubscribeState("test")
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if _, err := d.SubscribeState("test"); err == nil {
+		t.Errorf("should have failed")
+	}
+	if d.State() != StateIdle {
+		t.Errorf("expected to start idle: %v", d.State())
+	}
+
+	d.Engage(context.Background())
+	if d.State() != StateStreaming {
+		t.Errorf("expected to stream: %v", d.State())
+	}
+	d.Disengage()
+	d.UnsubscribeState("test")
+
+	expected := []DeviceState{StateIdle, StateEngaging, StateStreaming, StateDisengaging, StateIdle}
+	checkStates(t, changes, expected)
+}
+
+func TestDeviceState__Error(t *testing.T) {
+	d := newErrorProneDevice()
+	changes, _ := d.SubscribeState("test")
+	d.Engage(context.Background())
+
+	// the stream fails right away
+	for d.Engaged() {
+		time.Sleep(time.Millisecond)
+	}
+	if d.State() != StateError {
+		t.Errorf("expected an error: %v", d.State())
+	}
+	d.UnsubscribeState("test")
+
+	expected := []DeviceState{StateIdle, StateEngaging, StateStreaming, StateDisengaging, StateError}
+	sc := checkStates(t, changes, expected)
+	if sc == nil || sc.Reason != "errProne device is error prone" || sc.Timestamp == 0 {
+		t.Errorf("wrong change: %+v", sc)
+	}
+}
+
+// Check that the changes, until the channel closes, move
+// through the expected states, and return the last one.
+func checkStates(t *testing.T, changes chan *StateChange, expected []DeviceState) (last *StateChange) {
+	var i int
+	for sc := range changes {
+		if i+1 >= len(expected) || sc.From != expected[i] || sc.To != expected[i+1] {
+			t.Errorf("unexpected change %d: %v", i, sc)
+		}
+		last = sc
+		i++
+	}
+	if i != len(expected)-1 {
+		t.Errorf("expected %d changes, got %d", len(expected)-1, i)
+	}
+	return
+}
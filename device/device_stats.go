@@ -0,0 +1,41 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"log"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Device Statistics
+// ----------------------------------------------------------------- //
+
+// SubscribeStats subscribes to the device under the given name
+// and feeds every frame to a Stats, which may be read at any
+// time. The sliding window of the Stats covers the given
+// duration. The Stats stops changing when the subscription ends,
+// for instance by calling Unsubscribe() with the same name on
+// the device. A Stats that falls behind skips the oldest frames
+// rather than holding up the device. The device must be engaged.
+func SubscribeStats(d Device, name string, window time.Duration) (*Stats, error) {
+	info := d.Info()
+	if info == nil || !d.Engaged() {
+		return nil, fmt.Errorf("device is not engaged")
+	}
+	in, err := d.SubscribeWithPolicy(name, DeliverDropOldest)
+	if err != nil {
+		return nil, err
+	}
+	st := NewStats(int(window * time.Duration(info.SampleRate) / time.Second))
+	go func() {
+		for df := range in {
+			st.Add(df.Buffer())
+		}
+		log.Printf("stats subscription '%s' closed", name)
+	}()
+	return st, nil
+}
@@ -4,6 +4,7 @@
 package device
 
 import (
+	"context"
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/repo"
@@ -42,6 +43,7 @@ type emptyDevice struct {
 	name     string
 	repo     *Repository
 	errProne bool // will produce errors in stream (for testing)
+	silent   bool // will never send its info (for testing)
 }
 
 func (ed *emptyDevice) Name() string {
@@ -52,7 +54,7 @@ func (ed *emptyDevice) Repo() *Repository {
 	return ed.repo
 }
 
-func (ed *emptyDevice) Engage() error {
+func (ed *emptyDevice) Engage(ctx context.Context) error {
 	return nil
 }
 
@@ -61,6 +63,10 @@ func (ed *emptyDevice) Disengage() error {
 }
 
 func (ed *emptyDevice) Stream(c *Control) (err error) {
+	if ed.silent {
+		<-c.Context().Done()
+		return
+	}
 	c.SendInfo(&DeviceInfo{
 		Channels:   1,
 		SampleRate: 250,
@@ -105,14 +111,26 @@ func (f *MockFrame) SampleRate() (r int) {
 	return 250
 }
 
+func (f *MockFrame) ChannelInfos() []*ChannelInfo {
+	return nil
+}
+
+func (f *MockFrame) Events() []*Event {
+	return nil
+}
+
+func (f *MockFrame) Ints() *IntBuffer {
+	return nil
+}
+
 func TestEngageLogic(t *testing.T) {
 	d := newEmptyDevice()
-	d.Engage()
+	d.Engage(context.Background())
 	if !d.Engaged() {
 		t.Errorf("didn't connect")
 	}
 
-	err := d.Engage()
+	err := d.Engage(context.Background())
 	if err == nil {
 		t.Errorf("failed to block second connect")
 	}
@@ -131,7 +149,7 @@ func TestEngageLogic(t *testing.T) {
 		t.Errorf("connected now for some reason")
 	}
 
-	d.Engage()
+	d.Engage(context.Background())
 	if !d.Engaged() {
 		t.Errorf("didn't connect for a second time")
 	}
@@ -141,13 +159,13 @@ func TestControl(t *testing.T) {
 	d := newEmptyDevice()
 	c := newControl(d.(*BaseDevice))
 
-	go func() {
-		time.Sleep(time.Second)
-		for !c.ShouldTerminate() {
-			time.Sleep(5 * time.Second)
-		}
-	}()
-	c.done <- true
+	if c.ShouldTerminate() {
+		t.Errorf("should not terminate yet")
+	}
+	c.cancel()
+	if !c.ShouldTerminate() {
+		t.Errorf("should terminate")
+	}
 }
 
 func TestCleanupLogic(t *testing.T) {
@@ -157,7 +175,7 @@ func TestCleanupLogic(t *testing.T) {
 		t.Errorf("has recorder/control for some reason")
 	}
 
-	err := d.Engage()
+	err := d.Engage(context.Background())
 	if err != nil {
 		t.Errorf("failed to connect")
 	}
@@ -173,7 +191,7 @@ func TestCleanupLogic(t *testing.T) {
 
 func TestDevice__Subscription(t *testing.T) {
 	d := newEmptyDevice()
-	err := d.Engage()
+	err := d.Engage(context.Background())
 	if err != nil || !d.Engaged() {
 		t.Errorf("failed to engage device")
 	}
@@ -223,7 +241,7 @@ func TestDevice__Subscription(t *testing.T) {
 
 // func TestRecord(t *testing.T) {
 // 	d := newEmptyDevice()
-// 	err := d.Engage()
+// 	err := d.Engage(context.Background())
 // 	if err != nil || !d.Engaged() {
 // 		t.Errorf("failed to connect")
 // 	}
@@ -270,7 +288,7 @@ func TestDevice__Subscription(t *testing.T) {
 
 // func TestMultipleRecording(t *testing.T) {
 // 	d := newEmptyDevice()
-// 	err := d.Engage()
+// 	err := d.Engage(context.Background())
 // 	if err != nil || !d.Engaged() {
 // 		t.Errorf("failed to connect")
 // 	}
@@ -297,13 +315,32 @@ func TestDevice__Subscription(t *testing.T) {
 
 func TestErrorProneStream(t *testing.T) {
 	d := newErrorProneDevice()
-	d.Engage()
+	d.Engage(context.Background())
 	time.Sleep(time.Millisecond * 100) // wait for device to fail
 	if d.Engaged() {
 		t.Errorf("device should have disconnected, probably")
 	}
 }
 
+func TestEngage__Timeout(t *testing.T) {
+	d := NewDevice(&emptyDevice{name: "SilentDevice", silent: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Engage(ctx); err == nil {
+		t.Fatalf("expected a timeout")
+	}
+	if d.Engaged() || d.State() != StateError {
+		t.Errorf("expected an error: %v", d.State())
+	}
+
+	// and a device that does answer can engage again
+	d.(*BaseDevice).deviceImpl.(*emptyDevice).silent = false
+	if err := d.Engage(context.Background()); err != nil || !d.Engaged() {
+		t.Errorf("could not engage: %v", err)
+	}
+	d.Disengage()
+}
+
 func ensureClosed(t *testing.T, out chan DataFrame) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Triggers -- moments in the stream that start or stop recordings
+// ----------------------------------------------------------------- //
+
+// Trigger finds a moment in a stream of DataFrames, like the
+// onset of a stimulus, at which a recording starts or stops.
+// Its state carries across frames.
+type Trigger interface {
+	// The timestamp of the sample at which the trigger fires
+	// in the frame, if it does.
+	Fire(df DataFrame) (ts int64, ok bool)
+
+	// Forget the state of the trigger.
+	Reset()
+}
+
+// ThresholdTrigger is a Trigger that fires at the first
+// sample at which a channel crosses a level.
+type ThresholdTrigger struct {
+	channel int
+	level   float64
+	falling bool
+	last    float64 // the value of the channel before the frame
+	primed  bool    // whether there was a value before the frame
+}
+
+// Create a new ThresholdTrigger that fires when the channel,
+// counting from 0, rises to the level, or falls to it if
+// falling is true.
+func NewThresholdTrigger(channel int, level float64, falling bool) *ThresholdTrigger {
+	if channel < 0 {
+		panic(fmt.Sprintf("bad channel: %d", channel))
+	}
+	return &ThresholdTrigger{
+		channel: channel,
+		level:   level,
+		falling: falling,
+	}
+}
+
+// Frames that lack the channel never fire.
+func (t *ThresholdTrigger) Fire(df DataFrame) (ts int64, ok bool) {
+	b := df.Buffer()
+	if b == nil || t.channel >= b.Channels() {
+		return 0, false
+	}
+	var (
+		v  = b.Channel(t.channel)
+		tt = b.Timestamps()
+	)
+	for s, x := range v {
+		crossed := t.last < t.level && x >= t.level
+		if t.falling {
+			crossed = t.last > t.level && x <= t.level
+		}
+		crossed = crossed && t.primed
+		t.last, t.primed = x, true
+		if crossed {
+			return tt[s], true
+		}
+	}
+	return 0, false
+}
+
+func (t *ThresholdTrigger) Reset() {
+	t.last, t.primed = 0, false
+}
+
+// EventTrigger is a Trigger that fires at the earliest event
+// of a frame for which the function is true.
+type EventTrigger func(e *Event) bool
+
+// Create a new EventTrigger that fires when a trigger channel
+// becomes active, like the "Keypad" or "Optical" input of the
+// AvatarEEG, according to the EventTriggerOn events that the
+// driver finds on the channel of that label.
+func NewEdgeTrigger(source string) EventTrigger {
+	return func(e *Event) bool {
+		return e.Code == EventTriggerOn && e.Source == source
+	}
+}
+
+// Create a new EventTrigger that fires at the markers of the
+// given label (see Device.Mark()).
+func NewMarkerTrigger(label string) EventTrigger {
+	return func(e *Event) bool {
+		return e.Code == EventMarker && e.Label == label
+	}
+}
+
+func (t EventTrigger) Fire(df DataFrame) (ts int64, ok bool) {
+	for _, e := range df.Events() {
+		if t(e) && (!ok || e.Timestamp < ts) {
+			ts, ok = e.Timestamp, true
+		}
+	}
+	return
+}
+
+func (t EventTrigger) Reset() {}
+
+// immediately is the Trigger of the recordings that are not
+// armed, which fires at the first sample.
+type immediately struct{}
+
+func (immediately) Fire(df DataFrame) (ts int64, ok bool) {
+	if b := df.Buffer(); b != nil && b.Samples() > 0 {
+		return b.Timestamps()[0], true
+	}
+	return 0, false
+}
+
+func (immediately) Reset() {}
+
+// ----------------------------------------------------------------- //
+// Markers
+// ----------------------------------------------------------------- //
+
+// Mark the stream with a named marker, like the onset of a
+// stimulus. The marker is an EventMarker in the next frame that
+// the device publishes, at the first sample since the call, or
+// the last sample of the frame if there is none.
+func (d *BaseDevice) Mark(label string) {
+	d.marksLock.Lock()
+	defer d.marksLock.Unlock()
+	d.marks = append(d.marks, &Event{
+		Timestamp: time.Now().UnixNano(),
+		Code:      EventMarker,
+		Label:     label,
+		Source:    "marker",
+	})
+}
+
+// Take the markers that are waiting for a frame.
+func (d *BaseDevice) takeMarks() (marks []*Event) {
+	d.marksLock.Lock()
+	defer d.marksLock.Unlock()
+	marks, d.marks = d.marks, nil
+	return
+}
+
+// Add the markers that are waiting to the frame, at its
+// samples, so that they go wherever the samples go.
+func (d *BaseDevice) addMarks(df DataFrame) DataFrame {
+	b := df.Buffer()
+	if b == nil || b.Samples() == 0 {
+		return df
+	}
+	marks := d.takeMarks()
+	if len(marks) == 0 {
+		return df
+	}
+
+	ts := b.Timestamps()
+	for _, e := range marks {
+		s := 0
+		for s < len(ts)-1 && ts[s] < e.Timestamp {
+			s++
+		}
+		e.Timestamp = ts[s]
+	}
+	events := append(append([]*Event(nil), df.Events()...), marks...)
+	SortEvents(events)
+	return NewDataFrameWithInts(b, df.Ints(), df.SampleRate(), df.ChannelInfos(), events)
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package device
+
+import (
+	"context"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"testing"
+	"time"
+)
+
+// A frame of one channel with the given values, at timestamps
+// counting up from ts.
+func valueFrame(ts int64, vs ...float64) DataFrame {
+	b := NewBlockBuffer(1, len(vs))
+	for i, v := range vs {
+		b.AppendSample([]float64{v}, ts+int64(i))
+	}
+	return NewDataFrame(b, 250)
+}
+
+func TestThresholdTrigger(t *testing.T) {
+	rising := NewThresholdTrigger(0, 5, false)
+	if _, ok := rising.Fire(valueFrame(0, 6, 7)); ok {
+		t.Errorf("should not fire without a crossing")
+	}
+	if _, ok := rising.Fire(valueFrame(2, 8, 4, 3)); ok {
+		t.Errorf("should not fire when falling")
+	}
+	if ts, ok := rising.Fire(valueFrame(5, 5, 9)); !ok || ts != 5 {
+		t.Errorf("should fire across frames: %d, %v", ts, ok)
+	}
+
+	falling := NewThresholdTrigger(0, 5, true)
+	if ts, ok := falling.Fire(valueFrame(0, 6, 7, 1)); !ok || ts != 2 {
+		t.Errorf("should fire when falling: %d, %v", ts, ok)
+	}
+	falling.Reset()
+	if _, ok := falling.Fire(valueFrame(3, 1)); ok {
+		t.Errorf("should not fire after a reset")
+	}
+
+	if _, ok := NewThresholdTrigger(1, 5, false).Fire(valueFrame(0, 1, 9)); ok {
+		t.Errorf("should not fire without the channel")
+	}
+}
+
+func TestEventTrigger(t *testing.T) {
+	b := NewBlockBuffer(1, 3)
+	for ts := int64(0); ts < 3; ts++ {
+		b.AppendSample([]float64{0}, ts)
+	}
+	df := NewDataFrameWithEvents(b, 250, nil, []*Event{
+		&Event{Timestamp: 2, Code: EventMarker, Label: "go", Source: "marker"},
+		&Event{Timestamp: 1, Code: EventTriggerOff, Label: "Keypad off", Source: "Keypad"},
+		&Event{Timestamp: 2, Code: EventTriggerOn, Label: "Keypad on", Source: "Keypad"},
+		&Event{Timestamp: 1, Code: EventMarker, Label: "go", Source: "marker"},
+	})
+
+	if ts, ok := NewEdgeTrigger("Keypad").Fire(df); !ok || ts != 2 {
+		t.Errorf("expected the keypad: %d, %v", ts, ok)
+	}
+	if _, ok := NewEdgeTrigger("Optical").Fire(df); ok {
+		t.Errorf("should not fire without the optical input")
+	}
+	if ts, ok := NewMarkerTrigger("go").Fire(df); !ok || ts != 1 {
+		t.Errorf("expected the first marker: %d, %v", ts, ok)
+	}
+	if _, ok := NewMarkerTrigger("stop").Fire(df); ok {
+		t.Errorf("should not fire without the marker")
+	}
+}
+
+func TestMark(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	out, _ := d.Subscribe("marked")
+	before := time.Now().UnixNano()
+	d.Mark("stimulus")
+	for df := range out {
+		for _, e := range df.Events() {
+			if e.Code != EventMarker || e.Label != "stimulus" {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+			if e.Timestamp != df.Buffer().Timestamps()[0] || e.Timestamp < before {
+				t.Errorf("expected the marker at the sample after it")
+			}
+			return
+		}
+	}
+}
+
+func TestRecord__Armed(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	mr := new(memoryRecorder)
+	r := NewDeviceRecorder(d, mr)
+	r.SetPre(5 * time.Millisecond)
+	r.Arm(NewMarkerTrigger("go"), nil, 10*time.Millisecond)
+	if err := r.RecordAsync(); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !r.Armed() || !r.RecordingFinite() {
+		t.Errorf("the recording should be armed")
+	}
+
+	d.Mark("go")
+	if _, err := r.Wait(); err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+	if r.Armed() {
+		t.Errorf("the recording should no longer be armed")
+	}
+
+	// the marker comes after the pre and before the post
+	var marker *Event
+	for _, df := range mr.frames {
+		for _, e := range df.Events() {
+			if e.Code == EventMarker {
+				marker = e
+			}
+		}
+	}
+	if marker == nil {
+		t.Fatalf("expected the marker to be recorded")
+	}
+	ts := mr.timestamps()
+	if first := marker.Timestamp - ts[0]; first <= 0 || first > int64(5*time.Millisecond) {
+		t.Errorf("expected 5ms before the marker: %v", time.Duration(first))
+	}
+	if last := ts[len(ts)-1] - marker.Timestamp; last <= 0 || last >= int64(10*time.Millisecond) {
+		t.Errorf("expected 10ms after the marker: %v", time.Duration(last))
+	}
+	assertPublishing(t, d, r.Id())
+}
+
+func TestRecord__ArmedStop(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	mr := new(memoryRecorder)
+	r := NewDeviceRecorder(d, mr)
+	r.Arm(NewMarkerTrigger("go"), NewMarkerTrigger("stop"), 0)
+	r.RecordAsync()
+	time.Sleep(5 * time.Millisecond)
+	d.Mark("go")
+	time.Sleep(10 * time.Millisecond)
+	d.Mark("stop")
+	if _, err := r.Wait(); err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+	if len(mr.frames) == 0 {
+		t.Errorf("expected the frames between the markers")
+	}
+	for _, df := range mr.frames {
+		for _, e := range df.Events() {
+			if e.Label == "stop" {
+				t.Errorf("expected the recording to stop before the stop marker")
+			}
+		}
+	}
+	assertPublishing(t, d, r.Id())
+}
+
+func TestRecord__ArmedMax(t *testing.T) {
+	d := newEmptyDevice()
+	d.Engage(context.Background())
+	defer d.Disengage()
+
+	mr := new(memoryRecorder)
+	r := NewDeviceRecorder(d, mr)
+	r.Arm(NewMarkerTrigger("go"), NewMarkerTrigger("stop"), 0)
+	r.SetMax(3)
+	r.RecordAsync()
+	time.Sleep(5 * time.Millisecond)
+	d.Mark("go")
+	if _, err := r.Wait(); err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+	if ts := mr.timestamps(); len(ts) != 3 {
+		t.Errorf("expected 3 samples after the start, got %d", len(ts))
+	}
+}
@@ -4,13 +4,14 @@
 package avatar
 
 import (
+	"context"
 	"errors"
+	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/device"
 	. "github.com/jbrukh/goavatar/obf/recorder"
 	. "github.com/jbrukh/goavatar/repo"
 	"io"
 	"log"
-	"os"
 )
 
 // ----------------------------------------------------------------- //
@@ -34,25 +35,32 @@ type AvatarDevice struct {
 	reader     io.ReadCloser
 	repo       *Repository
 	name       string
+	gapPolicy  GapPolicy // what to do about dropped frames
 }
 
 // NewAvatarDevice creates a new AvatarEEG connection. The user
 // can then start streaming data by calling Connect() and reading the
 // output channel.
 func NewAvatarDevice(basedir, serialPort string) Device {
+	return NewAvatarDeviceWithGapPolicy(basedir, serialPort, GapMark)
+}
+
+// NewAvatarDeviceWithGapPolicy creates a new AvatarEEG connection
+// that deals with dropped frames according to the gap policy.
+func NewAvatarDeviceWithGapPolicy(basedir, serialPort string, policy GapPolicy) Device {
 	return NewDevice(&AvatarDevice{
 		serialPort: serialPort,
 		name:       "AvatarEEG",
 		repo:       NewRepositoryOrPanic(basedir),
+		gapPolicy:  policy,
 	})
-
 }
 
 // Engaging the AvatarEEG means opening the serial
 // port to the device, at which point it immediately
 // begins streaming.
-func (ad *AvatarDevice) Engage() (err error) {
-	ad.reader, err = os.Open(ad.serialPort)
+func (ad *AvatarDevice) Engage(ctx context.Context) (err error) {
+	ad.reader, err = OpenPort(ctx, ad.serialPort)
 	return
 }
 
@@ -63,7 +71,7 @@ func (ad *AvatarDevice) Disengage() (err error) {
 
 // Process the stream.
 func (ad *AvatarDevice) Stream(c *Control) (err error) {
-	return parseByteStream(ad.reader, c)
+	return parseByteStream(ad.reader, c, ad.gapPolicy)
 }
 
 // Provide a recorder.
@@ -84,19 +92,28 @@ func (ad *AvatarDevice) Repo() *Repository {
 // parseByteStream parses the byte stream coming out of the device and writes the output
 // to the output channel parameter. It also listens on the Control in order to
 // know when to terminate. Note that this function must strictly obey ShouldTerminate()
-// and call Close() upon exiting.
-func parseByteStream(r io.ReadCloser, c *Control) (err error) {
-	parser := NewAvatarParser(r)
+// and call Close() upon exiting. Dropped frames are published as gap events and
+// dealt with according to the gap policy.
+func parseByteStream(r io.ReadCloser, c *Control, policy GapPolicy) (err error) {
+	parser := NewAvatarParser(c.Metrics().CountingReader(r))
+	parser.metrics = c.Metrics()
+	parser.gapPolicy = policy
 
 	// first send the device info; the Avatar keeps its
-	// info on its frames, so we will parse the first frame
-	frame, err := parser.ParseFrame()
-	if err != nil {
-		if IsCrcErr(err) || IsSizeErr(err) {
-			log.Printf("skippable error: %v", err)
-		} else {
-			log.Printf("error parsing frame: %v", err)
-			return err
+	// info on its frames, so we will parse the first good frame
+	var frame *AvatarDataFrame
+	for frame == nil {
+		if c.ShouldTerminate() {
+			return nil
+		}
+		frame, err = parser.ParseFrame()
+		if err != nil {
+			if IsCrcErr(err) || IsSizeErr(err) {
+				log.Printf("skippable error: %v", err)
+			} else {
+				log.Printf("error parsing frame: %v", err)
+				return err
+			}
 		}
 	}
 
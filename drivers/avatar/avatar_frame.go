@@ -97,9 +97,12 @@ func (h *AvatarHeader) PayloadSize() int {
 // device.
 type AvatarDataFrame struct {
 	AvatarHeader
-	data     *BlockBuffer // processed data, in a BlockBuffer
-	received time.Time    // time this frame was received locally
-	crc      uint16       // crc of the frame
+	data     *BlockBuffer   // processed data, in a BlockBuffer
+	ints     *IntBuffer     // raw counts of data
+	channels []*ChannelInfo // descriptions of the channels in data
+	events   []*Event       // trigger edges during this frame
+	received time.Time      // time this frame was received locally
+	crc      uint16         // crc of the frame
 }
 
 // String
@@ -112,6 +115,24 @@ func (df *AvatarDataFrame) Buffer() *BlockBuffer {
 	return df.data
 }
 
+// ChannelInfos describes the channels of the buffer: the
+// trigger channels, if enabled, followed by the EEG channels.
+func (df *AvatarDataFrame) ChannelInfos() []*ChannelInfo {
+	return df.channels
+}
+
+// Events are the edges of the trigger channels, if they
+// are enabled, like the keypad being pressed or released.
+func (df *AvatarDataFrame) Events() []*Event {
+	return df.events
+}
+
+// Ints are the raw counts of the analog-to-digital converter,
+// and the raw values of the trigger channels.
+func (df *AvatarDataFrame) Ints() *IntBuffer {
+	return df.ints
+}
+
 // the time this data framed was received locally
 func (df *AvatarDataFrame) Received() time.Time {
 	return df.received
@@ -5,6 +5,7 @@ package avatar
 
 import (
 	//"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
 	"testing"
 )
 
@@ -79,3 +80,81 @@ func TestChannels(t *testing.T) {
 		t.Errorf("error parsing channels: %v", channels)
 	}
 }
+
+func TestTriggerEvents(t *testing.T) {
+	var (
+		r     = new(avatarParser)
+		infos = []*ChannelInfo{{Label: "Optical"}, {Label: "Keypad"}}
+		b     = NewBlockBuffer(3, 3)
+	)
+	b.AppendSample([]float64{1, 0, 0.5}, 1)
+	b.AppendSample([]float64{1, 2, 0.5}, 2)
+	b.AppendSample([]float64{0, 2, 0.5}, 3)
+
+	events := r.triggerEvents(b, infos, true)
+	if len(events) != 3 {
+		t.Fatalf("wrong number of events: %d", len(events))
+	}
+	if e := events[1]; e.Source != "Keypad" || e.Code != EventTriggerOn || e.Timestamp != 2 {
+		t.Errorf("wrong event: %+v", e)
+	}
+	if e := events[2]; e.Source != "Optical" || e.Code != EventTriggerOff {
+		t.Errorf("wrong event: %+v", e)
+	}
+
+	// the state carries to the next frame
+	if events = r.triggerEvents(b.Slice(2, 3), infos, true); len(events) != 0 {
+		t.Errorf("should not have events: %v", events)
+	}
+	if events = r.triggerEvents(b, infos, false); events != nil {
+		t.Errorf("should not have events without triggers")
+	}
+}
+
+// A frame of two samples of one channel, with the given
+// frame count, starting at ts in steps of 4 ms.
+func gapFrame(count uint32, ts int64, x float64) (*AvatarHeader, *BlockBuffer) {
+	h := &AvatarHeader{FieldFrameCount: count, FieldSamples: 2}
+	b := NewBlockBuffer(1, 2)
+	b.AppendSample([]float64{x}, ts)
+	b.AppendSample([]float64{x}, ts+4000000)
+	return h, b
+}
+
+func TestCheckGap(t *testing.T) {
+	r := &avatarParser{gapPolicy: GapInterpolate}
+	h, b := gapFrame(7, 0, 0)
+	if gap, _ := r.checkGap(h, b, nil, 4000000); gap != nil {
+		t.Errorf("first frame is not a gap")
+	}
+
+	// no gap
+	h, b = gapFrame(8, 8000000, 0)
+	if gap, _ := r.checkGap(h, b, nil, 4000000); gap != nil {
+		t.Errorf("should not be a gap")
+	}
+
+	// frame 9 is lost, frame 10 was rejected
+	r.rejected = 1
+	h, b = gapFrame(11, 32000000, 5)
+	gap, fill := r.checkGap(h, b, nil, 4000000)
+	if gap == nil || gap.Code != EventGap || gap.Timestamp != 16000000 || gap.Duration != 16000000 {
+		t.Fatalf("wrong gap: %+v", gap)
+	}
+	if fill.Samples() != 4 {
+		t.Fatalf("wrong fill: %d", fill.Samples())
+	}
+	if v, ts := fill.Sample(1); v[0] != 2 || ts != 20000000 {
+		t.Errorf("wrong fill sample: %v %v", v, ts)
+	}
+	if r.rejected != 0 {
+		t.Errorf("should reset the rejected frames")
+	}
+
+	// the frame counter wraps around
+	r.lastCount = 0xFFFFFFFF
+	h, b = gapFrame(0, 40000000, 0)
+	if gap, _ := r.checkGap(h, b, nil, 4000000); gap != nil {
+		t.Errorf("should not be a gap")
+	}
+}
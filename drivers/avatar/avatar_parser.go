@@ -9,9 +9,11 @@ import (
 	"encoding/binary"
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
 	. "github.com/jbrukh/goavatar/util"
 	"io"
-	//"log"
+	"log"
+	"math"
 	"time"
 )
 
@@ -29,7 +31,8 @@ const (
 	AvatarExpectedSamples   = 16
 	AvatarSanePayload       = 8 * AvatarExpectedSamples * AvatarPointSize
 	AvatarMaxChannels       = 8
-	AvatarHeaderSize        = 19 // not including sync byte
+	AvatarHeaderSize        = 19   // not including sync byte
+	AvatarMaxGapFrames      = 1024 // larger jumps of the frame count are not gaps, but restarts
 )
 
 // The possible sample rates that the Avatar
@@ -44,12 +47,35 @@ var AvatarSampleRates = []int{250, 500, 1000}
 type avatarParser struct {
 	reader *bufio.Reader // reader of the stream
 	crc    CrcWriter
+
+	// channel descriptions of the last frame, and
+	// the header fields they were made for
+	channels    []*ChannelInfo
+	channelsFor byte
+	voltRange   uint16
+
+	// the last values of the trigger channels,
+	// so that edges are found across frames
+	triggers [2]float64
+
+	// gap detection: what to do about missing
+	// frames, and what we know of the last good one
+	gapPolicy GapPolicy
+	frames    int       // number of good frames
+	lastCount uint32    // frame count of the last good frame
+	last      []float64 // last sample of the last good frame
+	lastTs    int64     // timestamp of that sample
+	rejected  int       // frames rejected since the last good frame
+
+	// counts the rejected frames and the resyncs
+	metrics *Metrics
 }
 
 // create a new parser
-func NewAvatarParser(reader io.ReadCloser) *avatarParser {
+func NewAvatarParser(reader io.Reader) *avatarParser {
 	return &avatarParser{
-		reader: bufio.NewReader(reader),
+		reader:  bufio.NewReader(reader),
+		metrics: NewMetrics(),
 	}
 }
 
@@ -69,10 +95,13 @@ func (r *avatarParser) ParseFrame() (dataFrame *AvatarDataFrame, err error) {
 
 	// sync up with the stream, reading up
 	// until the sync up value
-	_, err = r.reader.ReadBytes(AvatarSyncByte)
+	skipped, err := r.reader.ReadBytes(AvatarSyncByte)
 	if err != nil {
 		return nil, err
 	}
+	if len(skipped) > 1 {
+		r.metrics.AddResync()
+	}
 
 	timeReceived := time.Now()
 
@@ -92,6 +121,7 @@ func (r *avatarParser) ParseFrame() (dataFrame *AvatarDataFrame, err error) {
 	// sync bytes if there is corruption
 	frameSize := int(uint16(three[1])<<8 | uint16(three[2]))
 	if frameSize > AvatarMaxFramesSize {
+		r.metrics.AddSizeError()
 		return nil, SizeErrf("this frame is over max frame size: %d", frameSize)
 	}
 
@@ -113,6 +143,8 @@ func (r *avatarParser) ParseFrame() (dataFrame *AvatarDataFrame, err error) {
 
 	// check the crc
 	if crc != ourCrc {
+		r.rejected++
+		r.metrics.AddCrcError()
 		return nil, CrcErrf("crc doesn't match: expected %d but calculated %d", crc, ourCrc)
 	}
 
@@ -158,36 +190,60 @@ func (r *avatarParser) ParseFrame() (dataFrame *AvatarDataFrame, err error) {
 		auxChannels += 2
 	}
 	data := NewBlockBuffer(auxChannels+channels, samples)
+	ints := NewIntBuffer(auxChannels+channels, samples)
 
 	// write the samples in blocks
 	for j := 0; j < samples; j++ {
 		totalChannels := auxChannels + channels
 		p := make([]float64, 0, totalChannels)
+		q := make([]int64, 0, totalChannels)
 
 		if hasTrigger {
 			// append the two trigger values
 			x, y := consumeTriggerData(payload)
 			p = append(p, x)
 			p = append(p, y)
+			q = append(q, int64(x))
+			q = append(q, int64(y))
 
 			// move forward in the payload
 			payload = payload[AvatarPointSize:]
 		}
 
 		for c := 0; c < channels; c++ {
-			dp := consumeDataPoint(payload, float64(header.VoltRange()))
-			p = append(p, dp)
+			count := consumeCount(payload)
+			p = append(p, countToVolts(count, float64(header.VoltRange())))
+			q = append(q, int64(count))
 			payload = payload[AvatarPointSize:]
 		}
 
 		// put the block into the buffer
 		ts := InterpolateTs(header.Generated().UnixNano(), j, δ)
 		data.AppendSample(p, ts)
+		ints.AppendSample(q)
+	}
+
+	var (
+		infos  = r.channelInfos(header)
+		events = r.triggerEvents(data, infos, hasTrigger)
+	)
+
+	// account for the frames that never made it
+	if gap, fill := r.checkGap(header, data, infos, int64(δ)); gap != nil {
+		events = append([]*Event{gap}, events...)
+		if fill != nil {
+			fill.Append(data)
+			data = fill
+			ints = countsOf(fill, infos)
+		}
 	}
 
 	dataFrame = &AvatarDataFrame{
 		AvatarHeader: *header,
 		data:         data,
+		ints:         ints,
+		channels:     infos,
+		events:       events,
 		received:     timeReceived,
 		crc:          crc,
 	}
@@ -195,14 +251,116 @@ func (r *avatarParser) ParseFrame() (dataFrame *AvatarDataFrame, err error) {
 	return
 }
 
+// Returns the channel descriptions for frames with the given
+// header. The descriptions rarely change, so the last ones
+// are reused as long as the header agrees with them.
+func (r *avatarParser) channelInfos(header *AvatarHeader) []*ChannelInfo {
+	if r.channels != nil && r.channelsFor == header.FieldChannels &&
+		r.voltRange == header.FieldVoltRange {
+		return r.channels
+	}
+	r.channelsFor = header.FieldChannels
+	r.voltRange = header.FieldVoltRange
+
+	// trigger channels come first, see ParseFrame()
+	r.channels = nil
+	if header.HasTriggerChannel() {
+		r.channels = append(r.channels,
+			&ChannelInfo{Label: "Optical", Kind: KindTrigger, Scale: 1},
+			&ChannelInfo{Label: "Keypad", Kind: KindTrigger, Scale: 1},
+		)
+	}
+	// the converter spans the volt range, from 0 V
+	var (
+		max   = float64(header.VoltRange()) / float64(1000)
+		scale = max / float64(AvatarAdcRange)
+		eeg   = EEGChannelInfos(header.Channels(), "V", scale)
+	)
+	for _, info := range eeg {
+		info.Max = max
+	}
+	r.channels = append(r.channels, eeg...)
+	return r.channels
+}
+
+// Turns the edges of the trigger channels into events.
+func (r *avatarParser) triggerEvents(data *BlockBuffer, infos []*ChannelInfo, hasTrigger bool) (events []*Event) {
+	if !hasTrigger {
+		return nil
+	}
+	for c := range r.triggers {
+		var e []*Event
+		e, r.triggers[c] = TriggerEvents(data, c, infos[c].Label, r.triggers[c])
+		events = append(events, e...)
+	}
+	SortEvents(events)
+	return
+}
+
+// Checks the frame count of a good frame against the last
+// one. If frames are missing, it returns a gap event and,
+// depending on the gap policy, the samples standing in for
+// the missing ones.
+func (r *avatarParser) checkGap(header *AvatarHeader, data *BlockBuffer, infos []*ChannelInfo, period int64) (gap *Event, fill *BlockBuffer) {
+	if data.Samples() == 0 {
+		return
+	}
+	var (
+		count         = header.FieldFrameCount
+		missing       = count - r.lastCount - 1 // wraps around with the counter
+		samples       = data.Samples()
+		v, _          = data.Sample(0)
+		vLast, tsLast = data.Sample(samples - 1)
+	)
+	if r.frames > 0 && missing > 0 && missing <= AvatarMaxGapFrames && len(r.last) == len(v) {
+		n := int(missing) * header.Samples()
+		reason := fmt.Sprintf("%d frames dropped, %d rejected", missing, r.rejected)
+		log.Printf("AvatarEEG: %d samples missing before frame %d: %s", n, count, reason)
+		gap = NewGapEvent(r.lastTs, n, period, "AvatarEEG", reason)
+		fill = FillGap(r.gapPolicy, r.last, r.lastTs, v, n, period, infos)
+	}
+
+	r.frames++
+	r.lastCount = count
+	r.last = append(r.last[:0], vLast...)
+	r.lastTs = tsLast
+	r.rejected = 0
+	return
+}
+
+// The counts of samples that were made up to fill a gap;
+// NaN becomes 0.
+func countsOf(b *BlockBuffer, infos []*ChannelInfo) *IntBuffer {
+	var (
+		samples = b.Samples()
+		ints    = NewIntBuffer(b.Channels(), samples)
+		q       = make([]int64, b.Channels())
+	)
+	for s := 0; s < samples; s++ {
+		v, _ := b.Sample(s)
+		for c, x := range v {
+			q[c] = 0
+			if !math.IsNaN(x) {
+				q[c] = int64(math.Floor(x/infos[c].Scale + 0.5))
+			}
+		}
+		ints.AppendSample(q)
+	}
+	return ints
+}
+
 func consumeTriggerData(payload []byte) (opticalInput float64, keypadSwitch float64) {
 	b := payload[2]
 	return float64(b & 0x01), float64(b & 0x02)
 }
 
-func consumeDataPoint(payload []byte, voltRange float64) float64 {
-	raw := uint32(payload[0])<<16 | uint32(payload[1])<<8 | uint32(payload[2])
-	return ((float64(raw) / float64(1000) / float64(AvatarAdcRange)) * voltRange)
+// The raw 24-bit count of the analog-to-digital converter.
+func consumeCount(payload []byte) uint32 {
+	return uint32(payload[0])<<16 | uint32(payload[1])<<8 | uint32(payload[2])
+}
+
+func countToVolts(count uint32, voltRange float64) float64 {
+	return ((float64(count) / float64(1000) / float64(AvatarAdcRange)) * voltRange)
 }
 
 type CrcErr struct {
@@ -4,6 +4,7 @@
 package mock_avatar
 
 import (
+	"context"
 	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/device"
 	. "github.com/jbrukh/goavatar/etc"
@@ -24,8 +25,14 @@ type MockDevice struct {
 	repo     *Repository
 	obfFile  string
 	channels int
+	infos    []*ChannelInfo
+
+	config DeviceConfig // the settings of the stream
 }
 
+// The mock device supports the sample rates of the AvatarEEG.
+var MockSampleRates = []int{250, 500, 1000}
+
 // Mock AvatarEEG device that plays pre-recorded frames on
 // repeat. The frames are specified as an OBF file.
 func NewMockDevice(basedir string, obfFile string, channels int) Device {
@@ -38,10 +45,11 @@ func NewMockDevice(basedir string, obfFile string, channels int) Device {
 		repo:     NewRepositoryOrPanic(basedir),
 		obfFile:  obfFile,
 		channels: channels,
+		infos:    EEGChannelInfos(channels, "V", 1),
 	})
 }
 
-func (d *MockDevice) Engage() (err error) {
+func (d *MockDevice) Engage(ctx context.Context) (err error) {
 	d.frames, err = MockDataFrames(d.obfFile)
 	if err != nil {
 		return err
@@ -58,21 +66,61 @@ func (d *MockDevice) Stream(c *Control) (err error) {
 
 	// send device info
 	c.SendInfo(&DeviceInfo{
-		Channels:   d.channels,
-		SampleRate: 250,
+		Channels:   len(d.infos),
+		SampleRate: d.sampleRate(),
 	})
 
 	for {
-		if c.ShouldTerminate() {
-			return nil
-		}
 		frame := d.getFrame(tick)
 		//arr, _ := frame.Buffer().Arrays()
 		//log.Printf("sending frame %d: %v", tick, arr)
 		c.Send(frame)
 		tick = (tick + 1) % len(d.frames)
-		time.Sleep(time.Millisecond * 64) // 15.625 fps == 1 frame every 64 milliseconds
+
+		// at 250 Hz, 15.625 fps == 1 frame every 64 milliseconds
+		wait := time.Duration(frame.Buffer().Samples()) * d.period()
+		select {
+		case <-c.Context().Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// The mock device supports any number of data channels up
+// to the channels parameter, and trigger channels, which
+// are always off.
+func (d *MockDevice) Capabilities() *DeviceCapabilities {
+	return &DeviceCapabilities{
+		SampleRates: MockSampleRates,
+		Channels:    d.channels,
+		Trigger:     true,
+	}
+}
+
+// Configure the mock device.
+func (d *MockDevice) Configure(cfg DeviceConfig) error {
+	d.config = cfg
+	d.infos = nil
+	if cfg.Trigger {
+		d.infos = append(d.infos,
+			&ChannelInfo{Label: "Optical", Kind: KindTrigger, Scale: 1},
+			&ChannelInfo{Label: "Keypad", Kind: KindTrigger, Scale: 1},
+		)
 	}
+	eeg := EEGChannelInfos(d.channels, "V", 1)
+	for _, c := range d.Capabilities().DataChannels(cfg) {
+		d.infos = append(d.infos, eeg[c])
+	}
+	return nil
+}
+
+func (d *MockDevice) sampleRate() int {
+	return d.Capabilities().SampleRate(d.config)
+}
+
+func (d *MockDevice) period() time.Duration {
+	return time.Second / time.Duration(d.sampleRate())
 }
 
 func (d *MockDevice) ProvideRecorder() Recorder {
@@ -99,31 +147,42 @@ func (d *MockDevice) getFrame(tick int) DataFrame {
 		now   = time.Now().UnixNano()
 		frame = d.frames[tick]
 		b     = frame.Buffer()
-		δ     = time.Millisecond * 4
+		δ     = d.period()
 	)
 	bb := d.transformBuffer(b)
 	bb.TransformTs(func(s int, ts int64) int64 {
 		return InterpolateTs(now, s, δ)
 	})
-	return NewDataFrame(bb, frame.SampleRate())
+	return NewDataFrameWithChannels(bb, d.sampleRate(), d.infos)
 }
 
 // Appends (or reduces) some channels to the BlockBuffer depending
-// on the channels parameter. TODO: create AppendChannel
-// method in BlockBuffer.
-func (d *MockDevice) transformBuffer(b *BlockBuffer) (bb *BlockBuffer) {
-	bb = b
-	if d.channels != b.Channels() {
-		bb = NewBlockBuffer(d.channels, b.Samples())
-		samples := b.Samples()
-		for s := 0; s < samples; s++ {
-			v, t := b.Sample(s)
-			vv := make([]float64, d.channels)
-			for i := range vv {
-				vv[i] = v[i%len(v)]
-			}
-			bb.AppendSample(vv, t)
+// on the channels parameter, by repeating the recorded channels,
+// and then selects the configured ones, after the trigger channels,
+// if any.
+func (d *MockDevice) transformBuffer(b *BlockBuffer) *BlockBuffer {
+	var (
+		dataChannels = d.Capabilities().DataChannels(d.config)
+		cs           = make([]int, len(dataChannels))
+	)
+	for i, c := range dataChannels {
+		cs[i] = c % b.Channels()
+	}
+	if !d.config.Trigger {
+		return b.SelectChannels(cs...)
+	}
+
+	var (
+		samples = b.Samples()
+		bb      = NewBlockBuffer(len(cs)+2, samples+1)
+		p       = make([]float64, len(cs)+2)
+	)
+	for s := 0; s < samples; s++ {
+		v, ts := b.Sample(s)
+		for i, c := range cs {
+			p[i+2] = v[c]
 		}
+		bb.AppendSample(p, ts)
 	}
-	return
+	return bb
 }
@@ -6,10 +6,12 @@ package drivers
 import (
 	"flag"
 	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/device"
 	. "github.com/jbrukh/goavatar/drivers/avatar"
 	. "github.com/jbrukh/goavatar/drivers/mock_avatar"
 	. "github.com/jbrukh/goavatar/drivers/thinkgear"
+	"time"
 )
 
 const (
@@ -18,6 +20,8 @@ const (
 	DefaultMockFile     = "etc/1fabece1-7a57-96ab-3de9-71da8446c52c"
 	DefaultMockChannels = 4
 	DefaultDevice       = "avatar"
+	DefaultGapPolicy    = "mark"
+	DefaultHistoryMs    = int(DefaultHistory / time.Millisecond)
 )
 
 var (
@@ -27,6 +31,9 @@ var (
 	mockFile     *string = flag.String("mockFile", DefaultMockFile, "OBF file to play back in the mock device")
 	mockChannels *int    = flag.Int("mockChannels", DefaultMockChannels, "the number of channels to mock in the mock device")
 	device       *string = flag.String("device", DefaultDevice, "one of {'avatar', 'mock_avatar', 'thinkgear'}")
+	gapPolicy    *string = flag.String("gapPolicy", DefaultGapPolicy, "what to do about dropped frames, one of {'mark', 'nan', 'interpolate'}")
+	reconnect    *bool   = flag.Bool("reconnect", false, "whether to reconnect to the device when its stream fails")
+	historyMs    *int    = flag.Int("historyMs", DefaultHistoryMs, "milliseconds of the stream to keep, so that recordings may start in the past")
 )
 
 // devices
@@ -52,22 +59,35 @@ func provide(device string) (Device, error) {
 // Convenience function for working with the
 // command line.
 func ProvideDevice() (Device, error) {
-	initialize()
+	if err := initialize(); err != nil {
+		return nil, err
+	}
 	if *mockDevice {
 		return provide("mock_avatar")
 	}
 	return provide(*device)
 }
 
-func initialize() {
+func initialize() error {
 	if !flag.Parsed() {
 		flag.Parse()
 	}
 	if deviceMap == nil {
+		policy, err := ParseGapPolicy(*gapPolicy)
+		if err != nil {
+			return err
+		}
 		deviceMap = map[string]Device{
-			"avatar":      NewAvatarDevice(*repo, *port),
+			"avatar":      NewAvatarDeviceWithGapPolicy(*repo, *port, policy),
 			"mock_avatar": NewMockDevice(*repo, *mockFile, *mockChannels),
 			"thinkgear":   NewThinkGearDevice(*repo, *port),
 		}
+		for _, dev := range deviceMap {
+			if *reconnect {
+				dev.SetReconnectPolicy(DefaultReconnectPolicy())
+			}
+			dev.SetHistory(time.Duration(*historyMs) * time.Millisecond)
+		}
 	}
+	return nil
 }
@@ -4,12 +4,12 @@
 package thinkgear
 
 import (
+	"context"
 	. "github.com/jbrukh/goavatar/device"
 	. "github.com/jbrukh/goavatar/obf/recorder"
 	. "github.com/jbrukh/goavatar/repo"
 	"io"
 	"log"
-	"os"
 )
 
 // ----------------------------------------------------------------- //
@@ -31,8 +31,8 @@ func NewThinkGearDevice(basedir, serialPort string) Device {
 	})
 }
 
-func (d *ThinkGearDevice) Engage() (err error) {
-	d.reader, err = os.Open(d.serialPort)
+func (d *ThinkGearDevice) Engage(ctx context.Context) (err error) {
+	d.reader, err = OpenPort(ctx, d.serialPort)
 	return
 }
 
@@ -57,7 +57,8 @@ func (d *ThinkGearDevice) Stream(c *Control) (err error) {
 }
 
 func parseByteStream(reader io.ReadCloser, c *Control) (err error) {
-	parser := NewThinkGearParser(reader)
+	parser := NewThinkGearParser(c.Metrics().CountingReader(reader))
+	parser.metrics = c.Metrics()
 
 	c.SendInfo(&DeviceInfo{
 		SampleRate: 512,
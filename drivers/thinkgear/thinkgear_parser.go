@@ -6,6 +6,7 @@ package thinkgear
 import (
 	"bufio"
 	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
 	"io"
 	"log"
 )
@@ -26,6 +27,18 @@ const MaxPayloadLength = 169
 
 const SamplePeriod = 1953125 // 1/512 (in nanos)
 
+// The ThinkGear headsets have a single dry electrode
+// on the forehead and report raw ADC counts.
+var thinkGearChannels = []*ChannelInfo{
+	&ChannelInfo{
+		Label:    "Raw",
+		Kind:     KindEEG,
+		Unit:     "count",
+		Scale:    1,
+		Position: "Fp1",
+	},
+}
+
 // protocol symbols
 const (
 	SYNC           = 0xAA
@@ -38,15 +51,17 @@ const (
 // ----------------------------------------------------------------- //
 
 type thinkGearParser struct {
-	reader *bufio.Reader // reader of the stream
-	ts     int64
+	reader  *bufio.Reader // reader of the stream
+	ts      int64
+	metrics *Metrics // counts the rejected packets
 }
 
 // create a new parser
-func NewThinkGearParser(reader io.ReadCloser) *thinkGearParser {
+func NewThinkGearParser(reader io.Reader) *thinkGearParser {
 	br := bufio.NewReader(reader)
 	return &thinkGearParser{
-		reader: br,
+		reader:  br,
+		metrics: NewMetrics(),
 	}
 }
 
@@ -78,6 +93,7 @@ syncLength: // using a label makes code 2 lines shorter :)
 		goto syncLength
 	}
 	if plen > MaxPayloadLength {
+		p.metrics.AddSizeError()
 		goto syncUp
 	}
 
@@ -103,6 +119,7 @@ syncLength: // using a label makes code 2 lines shorter :)
 	stated := p.next()
 	if checksum != stated {
 		log.Printf("checksum has failed: expected %v but got %v", checksum, stated)
+		p.metrics.AddCrcError()
 		goto syncUp
 	}
 
@@ -116,14 +133,18 @@ syncLength: // using a label makes code 2 lines shorter :)
 		panic("expecting two bytes in the raw value")
 	}
 
-	b := NewBlockBuffer(1, 1)
-	v := float64(int16(payload[2])<<8 | int16(payload[3]))
+	var (
+		b    = NewBlockBuffer(1, 1)
+		ints = NewIntBuffer(1, 1)
+		raw  = int16(payload[2])<<8 | int16(payload[3])
+	)
 	b.AppendSample(
-		[]float64{v},
+		[]float64{float64(raw)},
 		p.ts,
 	)
+	ints.AppendSample([]int64{int64(raw)})
 	p.ts += SamplePeriod
-	df = NewDataFrame(b, SampleRate)
+	df = NewDataFrameWithInts(b, ints, SampleRate, thinkGearChannels, nil)
 
 	return
 }
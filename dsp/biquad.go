@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	"math"
+)
+
+// ----------------------------------------------------------------- //
+// Biquads -- second-order IIR sections
+// ----------------------------------------------------------------- //
+
+// biquad is a second-order IIR section in transposed direct
+// form II, normalized so that a0 = 1. It computes
+// y[n] = b0*x[n] + b1*x[n-1] + b2*x[n-2] - a1*y[n-1] - a2*y[n-2]
+// and keeps a separate state for every channel.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             []float64 // per-channel state
+}
+
+func (q *biquad) step(v []float64) {
+	if len(q.z1) != len(v) {
+		q.z1 = make([]float64, len(v))
+		q.z2 = make([]float64, len(v))
+	}
+	for c, x := range v {
+		y := q.b0*x + q.z1[c]
+		q.z1[c] = q.b1*x - q.a1*y + q.z2[c]
+		q.z2[c] = q.b2*x - q.a2*y
+		v[c] = y
+	}
+}
+
+func (q *biquad) reset() {
+	q.z1, q.z2 = nil, nil
+}
+
+// Normalize the coefficients of a section by a0.
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *biquad {
+	return &biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+	}
+}
+
+// The following designs are from R. Bristow-Johnson's
+// "Cookbook formulae for audio EQ biquad filter coefficients".
+
+func lowPassBiquad(sampleRate int, f0, q float64) *biquad {
+	w0, alpha := biquadParams(sampleRate, f0, q)
+	cos := math.Cos(w0)
+	return newBiquad((1-cos)/2, 1-cos, (1-cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+func highPassBiquad(sampleRate int, f0, q float64) *biquad {
+	w0, alpha := biquadParams(sampleRate, f0, q)
+	cos := math.Cos(w0)
+	return newBiquad((1+cos)/2, -(1 + cos), (1+cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+func bandPassBiquad(sampleRate int, f0, q float64) *biquad {
+	w0, alpha := biquadParams(sampleRate, f0, q)
+	cos := math.Cos(w0)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*cos, 1-alpha)
+}
+
+func notchBiquad(sampleRate int, f0, q float64) *biquad {
+	w0, alpha := biquadParams(sampleRate, f0, q)
+	cos := math.Cos(w0)
+	return newBiquad(1, -2*cos, 1, 1+alpha, -2*cos, 1-alpha)
+}
+
+// First-order sections, by the bilinear transform, for
+// odd-order Butterworth filters.
+
+func lowPassFirstOrder(sampleRate int, f0 float64) *biquad {
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	return newBiquad(k, k, 0, k+1, k-1, 0)
+}
+
+func highPassFirstOrder(sampleRate int, f0 float64) *biquad {
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	return newBiquad(1, -1, 0, k+1, k-1, 0)
+}
+
+func biquadParams(sampleRate int, f0, q float64) (w0, alpha float64) {
+	w0 = 2 * math.Pi * f0 / float64(sampleRate)
+	alpha = math.Sin(w0) / (2 * q)
+	return
+}
+
+// ----------------------------------------------------------------- //
+// Butterworth and Notch Filters
+// ----------------------------------------------------------------- //
+
+// Create a Butterworth low-pass filter of the given order
+// with the given cutoff frequency (in Hz).
+func NewButterworthLowPass(order, sampleRate int, cutoff float64) Filter {
+	checkFrequency(sampleRate, cutoff)
+	return newStageFilter(butterworth(order, func(q float64) stage {
+		return lowPassBiquad(sampleRate, cutoff, q)
+	}, func() stage {
+		return lowPassFirstOrder(sampleRate, cutoff)
+	})...)
+}
+
+// Create a Butterworth high-pass filter of the given order
+// with the given cutoff frequency (in Hz).
+func NewButterworthHighPass(order, sampleRate int, cutoff float64) Filter {
+	checkFrequency(sampleRate, cutoff)
+	return newStageFilter(butterworth(order, func(q float64) stage {
+		return highPassBiquad(sampleRate, cutoff, q)
+	}, func() stage {
+		return highPassFirstOrder(sampleRate, cutoff)
+	})...)
+}
+
+// Create a Butterworth band-pass filter passing frequencies
+// between low and high (in Hz), made of a high-pass and a
+// low-pass filter of the given order.
+func NewButterworthBandPass(order, sampleRate int, low, high float64) Filter {
+	if low >= high {
+		panic(fmt.Sprintf("bad band: [%v, %v]", low, high))
+	}
+	hp := NewButterworthHighPass(order, sampleRate, low).(*stageFilter)
+	lp := NewButterworthLowPass(order, sampleRate, high).(*stageFilter)
+	return newStageFilter(append(hp.stages, lp.stages...)...)
+}
+
+// Create a notch filter that removes the frequency f0 (in Hz).
+// The quality q determines the width of the notch, which is
+// f0/q Hz.
+func NewNotch(sampleRate int, f0, q float64) Filter {
+	checkFrequency(sampleRate, f0)
+	return newStageFilter(notchBiquad(sampleRate, f0, q))
+}
+
+// Create a band-pass biquad resonator centered around f0 (in
+// Hz) with bandwidth f0/q Hz and unit gain at f0.
+func NewResonator(sampleRate int, f0, q float64) Filter {
+	checkFrequency(sampleRate, f0)
+	return newStageFilter(bandPassBiquad(sampleRate, f0, q))
+}
+
+// Cascade the second-order sections of a Butterworth filter,
+// adding a first-order section when the order is odd.
+func butterworth(order int, section func(q float64) stage, first func() stage) (stages []stage) {
+	if order < 1 {
+		panic(fmt.Sprintf("bad filter order: %d", order))
+	}
+	for k := 1; k <= order/2; k++ {
+		q := 1 / (2 * math.Sin(float64(2*k-1)*math.Pi/float64(2*order)))
+		stages = append(stages, section(q))
+	}
+	if order%2 == 1 {
+		stages = append(stages, first())
+	}
+	return
+}
+
+// Frequencies must lie strictly between 0 and Nyquist.
+func checkFrequency(sampleRate int, f float64) {
+	if f <= 0 || f >= float64(sampleRate)/2 {
+		panic(fmt.Sprintf("frequency %v is out of range for sample rate %d", f, sampleRate))
+	}
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+)
+
+// ----------------------------------------------------------------- //
+// Decimator -- anti-aliased down-sampling
+// ----------------------------------------------------------------- //
+
+const (
+	DecimatorCutoff      = 0.8 // fraction of the output Nyquist frequency that is kept
+	DecimatorTapsPerRate = 10  // FIR taps per unit of decimation
+)
+
+// Decimator reduces the sample rate of a stream by an integer
+// factor. Unlike plucking 1 out of every k samples (see
+// BlockBuffer.PopDownSample), it first removes the frequencies
+// that the lower rate cannot represent with a linear-phase FIR
+// low-pass filter, so they do not alias into the output. Its
+// state carries across calls, so a stream may be decimated one
+// DataFrame at a time.
+//
+// The output timestamps account for the delay of the filter,
+// so the first few input samples produce no output.
+type Decimator struct {
+	sampleRate int
+	factor     int
+	taps       []float64
+	delay      int // delay of the filter, in samples
+
+	parity  int         // position within the current block of factor samples
+	seen    int         // number of samples taken in, up to len(taps)
+	pos     int         // position of the newest input in the delay lines
+	history [][]float64 // per-channel circular delay lines
+	ts      []int64     // circular delay line of timestamps
+	scratch []float64
+}
+
+// Create a new Decimator that reduces the given sample rate
+// by the given factor.
+func NewDecimator(sampleRate, factor int) *Decimator {
+	if factor < 1 || sampleRate < factor {
+		panic(fmt.Sprintf("bad parameters: sampleRate (%d); factor (%d)", sampleRate, factor))
+	}
+	d := &Decimator{sampleRate: sampleRate, factor: factor}
+	if factor > 1 {
+		n := DecimatorTapsPerRate*factor + 1 // odd, so the delay is whole
+		d.taps = LowPassTaps(DecimatorCutoff/float64(2*factor), n)
+		d.delay = (n - 1) / 2
+	} else {
+		d.taps = []float64{1}
+	}
+	return d
+}
+
+// The sample rate of the input.
+func (d *Decimator) SampleRate() int {
+	return d.sampleRate
+}
+
+// The decimation factor.
+func (d *Decimator) Factor() int {
+	return d.factor
+}
+
+// Decimate filters and down-samples the buffer, returning the
+// samples at the lower rate.
+func (d *Decimator) Decimate(b *BlockBuffer) *BlockBuffer {
+	var (
+		channels = b.Channels()
+		samples  = b.Samples()
+		n        = len(d.taps)
+		bb       = NewBlockBuffer(channels, samples/d.factor+1)
+	)
+	if len(d.history) != channels {
+		d.Reset()
+		d.history = make([][]float64, channels)
+		for c := range d.history {
+			d.history[c] = make([]float64, n)
+		}
+		d.ts = make([]int64, n)
+		d.scratch = make([]float64, channels)
+	}
+
+	for s := 0; s < samples; s++ {
+		v, ts := b.Sample(s)
+
+		// take the sample into the delay lines
+		d.pos = (d.pos + 1) % n
+		for c, x := range v {
+			d.history[c][d.pos] = x
+		}
+		d.ts[d.pos] = ts
+		if d.seen < n {
+			d.seen++
+		}
+
+		// only compute the samples we keep, once the
+		// filter has seen enough input to know their time
+		keep := d.parity == 0
+		d.parity = (d.parity + 1) % d.factor
+		if !keep || d.seen <= d.delay {
+			continue
+		}
+		for c := range d.scratch {
+			d.scratch[c] = d.convolve(d.history[c])
+		}
+		bb.AppendSample(d.scratch, d.ts[(d.pos-d.delay+n)%n])
+	}
+	return bb
+}
+
+// Forget the state of the Decimator.
+func (d *Decimator) Reset() {
+	d.parity = 0
+	d.seen = 0
+	d.pos = 0
+	for _, h := range d.history {
+		for i := range h {
+			h[i] = 0
+		}
+	}
+}
+
+// y[n] = sum_k taps[k]*x[n-k]
+func (d *Decimator) convolve(h []float64) (y float64) {
+	i := d.pos
+	for _, t := range d.taps {
+		y += t * h[i]
+		if i == 0 {
+			i = len(h)
+		}
+		i--
+	}
+	return
+}
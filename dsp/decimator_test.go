@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"testing"
+)
+
+func decimateInChunks(d *Decimator, b *BlockBuffer) *BlockBuffer {
+	out := NewBlockBuffer(b.Channels(), b.Samples())
+	for from := 0; from < b.Samples(); from += 16 {
+		to := from + 16
+		if to > b.Samples() {
+			to = b.Samples()
+		}
+		out.Append(d.Decimate(b.Slice(from, to)))
+	}
+	return out
+}
+
+func TestDecimator__RemovesAliases(t *testing.T) {
+	// 40 Hz would alias to 10 Hz at 50 Hz
+	d := NewDecimator(testRate, 5)
+	out := decimateInChunks(d, sineBuffer(2, 1000, 0, 40, 1))
+	if p := peak(out, 1, 20); p > 0.01 {
+		t.Errorf("alias not removed: %v", p)
+	}
+}
+
+func TestDecimator__KeepsPassband(t *testing.T) {
+	d := NewDecimator(testRate, 5)
+	out := decimateInChunks(d, sineBuffer(1, 1000, 0, 5, 1))
+	if out.Samples() < 190 || out.Samples() > 200 {
+		t.Errorf("wrong number of samples: %d", out.Samples())
+	}
+
+	// the timestamps account for the delay of the filter
+	for s := 20; s < out.Samples(); s++ {
+		v, ts := out.Sample(s)
+		expected := math.Sin(2 * math.Pi * 5 * float64(ts) / 1e9)
+		if math.Abs(v[0]-expected) > 0.02 {
+			t.Fatalf("wrong value at %d: %v, expected %v", s, v[0], expected)
+		}
+	}
+}
+
+func TestDecimator__FactorOne(t *testing.T) {
+	var (
+		d  = NewDecimator(testRate, 1)
+		b  = sineBuffer(2, 50, 0, 10, 1)
+		bb = decimateInChunks(d, b)
+	)
+	if bb.Samples() != b.Samples() {
+		t.Fatalf("wrong number of samples: %d", bb.Samples())
+	}
+	for s := 0; s < b.Samples(); s++ {
+		v1, ts1 := b.Sample(s)
+		v2, ts2 := bb.Sample(s)
+		if v1[0] != v2[0] || ts1 != ts2 {
+			t.Errorf("should pass through")
+		}
+	}
+}
+
+func TestDecimator__BadParameters(t *testing.T) {
+	AssertPanic(t, func() {
+		NewDecimator(testRate, 0)
+	})
+	AssertPanic(t, func() {
+		NewDecimator(4, 5)
+	})
+}
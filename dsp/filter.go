@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	"math"
+)
+
+// ----------------------------------------------------------------- //
+// Filter -- stateful multi-channel digital filters
+// ----------------------------------------------------------------- //
+
+// Filter is a stateful digital filter that works on multi-channel
+// BlockBuffers, filtering each channel independently. Successive
+// calls to Filter() are treated as one continuous signal, so the
+// filter state carries across DataFrame boundaries. Samples with
+// a NaN, which stand in for missing ones (see GapNaN), pass through
+// unchanged, and the filter starts over after them, so that a gap
+// does not spread into the rest of the signal.
+type Filter interface {
+	// Filter the buffer, returning a new buffer with the
+	// same channels and timestamps.
+	Filter(b *BlockBuffer) *BlockBuffer
+
+	// Forget the state of the filter, for instance when
+	// the signal is discontinuous.
+	Reset()
+}
+
+// A stage processes a single multi-channel sample in place.
+// Filters made up of stages only allocate their output.
+type stage interface {
+	step(v []float64)
+	reset()
+}
+
+// stageFilter is a Filter made of a cascade of stages.
+type stageFilter struct {
+	stages  []stage
+	scratch []float64
+}
+
+func newStageFilter(stages ...stage) *stageFilter {
+	return &stageFilter{stages: stages}
+}
+
+func (f *stageFilter) Filter(b *BlockBuffer) *BlockBuffer {
+	var (
+		channels = b.Channels()
+		samples  = b.Samples()
+		bb       = NewBlockBuffer(channels, samples+1)
+	)
+	if len(f.scratch) != channels {
+		f.scratch = make([]float64, channels)
+	}
+	for s := 0; s < samples; s++ {
+		v, ts := b.Sample(s)
+		if hasNaN(v) {
+			f.Reset()
+			bb.AppendSample(v, ts)
+			continue
+		}
+		copy(f.scratch, v)
+		for _, st := range f.stages {
+			st.step(f.scratch)
+		}
+		bb.AppendSample(f.scratch, ts)
+	}
+	return bb
+}
+
+func (f *stageFilter) Reset() {
+	for _, st := range f.stages {
+		st.reset()
+	}
+}
+
+func hasNaN(v []float64) bool {
+	for _, x := range v {
+		if math.IsNaN(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------- //
+// Chains
+// ----------------------------------------------------------------- //
+
+// A Chain applies its filters one after another.
+type Chain []Filter
+
+// Create a new filter chain.
+func NewChain(filters ...Filter) Chain {
+	return Chain(filters)
+}
+
+func (c Chain) Filter(b *BlockBuffer) *BlockBuffer {
+	for _, f := range c {
+		b = f.Filter(b)
+	}
+	return b
+}
+
+func (c Chain) Reset() {
+	for _, f := range c {
+		f.Reset()
+	}
+}
+
+// ----------------------------------------------------------------- //
+// Filtering DataFrames and Subscriptions
+// ----------------------------------------------------------------- //
+
+// FilterFrame filters the buffer of a DataFrame and returns a new
+// DataFrame. If the channels of the frame are described, only the
+// EEG channels are filtered; trigger and auxiliary channels pass
+// through unchanged. The filtered channels lose their range.
+func FilterFrame(f Filter, df DataFrame) DataFrame {
+	var (
+		b     = df.Buffer()
+		bb    = f.Filter(b)
+		infos = df.ChannelInfos()
+	)
+	for c, info := range infos {
+		if info.Kind == KindEEG || c >= b.Channels() {
+			continue
+		}
+		for s := 0; s < bb.Samples(); s++ {
+			v, _ := b.Sample(s)
+			vv, _ := bb.Sample(s)
+			vv[c] = v[c]
+		}
+	}
+	return NewDataFrameWithEvents(bb, df.SampleRate(), Unranged(infos), df.Events())
+}
+
+// SubscribeFiltered subscribes to the device under the given name
+// and returns a channel of filtered DataFrames. The channel is closed
+// when the subscription ends, for instance by calling Unsubscribe()
+// with the same name on the device. The filter should not be shared
+// with other subscriptions.
+func SubscribeFiltered(d Device, name string, f Filter) (chan DataFrame, error) {
+	return d.SubscribeProcessed(name, DeliverBlock, NewFilterProcessor(f))
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"testing"
+)
+
+const testRate = 250
+
+// A buffer with a sum of sines (given by frequency and
+// amplitude) plus an offset on every channel.
+func sineBuffer(channels, samples int, offset float64, sines ...float64) *BlockBuffer {
+	b := NewBlockBuffer(channels, samples)
+	v := make([]float64, channels)
+	for s := 0; s < samples; s++ {
+		t := float64(s) / testRate
+		x := offset
+		for i := 0; i+1 < len(sines); i += 2 {
+			x += sines[i+1] * math.Sin(2*math.Pi*sines[i]*t)
+		}
+		for c := range v {
+			v[c] = x
+		}
+		b.AppendSample(v, int64(s)*4000000)
+	}
+	return b
+}
+
+// Filter the buffer in chunks of 16 samples, like
+// the frames of a device.
+func filterInChunks(f Filter, b *BlockBuffer) *BlockBuffer {
+	out := NewBlockBuffer(b.Channels(), b.Samples())
+	for from := 0; from < b.Samples(); from += 16 {
+		to := from + 16
+		if to > b.Samples() {
+			to = b.Samples()
+		}
+		out.Append(f.Filter(b.Slice(from, to)))
+	}
+	return out
+}
+
+// Peak amplitude of channel c after skipping the transient.
+func peak(b *BlockBuffer, c, skip int) (p float64) {
+	for s := skip; s < b.Samples(); s++ {
+		v, _ := b.Sample(s)
+		p = math.Max(p, math.Abs(v[c]))
+	}
+	return
+}
+
+func TestNotch60(t *testing.T) {
+	b := filterInChunks(Notch60(testRate), sineBuffer(2, 2000, 0, 60, 1))
+	if p := peak(b, 1, 1000); p > 0.01 {
+		t.Errorf("60 Hz was not removed: %v", p)
+	}
+
+	b = filterInChunks(Notch60(testRate), sineBuffer(2, 2000, 0, 10, 1))
+	if p := peak(b, 0, 1000); p < 0.95 {
+		t.Errorf("10 Hz should have passed: %v", p)
+	}
+}
+
+func TestNotch60__LowRate(t *testing.T) {
+	var (
+		b = sineBuffer(2, 200, 0, 10, 1)
+		f = Notch60(100).Filter(sineBuffer(2, 200, 0, 10, 1))
+	)
+	for s := 0; s < b.Samples(); s++ {
+		v, _ := b.Sample(s)
+		if w, _ := f.Sample(s); v[0] != w[0] {
+			t.Fatalf("the notch should pass through below 120 Hz")
+		}
+	}
+
+	// the cleanup chain still removes the offset
+	f = filterInChunks(Clean(100, 60), sineBuffer(1, 2000, 5))
+	if p := peak(f, 0, 1000); p > 0.01 {
+		t.Errorf("offset was not removed: %v", p)
+	}
+}
+
+func TestHighPass__RemovesOffset(t *testing.T) {
+	b := filterInChunks(HighPass(testRate, DefaultHighPass), sineBuffer(1, 5000, 3, 10, 1))
+	if p := peak(b, 0, 4000); p > 1.05 || p < 0.95 {
+		t.Errorf("offset was not removed: %v", p)
+	}
+}
+
+func TestBandPass(t *testing.T) {
+	f := BandPass(testRate, 4, 30)
+	if p := peak(filterInChunks(f, sineBuffer(1, 2000, 0, 10, 1)), 0, 1000); p < 0.95 {
+		t.Errorf("10 Hz should have passed: %v", p)
+	}
+	f.Reset()
+	if p := peak(filterInChunks(f, sineBuffer(1, 2000, 0, 90, 1)), 0, 1000); p > 0.01 {
+		t.Errorf("90 Hz should have been removed: %v", p)
+	}
+	f.Reset()
+	if p := peak(filterInChunks(f, sineBuffer(1, 2000, 0, 0.5, 1)), 0, 1000); p > 0.01 {
+		t.Errorf("0.5 Hz should have been removed: %v", p)
+	}
+}
+
+func TestButterworth__OddOrder(t *testing.T) {
+	f := NewButterworthLowPass(3, testRate, 20)
+	if p := peak(filterInChunks(f, sineBuffer(1, 2000, 0, 5, 1)), 0, 1000); p < 0.99 {
+		t.Errorf("5 Hz should have passed: %v", p)
+	}
+	f.Reset()
+	if p := peak(filterInChunks(f, sineBuffer(1, 2000, 0, 80, 1)), 0, 1000); p > 0.05 {
+		t.Errorf("80 Hz should have been removed: %v", p)
+	}
+}
+
+func TestFIRLowPass(t *testing.T) {
+	f := NewFIRLowPass(testRate, 30, 61)
+	if p := peak(filterInChunks(f, sineBuffer(1, 1000, 0, 5, 1)), 0, 100); p < 0.98 {
+		t.Errorf("5 Hz should have passed: %v", p)
+	}
+	f.Reset()
+	if p := peak(filterInChunks(f, sineBuffer(1, 1000, 0, 100, 1)), 0, 100); p > 0.01 {
+		t.Errorf("100 Hz should have been removed: %v", p)
+	}
+}
+
+func TestFilter__StateAcrossBuffers(t *testing.T) {
+	var (
+		b     = sineBuffer(2, 500, 1, 10, 1, 60, 0.5)
+		whole = Clean(testRate, 60).Filter(b)
+		parts = filterInChunks(Clean(testRate, 60), b)
+	)
+	for s := 0; s < b.Samples(); s++ {
+		v1, ts1 := whole.Sample(s)
+		v2, ts2 := parts.Sample(s)
+		if math.Abs(v1[0]-v2[0]) > 1e-12 || ts1 != ts2 {
+			t.Fatalf("chunked filtering differs at sample %d: %v != %v", s, v1, v2)
+		}
+	}
+}
+
+func TestFilter__RecoversAfterGap(t *testing.T) {
+	var (
+		b   = sineBuffer(1, 2000, 0, 10, 1, 60, 1)
+		p   = NewFilterProcessor(Notch60(testRate))
+		out = NewBlockBuffer(1, b.Samples())
+	)
+	for from := 0; from < b.Samples(); from += 16 {
+		df := NewDataFrame(b.Slice(from, from+16), testRate)
+
+		// one frame stands in NaN for missing samples
+		if from == 160 {
+			gap := NewBlockBuffer(1, 16)
+			for _, ts := range df.Buffer().Timestamps() {
+				gap.AppendSample([]float64{math.NaN()}, ts)
+			}
+			df = NewDataFrame(gap, testRate)
+		}
+		out.Append(p.Process(df).Buffer())
+	}
+
+	if v, _ := out.Sample(170); !math.IsNaN(v[0]) {
+		t.Errorf("the gap should stay NaN: %v", v)
+	}
+	for s := 176; s < out.Samples(); s++ {
+		if v, _ := out.Sample(s); math.IsNaN(v[0]) {
+			t.Fatalf("NaN after the gap at sample %d", s)
+		}
+	}
+	if p := peak(out, 0, 1000); p > 1.05 || p < 0.95 {
+		t.Errorf("the filter did not recover after the gap: %v", p)
+	}
+}
+
+func TestFilterFrame__SkipsTriggers(t *testing.T) {
+	infos := append([]*ChannelInfo{&ChannelInfo{Label: "Keypad", Kind: KindTrigger}}, EEGChannelInfos(1, "V", 1)...)
+	b := NewBlockBuffer(2, 2)
+	b.AppendSample([]float64{2, 5}, 0)
+	b.AppendSample([]float64{2, 5}, 1)
+
+	df := FilterFrame(HighPass(testRate, 1), NewDataFrameWithChannels(b, testRate, infos))
+	v, _ := df.Buffer().Sample(1)
+	if v[0] != 2 {
+		t.Errorf("trigger channel should not be filtered: %v", v)
+	}
+	if v[1] == 5 {
+		t.Errorf("eeg channel should be filtered: %v", v)
+	}
+	if len(df.ChannelInfos()) != 2 {
+		t.Errorf("channel infos should carry over")
+	}
+}
+
+func TestFilter__BadParameters(t *testing.T) {
+	AssertPanic(t, func() {
+		NewNotch(testRate, 125, 30)
+	})
+	AssertPanic(t, func() {
+		NewButterworthLowPass(0, testRate, 10)
+	})
+	AssertPanic(t, func() {
+		BandPass(testRate, 12, 8)
+	})
+}
+
+// For testing panics.
+func AssertPanic(t *testing.T, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			// ok
+		}
+	}()
+	f()
+	t.Errorf("should have panicked")
+}
@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	"math"
+)
+
+// ----------------------------------------------------------------- //
+// FIR Filters
+// ----------------------------------------------------------------- //
+
+// fir is a finite impulse response filter with a separate
+// delay line for every channel.
+type fir struct {
+	taps    []float64
+	history [][]float64 // per-channel circular delay line
+	pos     int         // position of the newest input
+}
+
+func (f *fir) step(v []float64) {
+	n := len(f.taps)
+	if len(f.history) != len(v) {
+		f.history = make([][]float64, len(v))
+		for c := range f.history {
+			f.history[c] = make([]float64, n)
+		}
+		f.pos = 0
+	}
+	f.pos = (f.pos + 1) % n
+	for c, x := range v {
+		h := f.history[c]
+		h[f.pos] = x
+
+		// y[n] = sum_k taps[k]*x[n-k]
+		var y float64
+		i := f.pos
+		for _, t := range f.taps {
+			y += t * h[i]
+			if i == 0 {
+				i = n
+			}
+			i--
+		}
+		v[c] = y
+	}
+}
+
+func (f *fir) reset() {
+	f.history = nil
+}
+
+// Create an FIR filter with the given taps (the
+// impulse response).
+func NewFIR(taps []float64) Filter {
+	if len(taps) < 1 {
+		panic("an FIR filter needs at least one tap")
+	}
+	return newStageFilter(&fir{taps: taps})
+}
+
+// Create a linear-phase FIR low-pass filter with the given
+// cutoff frequency (in Hz) and number of taps, designed with
+// a Hamming-windowed sinc. The delay of the filter is
+// (taps-1)/2 samples.
+func NewFIRLowPass(sampleRate int, cutoff float64, taps int) Filter {
+	checkFrequency(sampleRate, cutoff)
+	return NewFIR(LowPassTaps(cutoff/float64(sampleRate), taps))
+}
+
+// LowPassTaps designs the taps of a Hamming-windowed sinc
+// low-pass filter whose cutoff is given as a fraction of the
+// sample rate (0 < cutoff < 0.5). The taps sum to 1, so the
+// filter has unit gain at DC.
+func LowPassTaps(cutoff float64, n int) []float64 {
+	if n < 1 || cutoff <= 0 || cutoff >= 0.5 {
+		panic(fmt.Sprintf("bad filter design: cutoff (%v); taps (%d)", cutoff, n))
+	}
+	var (
+		taps = make([]float64, n)
+		m    = float64(n-1) / 2
+		sum  float64
+	)
+	for i := range taps {
+		x := float64(i) - m
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		window := 1.0
+		if n > 1 {
+			window = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		}
+		taps[i] = sinc * window
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+	return taps
+}
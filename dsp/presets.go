@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+// ----------------------------------------------------------------- //
+// Presets -- common filters for EEG
+// ----------------------------------------------------------------- //
+
+const (
+	DefaultNotchQ        = 30  // notch width of 2 Hz at 60 Hz
+	DefaultHighPassOrder = 2   // gentle roll-off, little ringing
+	DefaultBandPassOrder = 4   // order of each side of the band
+	DefaultHighPass      = 0.5 // removes DC offset and slow drift (Hz)
+)
+
+// Notch50 removes 50 Hz mains hum (Europe, Asia, ...).
+func Notch50(sampleRate int) Filter {
+	return mainsNotch(sampleRate, 50)
+}
+
+// Notch60 removes 60 Hz mains hum (Americas, ...).
+func Notch60(sampleRate int) Filter {
+	return mainsNotch(sampleRate, 60)
+}
+
+// A notch at the mains frequency; at sample rates too low to
+// hold that frequency there is no hum to remove, and the data
+// passes through unchanged.
+func mainsNotch(sampleRate int, mains float64) Filter {
+	if mains >= float64(sampleRate)/2 {
+		return NewChain()
+	}
+	return NewNotch(sampleRate, mains, DefaultNotchQ)
+}
+
+// HighPass removes the DC offset and drift below the cutoff
+// frequency (in Hz). A cutoff of DefaultHighPass is typical.
+func HighPass(sampleRate int, cutoff float64) Filter {
+	return NewButterworthHighPass(DefaultHighPassOrder, sampleRate, cutoff)
+}
+
+// BandPass keeps the frequencies between low and high (in Hz),
+// for instance 1-40 Hz for most EEG work.
+func BandPass(sampleRate int, low, high float64) Filter {
+	return NewButterworthBandPass(DefaultBandPassOrder, sampleRate, low, high)
+}
+
+// Clean is a typical cleanup chain for raw EEG: it removes the DC
+// offset and the mains hum at the given frequency (50 or 60 Hz).
+func Clean(sampleRate int, mains float64) Filter {
+	return NewChain(
+		HighPass(sampleRate, DefaultHighPass),
+		mainsNotch(sampleRate, mains),
+	)
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+)
+
+// ----------------------------------------------------------------- //
+// Processors -- filters, montages and decimators in a Pipeline
+// ----------------------------------------------------------------- //
+
+// filterProcessor filters the frames with FilterFrame().
+type filterProcessor struct {
+	f Filter
+}
+
+// Create a Processor that filters the EEG channels of the frames.
+func NewFilterProcessor(f Filter) Processor {
+	return &filterProcessor{f}
+}
+
+func (p *filterProcessor) Process(df DataFrame) DataFrame {
+	return FilterFrame(p.f, df)
+}
+
+func (p *filterProcessor) Reset() {
+	p.f.Reset()
+}
+
+// montageProcessor re-references the frames with ReferenceFrame().
+type montageProcessor struct {
+	m Montage
+}
+
+// Create a Processor that re-references the frames with the montage.
+func NewMontageProcessor(m Montage) Processor {
+	return &montageProcessor{m}
+}
+
+func (p *montageProcessor) Process(df DataFrame) DataFrame {
+	return ReferenceFrame(p.m, df)
+}
+
+func (p *montageProcessor) Reset() {}
+
+// decimatorProcessor lowers the sample rate of the frames. The
+// events of frames that produce no samples are held until the
+// next frame that does.
+type decimatorProcessor struct {
+	d      *Decimator
+	events []*Event
+}
+
+// Create a Processor that lowers the sample rate of the frames
+// with the decimator. The decimated channels lose their counts
+// and their range. Frames carry whole sample rates, so the
+// factor must divide the sample rate of the decimator.
+func NewDecimatorProcessor(d *Decimator) Processor {
+	if d.SampleRate()%d.Factor() != 0 {
+		panic(fmt.Sprintf("factor %d does not divide the sample rate %d", d.Factor(), d.SampleRate()))
+	}
+	return &decimatorProcessor{d: d}
+}
+
+func (p *decimatorProcessor) Process(df DataFrame) DataFrame {
+	bb := p.d.Decimate(df.Buffer())
+	p.events = append(p.events, df.Events()...)
+	if bb.Samples() == 0 {
+		return nil
+	}
+	events := p.events
+	p.events = nil
+	return NewDataFrameWithEvents(bb, p.d.SampleRate()/p.d.Factor(), Unranged(df.ChannelInfos()), events)
+}
+
+func (p *decimatorProcessor) Reset() {
+	p.d.Reset()
+	p.events = nil
+}
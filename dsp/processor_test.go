@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	"testing"
+)
+
+func TestDecimatorProcessor(t *testing.T) {
+	var (
+		p      = NewDecimatorProcessor(NewDecimator(testRate, 5))
+		b      = sineBuffer(1, 1000, 0, 5, 1)
+		marker = &Event{Timestamp: 0, Label: "start"}
+		frames int
+		events []*Event
+	)
+	for from := 0; from < b.Samples(); from += 16 {
+		to := from + 16
+		if to > b.Samples() {
+			to = b.Samples()
+		}
+		var ev []*Event
+		if from == 0 {
+			ev = []*Event{marker}
+		}
+		df := p.Process(NewDataFrameWithEvents(b.Slice(from, to), testRate, nil, ev))
+		if df == nil {
+			continue
+		}
+		if df.SampleRate() != testRate/5 {
+			t.Errorf("wrong sample rate: %d", df.SampleRate())
+		}
+		frames++
+		events = append(events, df.Events()...)
+	}
+
+	// the first frames only fill the filter, but their
+	// events are not lost
+	if frames == 0 || frames >= 63 {
+		t.Errorf("wrong number of frames: %d", frames)
+	}
+	if len(events) != 1 || events[0] != marker {
+		t.Errorf("expected the marker: %v", events)
+	}
+}
+
+func TestDecimatorProcessor__UnevenRate(t *testing.T) {
+	AssertPanic(t, func() {
+		NewDecimatorProcessor(NewDecimator(testRate, 4))
+	})
+}
+
+func TestPipeline__Filters(t *testing.T) {
+	var (
+		b     = sineBuffer(2, 500, 0, 10, 1)
+		infos = EEGChannelInfos(2, "V", 1)
+		p     = NewPipeline(NewMontageProcessor(CommonAverage{}), NewFilterProcessor(HighPass(testRate, 1)))
+		df    = p.Process(NewDataFrameWithChannels(b, testRate, infos))
+	)
+	if df.Buffer().Channels() != 2 || df.Buffer().Samples() != 500 {
+		t.Errorf("wrong frame: %v", df.Buffer())
+	}
+	// the two channels are equal, so their average reference is 0
+	if v, _ := df.Buffer().Sample(250); v[0] != 0 || v[1] != 0 {
+		t.Errorf("expected no signal: %v", v)
+	}
+}
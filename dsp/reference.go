@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+)
+
+// ----------------------------------------------------------------- //
+// Montages -- re-referencing of EEG channels
+// ----------------------------------------------------------------- //
+
+// Montage re-references the channels of a buffer, producing
+// a new buffer and the descriptions of its channels. The
+// descriptions of the input may be nil, in which case every
+// channel is assumed to carry EEG and is labeled Ch1, ..., Chn.
+// Re-referenced channels lose the range of the converter.
+type Montage interface {
+	Reference(b *BlockBuffer, infos []*ChannelInfo) (*BlockBuffer, []*ChannelInfo)
+}
+
+// CommonAverage subtracts the average of all the EEG
+// channels from each of them. Other channels, such as
+// triggers, are passed through unchanged.
+type CommonAverage struct{}
+
+func (CommonAverage) Reference(b *BlockBuffer, infos []*ChannelInfo) (*BlockBuffer, []*ChannelInfo) {
+	infos = describe(b, infos)
+	var eeg []int
+	for c, info := range infos {
+		if info.Kind == KindEEG {
+			eeg = append(eeg, c)
+		}
+	}
+	return subtractMean(b, eeg, eeg), Unranged(infos)
+}
+
+// LinkedReference subtracts the average of the reference
+// channels, like the two mastoids or ear lobes, from every
+// other EEG channel. The reference channels themselves are
+// removed from the output.
+type LinkedReference struct {
+	Refs []int // indices of the reference channels
+}
+
+// Create a LinkedReference from the labels or positions of
+// the reference channels, like "A1" and "A2".
+func NewLinkedReference(infos []*ChannelInfo, refs ...string) (*LinkedReference, error) {
+	m := &LinkedReference{Refs: make([]int, len(refs))}
+	for i, name := range refs {
+		c, err := findChannel(infos, name)
+		if err != nil {
+			return nil, err
+		}
+		m.Refs[i] = c
+	}
+	return m, nil
+}
+
+func (m *LinkedReference) Reference(b *BlockBuffer, infos []*ChannelInfo) (*BlockBuffer, []*ChannelInfo) {
+	if len(m.Refs) == 0 {
+		panic("no reference channels")
+	}
+	infos = describe(b, infos)
+	var (
+		isRef = make(map[int]bool)
+		eeg   []int
+		keep  []int
+	)
+	for _, c := range m.Refs {
+		isRef[c] = true
+	}
+	for c, info := range infos {
+		if isRef[c] {
+			continue
+		}
+		keep = append(keep, c)
+		if info.Kind == KindEEG {
+			eeg = append(eeg, c)
+		}
+	}
+	bb := subtractMean(b, eeg, m.Refs).SelectChannels(keep...)
+	return bb, selectInfos(Unranged(infos), keep)
+}
+
+// Bipolar produces one channel per pair of channels, which
+// is the difference of the two, like C3-C4.
+type Bipolar struct {
+	Pairs [][2]int // indices of the channels to subtract, first minus second
+}
+
+// Create a Bipolar montage from pairs given by label or
+// position, like "C3-C4" or "Fp1-F3".
+func NewBipolar(infos []*ChannelInfo, pairs ...string) (*Bipolar, error) {
+	m := &Bipolar{Pairs: make([][2]int, len(pairs))}
+	for i, pair := range pairs {
+		var names [2]string
+		for j := 0; j < len(pair); j++ {
+			if pair[j] == '-' {
+				names[0], names[1] = pair[:j], pair[j+1:]
+				break
+			}
+		}
+		if names[0] == "" || names[1] == "" {
+			return nil, fmt.Errorf("bad bipolar pair: %s", pair)
+		}
+		for j, name := range names {
+			c, err := findChannel(infos, name)
+			if err != nil {
+				return nil, err
+			}
+			m.Pairs[i][j] = c
+		}
+	}
+	return m, nil
+}
+
+func (m *Bipolar) Reference(b *BlockBuffer, infos []*ChannelInfo) (*BlockBuffer, []*ChannelInfo) {
+	if len(m.Pairs) == 0 {
+		panic("no bipolar pairs")
+	}
+	infos = describe(b, infos)
+	var (
+		samples = b.Samples()
+		bb      = NewBlockBuffer(len(m.Pairs), samples+1)
+		v       = make([]float64, len(m.Pairs))
+		out     = make([]*ChannelInfo, len(m.Pairs))
+	)
+	for i, p := range m.Pairs {
+		a, z := infos[p[0]], infos[p[1]]
+		out[i] = &ChannelInfo{
+			Label: channelName(a) + "-" + channelName(z),
+			Kind:  KindEEG,
+			Unit:  a.Unit,
+			Scale: a.Scale,
+		}
+	}
+	for s := 0; s < samples; s++ {
+		x, ts := b.Sample(s)
+		for i, p := range m.Pairs {
+			v[i] = x[p[0]] - x[p[1]]
+		}
+		bb.AppendSample(v, ts)
+	}
+	return bb, out
+}
+
+// Re-reference the DataFrame with the Montage, keeping
+// its sample rate and events.
+func ReferenceFrame(m Montage, df DataFrame) DataFrame {
+	bb, infos := m.Reference(df.Buffer(), df.ChannelInfos())
+	return NewDataFrameWithEvents(bb, df.SampleRate(), infos, df.Events())
+}
+
+// Return the descriptions, or generic ones if there are none.
+func describe(b *BlockBuffer, infos []*ChannelInfo) []*ChannelInfo {
+	if infos == nil {
+		return EEGChannelInfos(b.Channels(), "", 1)
+	}
+	if len(infos) != b.Channels() {
+		panic("channel descriptions do not match the buffer")
+	}
+	return infos
+}
+
+// Copy the buffer, subtracting the mean of the from channels
+// from each of the to channels.
+func subtractMean(b *BlockBuffer, to, from []int) *BlockBuffer {
+	var (
+		samples = b.Samples()
+		bb      = NewBlockBuffer(b.Channels(), samples+1)
+		v       = make([]float64, b.Channels())
+	)
+	for s := 0; s < samples; s++ {
+		x, ts := b.Sample(s)
+		copy(v, x)
+		if len(from) > 0 {
+			var mean float64
+			for _, c := range from {
+				mean += x[c]
+			}
+			mean /= float64(len(from))
+			for _, c := range to {
+				v[c] -= mean
+			}
+		}
+		bb.AppendSample(v, ts)
+	}
+	return bb
+}
+
+func selectInfos(infos []*ChannelInfo, cs []int) []*ChannelInfo {
+	out := make([]*ChannelInfo, len(cs))
+	for i, c := range cs {
+		out[i] = infos[c]
+	}
+	return out
+}
+
+// The position of the channel if it is known, otherwise
+// its label.
+func channelName(info *ChannelInfo) string {
+	if info.Position != "" {
+		return info.Position
+	}
+	return info.Label
+}
+
+// Find the channel with the given position or label.
+func findChannel(infos []*ChannelInfo, name string) (int, error) {
+	for c, info := range infos {
+		if info.Position == name {
+			return c, nil
+		}
+	}
+	for c, info := range infos {
+		if info.Label == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("no such channel: %s", name)
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"testing"
+)
+
+// Four EEG channels at C3, C4, A1, A2 and a trigger.
+func montageInput() (*BlockBuffer, []*ChannelInfo) {
+	infos := EEGChannelInfos(4, "V", 1)
+	for c, p := range []string{"C3", "C4", "A1", "A2"} {
+		infos[c].Position = p
+	}
+	infos = append(infos, &ChannelInfo{Label: "Keypad", Kind: KindTrigger, Scale: 1})
+
+	b := NewBlockBuffer(5, 2)
+	b.AppendSample([]float64{1, 2, 3, 6, 1}, 1)
+	b.AppendSample([]float64{4, 4, 4, 4, 0}, 2)
+	return b, infos
+}
+
+func TestCommonAverage(t *testing.T) {
+	b, infos := montageInput()
+	bb, out := CommonAverage{}.Reference(b, infos)
+	if bb.Channels() != 5 || len(out) != 5 {
+		t.Fatalf("wrong channels")
+	}
+	v, ts := bb.Sample(0)
+	if v[0] != -2 || v[1] != -1 || v[3] != 3 || v[4] != 1 || ts != 1 {
+		t.Errorf("wrong sample: %v", v)
+	}
+	if v, _ = bb.Sample(1); v[2] != 0 {
+		t.Errorf("wrong sample: %v", v)
+	}
+}
+
+func TestLinkedReference(t *testing.T) {
+	b, infos := montageInput()
+	m, err := NewLinkedReference(infos, "A1", "A2")
+	if err != nil {
+		t.Fatalf("could not create: %v", err)
+	}
+	bb, out := m.Reference(b, infos)
+	if bb.Channels() != 3 || len(out) != 3 || out[2].Label != "Keypad" {
+		t.Fatalf("wrong channels")
+	}
+	if v, _ := bb.Sample(0); v[0] != -3.5 || v[1] != -2.5 || v[2] != 1 {
+		t.Errorf("wrong sample: %v", v)
+	}
+
+	if _, err = NewLinkedReference(infos, "M1"); err == nil {
+		t.Errorf("should not find M1")
+	}
+}
+
+func TestBipolar(t *testing.T) {
+	b, infos := montageInput()
+	m, err := NewBipolar(infos, "C3-C4", "A2-Ch3")
+	if err != nil {
+		t.Fatalf("could not create: %v", err)
+	}
+	bb, out := m.Reference(b, infos)
+	if bb.Channels() != 2 || out[0].Label != "C3-C4" || out[1].Label != "A2-A1" {
+		t.Fatalf("wrong channels: %v %v", out[0], out[1])
+	}
+	if v, ts := bb.Sample(0); v[0] != -1 || v[1] != 3 || ts != 1 {
+		t.Errorf("wrong sample: %v", v)
+	}
+
+	if _, err = NewBipolar(infos, "C3"); err == nil {
+		t.Errorf("should not accept a single channel")
+	}
+}
+
+func TestReferenceFrame__NoInfos(t *testing.T) {
+	b, _ := montageInput()
+	df := ReferenceFrame(&Bipolar{Pairs: [][2]int{{0, 1}}}, NewDataFrame(b, 250))
+	if df.SampleRate() != 250 || df.ChannelInfos()[0].Label != "Ch1-Ch2" {
+		t.Errorf("wrong frame")
+	}
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+)
+
+// ----------------------------------------------------------------- //
+// Resampler -- rational, polyphase sample rate conversion
+// ----------------------------------------------------------------- //
+
+const (
+	ResamplerCutoff       = 0.8 // fraction of the lower Nyquist frequency that is kept
+	ResamplerTapsPerPhase = 10  // minimum number of input samples under the filter
+)
+
+// Resampler converts a stream from one sample rate to any
+// other. It conceptually up-samples by L, low-pass filters,
+// and down-samples by M, where L/M = outRate/inRate in lowest
+// terms; the polyphase form only computes the outputs that
+// are kept, so it costs a handful of multiplications per
+// output sample. Its state carries across calls, so a stream
+// may be resampled one DataFrame at a time.
+//
+// The output timestamps are interpolated from the input
+// timestamps and account for the delay of the filter, so the
+// first few input samples produce no output.
+//
+// Samples with a NaN, which stand in for missing ones (see
+// GapNaN), pass through at the output rate, and the filter
+// starts over after them, rather than spreading the NaN over
+// the outputs around them.
+type Resampler struct {
+	inRate, outRate int
+	l, m            int       // up- and down-sampling factors
+	taps            []float64 // prototype filter, at inRate*l
+	delay           int       // delay of the filter, at inRate*l
+	period          float64   // nominal input sample period, in ns
+
+	acc     int         // position of the next output relative to the newest input, at inRate*l
+	seen    int         // number of samples taken in, up to len(ts)
+	pos     int         // position of the newest input in the delay lines
+	history [][]float64 // per-channel circular delay lines
+	ts      []int64     // circular delay line of timestamps
+	scratch []float64
+}
+
+// Create a new Resampler from inRate to outRate, both in Hz.
+func NewResampler(inRate, outRate int) *Resampler {
+	if inRate < 1 || outRate < 1 {
+		panic(fmt.Sprintf("bad parameters: inRate (%d); outRate (%d)", inRate, outRate))
+	}
+	var (
+		g      = gcd(inRate, outRate)
+		l, m   = outRate / g, inRate / g
+		lower  = inRate
+		phases = ResamplerTapsPerPhase
+	)
+	if outRate < lower {
+		lower = outRate
+		if k := ResamplerTapsPerPhase * m / l; k > phases {
+			phases = k
+		}
+	}
+	r := &Resampler{
+		inRate:  inRate,
+		outRate: outRate,
+		l:       l,
+		m:       m,
+		period:  1e9 / float64(inRate),
+	}
+	if l == 1 && m == 1 {
+		r.taps = []float64{1}
+	} else {
+		n := phases*l | 1 // odd, so the delay is whole
+		cutoff := ResamplerCutoff * float64(lower) / 2 / float64(inRate*l)
+		r.taps = LowPassTaps(cutoff, n)
+		r.delay = (n - 1) / 2
+		for i := range r.taps {
+			r.taps[i] *= float64(l)
+		}
+	}
+	r.Reset()
+	return r
+}
+
+// The input sample rate.
+func (r *Resampler) InRate() int {
+	return r.inRate
+}
+
+// The output sample rate.
+func (r *Resampler) OutRate() int {
+	return r.outRate
+}
+
+// Resample converts the buffer to the output rate, returning
+// the samples that are ready.
+func (r *Resampler) Resample(b *BlockBuffer) *BlockBuffer {
+	var (
+		channels = b.Channels()
+		samples  = b.Samples()
+		bb       = NewBlockBuffer(channels, samples*r.l/r.m+1)
+	)
+	if len(r.history) != channels {
+		// enough input for the filter and for the delay
+		n := (len(r.taps)+r.l-1)/r.l + r.delay/r.l + 2
+		r.history = make([][]float64, channels)
+		for c := range r.history {
+			r.history[c] = make([]float64, n)
+		}
+		r.ts = make([]int64, n)
+		r.scratch = make([]float64, channels)
+		r.Reset()
+	}
+	n := len(r.ts)
+
+	for s := 0; s < samples; s++ {
+		v, ts := b.Sample(s)
+		if hasNaN(v) {
+			r.clear()
+			for r.acc -= r.l; r.acc <= 0; r.acc += r.m {
+				bb.AppendSample(v, ts)
+			}
+			continue
+		}
+
+		// take the sample into the delay lines
+		r.pos = (r.pos + 1) % n
+		for c, x := range v {
+			r.history[c][r.pos] = x
+		}
+		r.ts[r.pos] = ts
+		if r.seen < n {
+			r.seen++
+		}
+
+		// emit every output that falls at or before this input
+		for r.acc -= r.l; r.acc <= 0; r.acc += r.m {
+			ts, ok := r.timestamp()
+			if !ok {
+				continue
+			}
+			phase, back := r.acc+r.l, 1
+			if phase == r.l {
+				phase, back = 0, 0
+			}
+			for c := range r.scratch {
+				r.scratch[c] = r.convolve(r.history[c], phase, back)
+			}
+			bb.AppendSample(r.scratch, ts)
+		}
+	}
+	return bb
+}
+
+// Forget the state of the Resampler.
+func (r *Resampler) Reset() {
+	r.acc = r.l // the first output coincides with the first input
+	r.clear()
+}
+
+// Empty the delay lines, keeping the phase of the outputs.
+func (r *Resampler) clear() {
+	r.seen = 0
+	r.pos = 0
+	for _, h := range r.history {
+		for i := range h {
+			h[i] = 0
+		}
+	}
+}
+
+// The time of the current output, which is the time of the
+// input that the filter centers on, interpolated between
+// input samples with the nominal sample period.
+func (r *Resampler) timestamp() (int64, bool) {
+	var (
+		rel  = r.acc - r.delay
+		back = (-rel + r.l - 1) / r.l // inputs behind the newest, rounding up
+		frac = rel + back*r.l         // position past that input, at inRate*l
+	)
+	if back >= r.seen {
+		return 0, false
+	}
+	i := (r.pos - back + len(r.ts)) % len(r.ts)
+	return r.ts[i] + int64(float64(frac)*r.period/float64(r.l)), true
+}
+
+// y = sum_i taps[phase+l*i]*x[newest-back-i]
+func (r *Resampler) convolve(h []float64, phase, back int) (y float64) {
+	i := (r.pos - back + len(h)) % len(h)
+	for k := phase; k < len(r.taps); k += r.l {
+		y += r.taps[k] * h[i]
+		if i == 0 {
+			i = len(h)
+		}
+		i--
+	}
+	return
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
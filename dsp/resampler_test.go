@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package dsp
+
+import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"testing"
+)
+
+func sineAt(rate, samples int, freq float64) *BlockBuffer {
+	b := NewBlockBuffer(1, samples)
+	for s := 0; s < samples; s++ {
+		ts := int64(s) * 1000000000 / int64(rate)
+		b.AppendSample([]float64{math.Sin(2 * math.Pi * freq * float64(ts) / 1e9)}, ts)
+	}
+	return b
+}
+
+func resampleInChunks(r *Resampler, b *BlockBuffer) *BlockBuffer {
+	out := NewBlockBuffer(b.Channels(), b.Samples())
+	for from := 0; from < b.Samples(); from += 16 {
+		to := from + 16
+		if to > b.Samples() {
+			to = b.Samples()
+		}
+		out.Append(r.Resample(b.Slice(from, to)))
+	}
+	return out
+}
+
+func checkSine(t *testing.T, out *BlockBuffer, freq float64, skip int) {
+	for s := skip; s < out.Samples(); s++ {
+		v, ts := out.Sample(s)
+		expected := math.Sin(2 * math.Pi * freq * float64(ts) / 1e9)
+		if math.Abs(v[0]-expected) > 0.02 {
+			t.Fatalf("wrong value at %d: %v, expected %v", s, v[0], expected)
+		}
+	}
+}
+
+func TestResampler__ExactRate(t *testing.T) {
+	// 512 Hz at 100 pps used to give 102.4 pps
+	r := NewResampler(512, 100)
+	out := resampleInChunks(r, sineAt(512, 5120, 5))
+	if out.Samples() < 990 || out.Samples() > 1000 {
+		t.Errorf("wrong number of samples: %d", out.Samples())
+	}
+
+	_, ts := out.Arrays()
+	for i := 1; i < len(ts); i++ {
+		if d := ts[i] - ts[i-1]; d < 9999999 || d > 10000001 {
+			t.Fatalf("uneven spacing at %d: %d", i, d)
+		}
+	}
+	checkSine(t, out, 5, 10)
+}
+
+func TestResampler__RemovesAliases(t *testing.T) {
+	// 90 Hz would alias to 10 Hz at 100 Hz
+	r := NewResampler(512, 100)
+	out := resampleInChunks(r, sineAt(512, 5120, 90))
+	if p := peak(out, 0, 20); p > 0.01 {
+		t.Errorf("alias not removed: %v", p)
+	}
+}
+
+func TestResampler__Upsample(t *testing.T) {
+	r := NewResampler(250, 512)
+	out := resampleInChunks(r, sineAt(250, 2500, 10))
+	if out.Samples() < 5100 || out.Samples() > 5120 {
+		t.Errorf("wrong number of samples: %d", out.Samples())
+	}
+	checkSine(t, out, 10, 50)
+}
+
+func TestResampler__Identity(t *testing.T) {
+	var (
+		r  = NewResampler(testRate, testRate)
+		b  = sineBuffer(2, 50, 0, 10, 1)
+		bb = resampleInChunks(r, b)
+	)
+	if bb.Samples() != b.Samples() {
+		t.Fatalf("wrong number of samples: %d", bb.Samples())
+	}
+	for s := 0; s < b.Samples(); s++ {
+		v1, ts1 := b.Sample(s)
+		v2, ts2 := bb.Sample(s)
+		if v1[1] != v2[1] || ts1 != ts2 {
+			t.Errorf("should pass through")
+		}
+	}
+}
+
+func TestResampler__Gap(t *testing.T) {
+	var (
+		r   = NewResampler(testRate, 125)
+		b   = sineAt(testRate, 2500, 5)
+		gap = b.Timestamps()[1250]
+	)
+	for s := 1250; s < 1254; s++ {
+		v, _ := b.Sample(s)
+		v[0] = math.NaN()
+	}
+	out := resampleInChunks(r, b)
+
+	nans := 0
+	for s := 0; s < out.Samples(); s++ {
+		v, ts := out.Sample(s)
+		expected := math.Sin(2 * math.Pi * 5 * float64(ts) / 1e9)
+		switch {
+		case math.IsNaN(v[0]):
+			nans++
+		case ts > 100000000 && (ts < gap || ts > gap+100000000) && math.Abs(v[0]-expected) > 0.02:
+			t.Fatalf("wrong value at %d: %v, expected %v", s, v[0], expected)
+		}
+	}
+	if nans != 2 {
+		t.Errorf("the gap should pass through, got %d NaN", nans)
+	}
+}
+
+func TestResampler__BadParameters(t *testing.T) {
+	AssertPanic(t, func() {
+		NewResampler(0, 100)
+	})
+	AssertPanic(t, func() {
+		NewResampler(250, -1)
+	})
+}
@@ -68,6 +68,29 @@ import (
 // variable to be milliseconds by default.
 //
 // ----------------------------------------------------------------- //
+// Octopus Binary Format (OBF) Version 2.2
+// (Adding extension blocks)
+//
+// The 13th byte of the header is now the number of extension
+// blocks, with 18 bytes reserved. Extension blocks follow the
+// payload (after the S-mode values, in combined mode) and carry
+// metadata that does not fit in the header:
+//
+//    Type (1 byte):                     0x01 = channel descriptions;
+//                                       0x02 = events, like gaps and triggers;
+//                                       0x03 = statistics of each channel
+//    Length (uint32):                   length of the body, in bytes
+//    Body (variable):                   JSON-encoded contents
+//
+// Readers of earlier versions ignore the trailing blocks. Unknown
+// extension types should be skipped.
+//
+// This version also adds the DataType 0x02 = raw device counts, in
+// which the values are the integer samples of the device, stored
+// as int64 instead of float64. The Scale in the channel descriptions
+// converts them to physical units.
+//
+// ----------------------------------------------------------------- //
 // Notes on P-mode vs S-mode:
 //
 // Define v(c,s) to mean the value of channel c (0 < c <= C) at
@@ -91,7 +114,8 @@ import (
 
 // DataTypes
 const (
-	DataTypeRaw = 0x01
+	DataTypeRaw    = 0x01 // values are float64
+	DataTypeCounts = 0x02 // values are int64 device counts (version 2.2)
 )
 
 // FormatVersions
@@ -99,10 +123,11 @@ const (
 	FormatVersion1   = 0x01 // in this format, we have a 10 byte header
 	FormatVersion2   = 0x02 // in this format, we add a field for Endianness and 20 bytes of padding
 	FormatVersion2_1 = 0x03 // in this format, we add an IndexUnit field
+	FormatVersion2_2 = 0x04 // in this format, we add extension blocks after the payload
 )
 
 // Default format version
-const ObfDefaultFormatVersion = FormatVersion2_1
+const ObfDefaultFormatVersion = FormatVersion2_2
 
 // Endianness
 const (
@@ -169,7 +194,8 @@ type (
 		SampleRate    uint16
 		Endianness    byte
 		IndexUnit     byte
-		Reserved      [19]byte // reserved for extentions
+		Extensions    uint8    // number of extension blocks
+		Reserved      [18]byte // reserved for extentions
 	}
 
 	// ObfReader can read OBF files. Depending on
@@ -179,6 +205,7 @@ type (
 		Header() *ObfHeader
 		Parallel() (*BlockBuffer, error)
 		Sequential() ([][]float64, []int64, error)
+		Extensions() ([]*ObfExtension, error)
 	}
 
 	// ObfWriter can write OBF files. Depending on
@@ -198,6 +225,7 @@ type (
 		SeekValues() error
 		SeekParallel() error
 		SeekSequential() error
+		SeekExtensions() error
 		SeekSample(n int) error
 	}
 )
@@ -228,7 +256,8 @@ func ReadHeader(r io.Reader) (header *ObfHeader, err error) {
 // ReadParallel will read in the parallel data payload. This
 // function assumes that the pointer of the reader is pointing
 // to the start of the data. If the OBF file does not support
-// parallel data, then an error is returned.
+// parallel data, then an error is returned. If the data type
+// is DataTypeCounts, the values are the counts, unscaled.
 func ReadParallel(r io.Reader, header *ObfHeader) (*BlockBuffer, error) {
 	if header.StorageMode == StorageModeSequential {
 		return nil, fmt.Errorf("no parallel payload, use sequential")
@@ -238,9 +267,13 @@ func ReadParallel(r io.Reader, header *ObfHeader) (*BlockBuffer, error) {
 		b                 = NewBlockBuffer(channels, samples)
 		v                 = make([]float64, channels)
 		inx32             uint32
+		read              = readBlock
 	)
+	if header.DataType == DataTypeCounts {
+		read = readCountBlock
+	}
 	for s := 0; s < samples; s++ {
-		if err := readBlock(r, v, &inx32); err != nil {
+		if err := read(r, v, &inx32); err != nil {
 			return nil, err
 		}
 		b.AppendSample(v, ToTs64(inx32))
@@ -251,7 +284,8 @@ func ReadParallel(r io.Reader, header *ObfHeader) (*BlockBuffer, error) {
 // ReadDSequential will read in the sequential data payload. This
 // function assumes that the pointer of the reader is pointing
 // to the start of the data. If the file does not support
-// sequential data, then an error is returned.
+// sequential data, then an error is returned. Like ReadParallel,
+// device counts are returned as floating point values.
 func ReadSequential(r io.Reader, header *ObfHeader) (v [][]float64, inxs []int64, err error) {
 	if header.StorageMode == StorageModeParallel {
 		return nil, nil, fmt.Errorf("no sequential payload, use parallel")
@@ -263,7 +297,12 @@ func ReadSequential(r io.Reader, header *ObfHeader) (v [][]float64, inxs []int64
 	// read in all the channels sequentially
 	for c := 0; c < channels; c++ {
 		v[c] = make([]float64, samples)
-		if err = binary.Read(r, ByteOrder, v[c]); err != nil {
+		if header.DataType == DataTypeCounts {
+			err = readCounts(r, v[c])
+		} else {
+			err = binary.Read(r, ByteOrder, v[c])
+		}
+		if err != nil {
 			return nil, nil, err
 		}
 	}
@@ -320,6 +359,37 @@ func WriteSequential(w io.Writer, b *BlockBuffer, indexFunc func(int64) uint32)
 	return binary.Write(w, ByteOrder, ts32)
 }
 
+// WriteParallelCounts is like WriteParallel for files of
+// DataTypeCounts; the values of the buffer must be counts.
+func WriteParallelCounts(w io.Writer, b *BlockBuffer, indexFunc func(int64) uint32) (err error) {
+	buf := new(bytes.Buffer)
+	samples := b.Samples()
+
+	for s := 0; s < samples; s++ {
+		v, ts := b.Sample(s)
+		if err = writeCountBlock(buf, v, indexFunc(ts)); err != nil {
+			return
+		}
+	}
+	return binary.Write(w, ByteOrder, buf.Bytes())
+}
+
+// WriteSequentialCounts is like WriteSequential for files of
+// DataTypeCounts; the values of the buffer must be counts.
+func WriteSequentialCounts(w io.Writer, b *BlockBuffer, indexFunc func(int64) uint32) (err error) {
+	arr, ts64 := b.Arrays()
+	for _, channel := range arr {
+		if err = binary.Write(w, ByteOrder, toCounts(channel)); err != nil {
+			return
+		}
+	}
+	ts32 := make([]uint32, len(ts64))
+	for i, tv := range ts64 {
+		ts32[i] = indexFunc(tv)
+	}
+	return binary.Write(w, ByteOrder, ts32)
+}
+
 // ----------------------------------------------------------------- //
 // Duration Methods
 // ----------------------------------------------------------------- //
@@ -373,3 +443,37 @@ func readBlock(r io.Reader, v []float64, ts *uint32) (err error) {
 	}
 	return binary.Read(r, ByteOrder, ts)
 }
+
+func writeCountBlock(w io.Writer, v []float64, ts uint32) (err error) {
+	if err = binary.Write(w, ByteOrder, toCounts(v)); err != nil {
+		return
+	}
+	return binary.Write(w, ByteOrder, ts)
+}
+
+// Read a block of counts in place.
+func readCountBlock(r io.Reader, v []float64, ts *uint32) (err error) {
+	if err = readCounts(r, v); err != nil {
+		return
+	}
+	return binary.Read(r, ByteOrder, ts)
+}
+
+func readCounts(r io.Reader, v []float64) (err error) {
+	counts := make([]int64, len(v))
+	if err = binary.Read(r, ByteOrder, counts); err != nil {
+		return
+	}
+	for i, x := range counts {
+		v[i] = float64(x)
+	}
+	return
+}
+
+func toCounts(v []float64) []int64 {
+	counts := make([]int64, len(v))
+	for i, x := range v {
+		counts[i] = int64(x)
+	}
+	return counts
+}
@@ -118,6 +118,12 @@ func (oc *ObfCodec) SeekSequential() (err error) {
 	return
 }
 
+// Go to the starting position of the extension blocks.
+func (oc *ObfCodec) SeekExtensions() (err error) {
+	_, err = oc.file.Seek(getExtensionsAddr(oc.header), os.SEEK_SET)
+	return
+}
+
 // Seek the n-th sample.
 func (oc *ObfCodec) SeekSample(n int) (err error) {
 	if oc.header.StorageMode == StorageModeSequential {
@@ -169,21 +175,54 @@ func (oc *ObfCodec) Sequential() (v [][]float64, ts []int64, err error) {
 	return ReadSequential(oc.file, oc.header)
 }
 
+// Read the extension blocks from the file.
+func (oc *ObfCodec) Extensions() (exts []*ObfExtension, err error) {
+	if err = oc.SeekHeader(); err != nil {
+		return
+	}
+	if oc.header, err = ReadHeader(oc.file); err != nil {
+		return
+	}
+	if err = oc.SeekExtensions(); err != nil {
+		return
+	}
+	return ReadExtensions(oc.file, oc.header)
+}
+
 // ----------------------------------------------------------------- //
 // Writing Operations -- All these operations happen in-place
 // ----------------------------------------------------------------- //
 
-// Write a new header to this file.
+// Write a new header to this file. The values that are
+// written afterwards are encoded according to its DataType.
 func (oc *ObfCodec) WriteHeader(h *ObfHeader) (err error) {
+	oc.header = h
 	return WriteHeader(oc.file, h)
 }
 
 // Writes a data frame in parallel mode, assuming the writer
 // is at the correct location for the frame.
 func (oc *ObfCodec) WriteParallel(b *BlockBuffer, tsTransform func(int64) uint32) (err error) {
+	if oc.counts() {
+		return WriteParallelCounts(oc.file, b, tsTransform)
+	}
 	return WriteParallel(oc.file, b, tsTransform)
 }
 
 func (oc *ObfCodec) WriteSequential(b *BlockBuffer, indexFunc func(int64) uint32) (err error) {
+	if oc.counts() {
+		return WriteSequentialCounts(oc.file, b, indexFunc)
+	}
 	return WriteSequential(oc.file, b, indexFunc)
 }
+
+// Whether the values are device counts.
+func (oc *ObfCodec) counts() bool {
+	return oc.header != nil && oc.header.DataType == DataTypeCounts
+}
+
+// Writes the extension blocks, assuming the writer is at
+// the end of the payload.
+func (oc *ObfCodec) WriteExtensions(exts []*ObfExtension) (err error) {
+	return WriteExtensions(oc.file, exts)
+}
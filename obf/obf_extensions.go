@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package obf
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"io"
+)
+
+// ----------------------------------------------------------------- //
+// Extension Blocks (OBF Version 2.2)
+// ----------------------------------------------------------------- //
+
+// ExtensionTypes
+const (
+	ExtChannels = 0x01 // channel descriptions
+	ExtEvents   = 0x02 // events, with timestamps relative to the first sample
+	ExtStats    = 0x03 // statistics of each channel
+)
+
+// An extension block, which follows the payload.
+type ObfExtension struct {
+	Type byte
+	Body []byte
+}
+
+// Create a new extension block with a JSON-encoded body.
+func NewJsonExtension(typ byte, v interface{}) (*ObfExtension, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &ObfExtension{
+		Type: typ,
+		Body: body,
+	}, nil
+}
+
+// Decode the JSON body of this extension into v.
+func (e *ObfExtension) Decode(v interface{}) error {
+	return json.Unmarshal(e.Body, v)
+}
+
+// Find the first extension block of the given type, or
+// nil if there is no such block.
+func FindExtension(exts []*ObfExtension, typ byte) *ObfExtension {
+	for _, e := range exts {
+		if e.Type == typ {
+			return e
+		}
+	}
+	return nil
+}
+
+// Return the channel descriptions stored in the extension
+// blocks, or nil if there are none.
+func ChannelInfosExtension(exts []*ObfExtension) (infos []*ChannelInfo, err error) {
+	if e := FindExtension(exts, ExtChannels); e != nil {
+		err = e.Decode(&infos)
+	}
+	return
+}
+
+// Return the events stored in the extension blocks, or nil
+// if there are none. Their timestamps are relative to the
+// first sample, like the timestamps read from the payload.
+func EventsExtension(exts []*ObfExtension) (events []*Event, err error) {
+	if e := FindExtension(exts, ExtEvents); e != nil {
+		err = e.Decode(&events)
+	}
+	return
+}
+
+// Return the channel statistics stored in the extension
+// blocks, or nil if there are none.
+func StatsExtension(exts []*ObfExtension) (stats []*ChannelStats, err error) {
+	if e := FindExtension(exts, ExtStats); e != nil {
+		err = e.Decode(&stats)
+	}
+	return
+}
+
+// WriteExtensions writes the extension blocks at the current
+// position, which should be the end of the payload.
+func WriteExtensions(w io.Writer, exts []*ObfExtension) (err error) {
+	for _, e := range exts {
+		if err = writeExtension(w, e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadExtensions reads all the extension blocks declared
+// in the header. This function assumes that the pointer of
+// the reader is pointing to the end of the payload.
+func ReadExtensions(r io.Reader, header *ObfHeader) (exts []*ObfExtension, err error) {
+	if header.FormatVersion < FormatVersion2_2 {
+		return nil, nil
+	}
+	for i := 0; i < int(header.Extensions); i++ {
+		e, err := readExtension(r)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, e)
+	}
+	return
+}
+
+// getExtensionsAddr calculates the location of the extension
+// blocks, which come after all of the payloads.
+func getExtensionsAddr(header *ObfHeader) int64 {
+	ps := getPayloadSize(header.Dim())
+	if header.StorageMode == StorageModeCombined {
+		ps *= 2
+	}
+	return ObfHeaderSize + ps
+}
+
+func writeExtension(w io.Writer, e *ObfExtension) (err error) {
+	var hdr [5]byte
+	hdr[0] = e.Type
+	ByteOrder.PutUint32(hdr[1:], uint32(len(e.Body)))
+	if _, err = w.Write(hdr[:]); err != nil {
+		return
+	}
+	_, err = w.Write(e.Body)
+	return
+}
+
+func readExtension(r io.Reader) (e *ObfExtension, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("could not read extension block: %v", err)
+	}
+	e = &ObfExtension{
+		Type: hdr[0],
+		Body: make([]byte, ByteOrder.Uint32(hdr[1:])),
+	}
+	if _, err = io.ReadFull(r, e.Body); err != nil {
+		return nil, fmt.Errorf("could not read extension body: %v", err)
+	}
+	return
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	"io"
+	"io/ioutil"
 )
 
 type (
@@ -17,7 +18,9 @@ type (
 		header *ObfHeader
 		ps     int64        // payload size
 		b      *BlockBuffer // data read from parallel payload
-		read   bool         // whether the stream is exhausted
+		read   bool         // whether the payload has been read
+		skip   int64        // payload bytes left before the extensions
+		exts   bool         // whether the extensions have been read
 	}
 )
 
@@ -33,6 +36,7 @@ func NewObfReader(r io.Reader) (ObfReader, error) {
 		header: header,
 	}
 	or.ps = getPayloadSize(header.Dim())
+	or.skip = getExtensionsAddr(header) - ObfHeaderSize
 	return or, nil
 }
 
@@ -54,7 +58,11 @@ func (or *obfReader) Parallel() (*BlockBuffer, error) {
 		return nil, fmt.Errorf("stream exhausted (get a new reader)")
 	}
 	or.read = true
-	return ReadParallel(or.r, or.header)
+	b, err := ReadParallel(or.r, or.header)
+	if err == nil {
+		or.skip -= or.ps
+	}
+	return b, err
 }
 
 func (or *obfReader) Sequential() (v [][]float64, inxs []int64, err error) {
@@ -62,6 +70,7 @@ func (or *obfReader) Sequential() (v [][]float64, inxs []int64, err error) {
 		return nil, nil, fmt.Errorf("stream exhausted (get a new reader)")
 	}
 	or.read = true
+	or.skip = 0
 
 	// if the storage mode is combined, we must skip to the
 	// start of the sequential payload
@@ -73,3 +82,20 @@ func (or *obfReader) Sequential() (v [][]float64, inxs []int64, err error) {
 	}
 	return ReadSequential(or.r, or.header)
 }
+
+// Extensions returns the extension blocks that follow the
+// payload, skipping any payload that has not been read. This
+// method may only be called once, and reading the payload
+// afterwards will fail.
+func (or *obfReader) Extensions() (exts []*ObfExtension, err error) {
+	if or.exts {
+		return nil, fmt.Errorf("stream exhausted (get a new reader)")
+	}
+	or.exts = true
+	or.read = true
+	if _, err = io.CopyN(ioutil.Discard, or.r, or.skip); err != nil {
+		return nil, err
+	}
+	or.skip = 0
+	return ReadExtensions(or.r, or.header)
+}
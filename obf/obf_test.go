@@ -4,6 +4,7 @@
 package obf
 
 import (
+	. "github.com/jbrukh/goavatar/datastruct"
 	"io"
 	"os"
 	"testing"
@@ -155,3 +156,128 @@ func TestObf__WriteHeader(t *testing.T) {
 		t.Errorf("header does not match")
 	}
 }
+
+func TestObf__Extensions(t *testing.T) {
+	h := &ObfHeader{
+		DataType:      DataTypeRaw,
+		FormatVersion: FormatVersion2_2,
+		StorageMode:   StorageModeCombined,
+		Channels:      1,
+		Samples:       2,
+		SampleRate:    250,
+		Extensions:    1,
+	}
+	b := NewBlockBuffer(1, 2)
+	b.AppendSample([]float64{1}, 0)
+	b.AppendSample([]float64{2}, 4000000)
+
+	infos := EEGChannelInfos(1, "V", 0.5)
+	e, err := NewJsonExtension(ExtChannels, infos)
+	if err != nil {
+		t.Fatalf("could not encode extension: %v", err)
+	}
+
+	fp, err := os.OpenFile("../var/extensions_test", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		t.Fatalf("could not open file: %v\n", err)
+	}
+	defer fp.Close()
+
+	if err = WriteHeader(fp, h); err != nil {
+		t.Errorf("could not write header")
+	}
+	if err = WriteParallel(fp, b, ToTs32); err != nil {
+		t.Errorf("could not write parallel")
+	}
+	if err = WriteSequential(fp, b, ToTs32); err != nil {
+		t.Errorf("could not write sequential")
+	}
+	if err = WriteExtensions(fp, []*ObfExtension{e}); err != nil {
+		t.Errorf("could not write extensions")
+	}
+
+	// read back with the codec
+	if _, err = fp.Seek(0, os.SEEK_SET); err != nil {
+		t.Errorf("could not rewind")
+	}
+	codec, err := NewObfCodec(fp)
+	if err != nil {
+		t.Fatalf("could not create codec: %v", err)
+	}
+	exts, err := codec.Extensions()
+	if err != nil || len(exts) != 1 {
+		t.Fatalf("could not read extensions: %v", err)
+	}
+	read, err := ChannelInfosExtension(exts)
+	if err != nil || len(read) != 1 || read[0].Label != "Ch1" || read[0].Scale != 0.5 {
+		t.Errorf("channel infos do not match: %v", read)
+	}
+
+	// read back with a reader, after the payload
+	if _, err = fp.Seek(0, os.SEEK_SET); err != nil {
+		t.Errorf("could not rewind")
+	}
+	re, err := NewObfReader(fp)
+	if err != nil {
+		t.Fatalf("could not init reader: %v", err)
+	}
+	if _, err = re.Parallel(); err != nil {
+		t.Errorf("could not read parallel: %v", err)
+	}
+	if exts, err = re.Extensions(); err != nil || len(exts) != 1 || exts[0].Type != ExtChannels {
+		t.Errorf("could not read extensions after payload: %v", err)
+	}
+}
+
+func TestObf__Counts(t *testing.T) {
+	h := &ObfHeader{
+		DataType:      DataTypeCounts,
+		FormatVersion: FormatVersion2_2,
+		StorageMode:   StorageModeCombined,
+		Channels:      2,
+		Samples:       2,
+		SampleRate:    250,
+	}
+	ints := NewIntBuffer(2, 2)
+	ints.AppendSample([]int64{1, -16777215})
+	ints.AppendSample([]int64{16777215, 0})
+	b := ints.BlockBuffer([]int64{0, 4000000})
+
+	fp, err := os.OpenFile("../var/counts_test", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		t.Fatalf("could not open file: %v\n", err)
+	}
+	defer fp.Close()
+
+	oc := NewLiveObfCodec(fp)
+	if err = oc.WriteHeader(h); err != nil {
+		t.Errorf("could not write header")
+	}
+	if err = oc.WriteParallel(b, ToTs32); err != nil {
+		t.Errorf("could not write parallel")
+	}
+	if err = oc.WriteSequential(b, ToTs32); err != nil {
+		t.Errorf("could not write sequential")
+	}
+
+	if _, err = fp.Seek(0, os.SEEK_SET); err != nil {
+		t.Fatalf("could not seek: %v", err)
+	}
+	if oc, err = NewObfCodec(fp); err != nil {
+		t.Fatalf("could not read header: %v", err)
+	}
+	bb, err := oc.Parallel()
+	if err != nil {
+		t.Fatalf("could not read parallel: %v", err)
+	}
+	if v, ts := bb.Sample(1); v[0] != 16777215 || v[1] != 0 || ts != 4000000 {
+		t.Errorf("wrong parallel sample: %v %v", v, ts)
+	}
+	v, _, err := oc.Sequential()
+	if err != nil {
+		t.Fatalf("could not read sequential: %v", err)
+	}
+	if v[1][0] != -16777215 || v[0][1] != 16777215 {
+		t.Errorf("wrong sequential values: %v", v)
+	}
+}
@@ -5,6 +5,7 @@ package recorder
 
 import (
 	"bytes"
+	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/obf"
 	. "github.com/jbrukh/goavatar/repo"
@@ -15,15 +16,37 @@ import (
 	"sync"
 )
 
+// FrameAnnotator adds events to a stream of frames, like the
+// artifacts found by a quality.Annotator.
+type FrameAnnotator interface {
+	AnnotateFrame(df DataFrame) DataFrame
+	Reset()
+}
+
 type ObfRecorder struct {
 	sync.Mutex
 	repo     *Repository // repository where file is being recorded to
 	fileName string      // name of the file/resource id
 	file     *os.File    // the file we're writing
 	codec    *ObfCodec   // codec for the OBF format
+	counts   bool        // whether to record device counts, when available
+
+	// adds events to the frames, if any
+	annotator FrameAnnotator
+
+	// pausing: whether the recording is paused, the marker
+	// of the last pause, until the recording resumes, and
+	// whether the next frame is the first after a pause
+	paused  bool
+	pause   *Event
+	resumed bool
 
 	// diagnostics
 	channels   int
+	dataType   byte           // DataTypeRaw or DataTypeCounts
+	infos      []*ChannelInfo // channel descriptions, if known
+	events     []*Event       // events, relative to the first sample
+	stats      *Stats         // statistics of the values
 	samples    int
 	sampleRate int
 	buf        bytes.Buffer
@@ -39,18 +62,75 @@ func (r *ObfRecorder) tsTransform(ts int64) uint32 {
 
 func NewObfRecorder(repo *Repository) *ObfRecorder {
 	return &ObfRecorder{
-		repo: repo,
+		repo:     repo,
+		dataType: DataTypeRaw,
+		stats:    NewStats(0),
 	}
 }
 
+// RecordCounts makes the recorder store the raw integer
+// samples of the device (see DataTypeCounts) instead of the
+// scaled values, if the frames of the recording carry them.
+func (r *ObfRecorder) RecordCounts(counts bool) {
+	r.counts = counts
+}
+
+// Annotate makes the recorder run every frame through the
+// annotator before recording it, so that the events it adds
+// are recorded too. The annotator is reset at the start of
+// every recording. Annotation is off if a is nil.
+func (r *ObfRecorder) Annotate(a FrameAnnotator) {
+	r.annotator = a
+}
+
 func (r *ObfRecorder) Init() error {
 	r.channels = 0
+	r.dataType = DataTypeRaw
+	r.infos = nil
+	if r.annotator != nil {
+		r.annotator.Reset()
+	}
+	r.events = nil
+	r.stats = NewStats(0)
 	r.samples = 0
 	r.sampleRate = 0
 	r.tsFirst = 0
 	r.tsLast = 0
 	r.fc = 0
 	r.buf = bytes.Buffer{}
+	r.paused, r.pause, r.resumed = false, nil, false
+	return nil
+}
+
+// Pause the recording after the last frame. Frames are not
+// recorded until Resume() is called, and the pause is marked
+// with an EventPause whose duration reaches the EventResume
+// of the first frame after it.
+func (r *ObfRecorder) Pause() error {
+	if r.paused {
+		return fmt.Errorf("already paused")
+	}
+	r.paused = true
+	if r.fc == 0 {
+		return nil // nothing to mark yet
+	}
+	r.pause = &Event{
+		Timestamp: ToTs64(r.tsLast),
+		Code:      EventPause,
+		Label:     "pause",
+		Source:    "recorder",
+	}
+	r.events = append(r.events, r.pause)
+	return nil
+}
+
+// Resume the recording with the next frame.
+func (r *ObfRecorder) Resume() error {
+	if !r.paused {
+		return fmt.Errorf("not paused")
+	}
+	r.paused = false
+	r.resumed = r.pause != nil
 	return nil
 }
 
@@ -59,6 +139,9 @@ func (r *ObfRecorder) RecordFrame(df DataFrame) error {
 	if df == nil {
 		return nil
 	}
+	if r.paused {
+		return fmt.Errorf("the recording is paused")
+	}
 	r.fc++
 
 	// on the first frame, obtain the first timestamp
@@ -72,18 +155,57 @@ func (r *ObfRecorder) RecordFrame(df DataFrame) error {
 			r.sampleRate = df.SampleRate()
 			r.channels = b.Channels()
 		}
+		r.infos = df.ChannelInfos()
+		if r.counts && df.Ints() != nil {
+			r.dataType = DataTypeCounts
+		}
+	}
+	if r.annotator != nil {
+		df = r.annotator.AnnotateFrame(df)
 	}
 	buf := df.Buffer()
 	samples := buf.Samples()
 	r.samples += samples
 
+	// mark the end of the pause at the first sample
+	if r.resumed {
+		ts := ToTs64(r.tsTransform(buf.Timestamps()[0]))
+		r.pause.Duration = ts - r.pause.Timestamp
+		r.events = append(r.events, &Event{
+			Timestamp: ts,
+			Code:      EventResume,
+			Label:     "resume",
+			Source:    "recorder",
+		})
+		r.pause, r.resumed = nil, false
+	}
+
 	// get the last timestamp
 	r.tsLast = r.tsTransform(buf.Timestamps()[samples-1])
+	r.stats.Add(buf)
+
+	// keep the events, like gaps, on the same time scale
+	// as the payload so that readers can line them up
+	for _, e := range df.Events() {
+		if e.Timestamp < r.tsFirst {
+			continue // before the recording
+		}
+		ee := *e
+		ee.Timestamp = ToTs64(r.tsTransform(e.Timestamp))
+		r.events = append(r.events, &ee)
+	}
 
 	// write the frame, or send back an error
 	// we are using synchronization to protect the buffer
 	r.Lock()
 	defer r.Unlock()
+	if r.dataType == DataTypeCounts {
+		ints := df.Ints()
+		if ints == nil {
+			return fmt.Errorf("frame %d has no device counts", r.fc)
+		}
+		return WriteParallelCounts(&r.buf, ints.BlockBuffer(buf.Timestamps()), r.tsTransform)
+	}
 	return WriteParallel(&r.buf, df.Buffer(), r.tsTransform)
 }
 
@@ -121,15 +243,22 @@ func (r *ObfRecorder) commit() (id string, err error) {
 	// get the codec
 	r.codec = NewLiveObfCodec(r.file)
 
+	// collect the extension blocks
+	exts, err := r.extensions()
+	if err != nil {
+		return "", err
+	}
+
 	// write the header
 	header := &ObfHeader{
-		DataType:      DataTypeRaw,
+		DataType:      r.dataType,
 		FormatVersion: ObfDefaultFormatVersion,
 		StorageMode:   StorageModeCombined,
 		Channels:      uint8(r.channels),
 		Samples:       uint32(r.samples),
 		SampleRate:    uint16(r.sampleRate),
 		Endianness:    ObfDefaultByteOrder,
+		Extensions:    uint8(len(exts)),
 	}
 	if err = r.codec.WriteHeader(header); err != nil {
 		return "", err
@@ -142,18 +271,25 @@ func (r *ObfRecorder) commit() (id string, err error) {
 	}
 	r.Unlock()
 
-	//read the parallel frames from the buffer as a BlockBuffer
-	var b *BlockBuffer
-	b, err = r.codec.Parallel()
-	if err != nil {
-		return "", err
-	}
+	// read the parallel frames from the buffer as a BlockBuffer
+	// and write them sequentially; an empty recording has neither
+	if r.samples > 0 {
+		var b *BlockBuffer
+		b, err = r.codec.Parallel()
+		if err != nil {
+			return "", err
+		}
 
-	if err = r.codec.SeekSequential(); err != nil {
-		return "", err
+		if err = r.codec.SeekSequential(); err != nil {
+			return "", err
+		}
+
+		if err = r.codec.WriteSequential(b, ToTs32); err != nil {
+			return "", err
+		}
 	}
 
-	if err = r.codec.WriteSequential(b, ToTs32); err != nil {
+	if err = r.codec.WriteExtensions(exts); err != nil {
 		return "", err
 	}
 
@@ -161,6 +297,32 @@ func (r *ObfRecorder) commit() (id string, err error) {
 	return
 }
 
+// The extension blocks describing this recording.
+func (r *ObfRecorder) extensions() (exts []*ObfExtension, err error) {
+	if r.infos != nil {
+		e, err := NewJsonExtension(ExtChannels, r.infos)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, e)
+	}
+	if r.events != nil {
+		e, err := NewJsonExtension(ExtEvents, r.events)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, e)
+	}
+	if stats := r.stats.Session(); stats != nil {
+		e, err := NewJsonExtension(ExtStats, stats)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, e)
+	}
+	return
+}
+
 func (r *ObfRecorder) RollbackFile() {
 	fileName := r.file.Name()
 	log.Printf("ObfRecorder: rolling back %s due to error", fileName)
@@ -4,11 +4,58 @@
 package recorder
 
 import (
-// "encoding/binary"
-// "log"
-// "os"
-// "path/filepath"
-// "testing"
+	// "encoding/binary"
+	// "log"
+	// "os"
+	// "path/filepath"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/obf"
+	"testing"
+	"time"
 )
 
 const testRepo = "../var"
+
+// a frame of two samples, 1ms apart, starting at ts
+func pauseFrame(ts int64) DataFrame {
+	b := NewBlockBuffer(1, 2)
+	b.AppendSample([]float64{1}, ts)
+	b.AppendSample([]float64{2}, ts+int64(time.Millisecond))
+	return NewDataFrame(b, 1000)
+}
+
+func TestObfRecorder__Pause(t *testing.T) {
+	r := NewObfRecorder(nil)
+	r.Init()
+	if err := r.Resume(); err == nil {
+		t.Errorf("should not resume without a pause")
+	}
+
+	start := time.Now().UnixNano()
+	r.RecordFrame(pauseFrame(start))
+	if err := r.Pause(); err != nil {
+		t.Fatalf("could not pause: %v", err)
+	}
+	if err := r.Pause(); err == nil {
+		t.Errorf("should not pause twice")
+	}
+	if err := r.RecordFrame(pauseFrame(start + int64(2*time.Millisecond))); err == nil {
+		t.Errorf("should not record while paused")
+	}
+	r.Resume()
+	r.RecordFrame(pauseFrame(start + int64(10*time.Millisecond)))
+
+	if len(r.events) != 2 {
+		t.Fatalf("expected a pause and a resume: %v", r.events)
+	}
+	pause, resume := r.events[0], r.events[1]
+	if pause.Code != EventPause || resume.Code != EventResume {
+		t.Errorf("bad codes: %d, %d", pause.Code, resume.Code)
+	}
+	if pause.Timestamp != ToTs64(1) || resume.Timestamp != ToTs64(10) {
+		t.Errorf("bad timestamps: %d, %d", pause.Timestamp, resume.Timestamp)
+	}
+	if pause.Duration != resume.Timestamp-pause.Timestamp {
+		t.Errorf("bad duration: %d", pause.Duration)
+	}
+}
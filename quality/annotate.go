@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package quality
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	. "github.com/jbrukh/goavatar/obf"
+	"log"
+)
+
+// ----------------------------------------------------------------- //
+// Annotating DataFrames and Subscriptions
+// ----------------------------------------------------------------- //
+
+// Annotator annotates a stream of DataFrames with the artifacts
+// found by a Detector, which is set up by the first frame.
+type Annotator struct {
+	cfg DetectorConfig
+	d   *Detector
+}
+
+// Create a new Annotator with the given configuration.
+func NewAnnotator(cfg DetectorConfig) *Annotator {
+	return &Annotator{cfg: cfg}
+}
+
+// AnnotateFrame runs the frame through the detector and returns
+// a DataFrame that also carries an EventArtifact for every
+// artifact in the windows that the frame completes. Since a
+// window is only assessed once it is complete, the annotations
+// may start before the frame. Frames that complete no window
+// are returned as they are.
+func (a *Annotator) AnnotateFrame(df DataFrame) DataFrame {
+	if a.d == nil {
+		a.d = NewDetector(df.SampleRate(), df.ChannelInfos(), a.cfg)
+	}
+	as := a.d.Detect(df.Buffer())
+	if len(as) == 0 {
+		return df
+	}
+	events := append([]*Event(nil), df.Events()...)
+	for _, x := range as {
+		events = append(events, x.Events(df.ChannelInfos())...)
+	}
+	SortEvents(events)
+	return NewDataFrameWithInts(df.Buffer(), df.Ints(), df.SampleRate(), df.ChannelInfos(), events)
+}
+
+// Forget the stream, so that the next frame sets up the
+// detector anew.
+func (a *Annotator) Reset() {
+	a.d = nil
+}
+
+// Process annotates the frame, so that an Annotator
+// can be part of a Pipeline.
+func (a *Annotator) Process(df DataFrame) DataFrame {
+	return a.AnnotateFrame(df)
+}
+
+// Annotate annotates a stream of DataFrames. The output channel
+// is closed when the input channel is closed.
+func Annotate(in <-chan DataFrame, cfg DetectorConfig) chan DataFrame {
+	out := make(chan DataFrame, DataFrameBufferSize)
+	go func() {
+		defer close(out)
+		a := NewAnnotator(cfg)
+		for df := range in {
+			out <- a.AnnotateFrame(df)
+		}
+	}()
+	return out
+}
+
+// SubscribeAnnotated subscribes to the device under the given
+// name and delivery policy and returns a channel of annotated
+// DataFrames. The channel is closed when the subscription ends.
+func SubscribeAnnotated(d Device, name string, policy DeliveryPolicy, cfg DetectorConfig) (chan DataFrame, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("bad detector: window (%v)", cfg.Window)
+	}
+	log.Printf("annotating subscription '%s'", name)
+	return d.SubscribeProcessed(name, policy, NewAnnotator(cfg))
+}
+
+// ----------------------------------------------------------------- //
+// Offline Detection
+// ----------------------------------------------------------------- //
+
+// DetectObf assesses an entire OBF file, returning the
+// assessments and the channel descriptions of the file, if
+// it has them. No window spans a gap in the recording, and
+// the incomplete windows before gaps and at the end of the
+// file are not assessed.
+func DetectObf(r ObfReader, cfg DetectorConfig) ([]*Assessment, []*ChannelInfo, error) {
+	b, err := r.Parallel()
+	if err != nil {
+		return nil, nil, err
+	}
+	exts, err := r.Extensions()
+	if err != nil {
+		return nil, nil, err
+	}
+	infos, err := ChannelInfosExtension(exts)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := EventsExtension(exts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if r.Header().SampleRate == 0 {
+		return nil, nil, fmt.Errorf("the file has no sample rate")
+	}
+
+	var (
+		d  = NewDetector(int(r.Header().SampleRate), infos, cfg)
+		as []*Assessment
+	)
+	for _, run := range SplitAtGaps(b, events) {
+		d.Reset()
+		as = append(as, d.Detect(run)...)
+	}
+	return as, infos, nil
+}
@@ -0,0 +1,380 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package quality
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/spectral"
+	"math"
+	"strings"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Artifacts
+// ----------------------------------------------------------------- //
+
+// Artifact is a set of flags describing what is wrong with
+// a channel during some window of time.
+type Artifact uint8
+
+const (
+	ArtifactSaturation Artifact = 1 << iota // the signal reached either end of the converter
+	ArtifactFlatline                        // the signal barely moved, like a disconnected electrode
+	ArtifactLineNoise                       // the signal is dominated by the mains frequency
+	ArtifactTransient                       // the signal made a large excursion, like a blink
+)
+
+var artifactNames = []string{"saturation", "flatline", "line noise", "transient"}
+
+// The individual artifacts in the set.
+func (a Artifact) Kinds() (kinds []Artifact) {
+	for i := range artifactNames {
+		if k := Artifact(1 << uint(i)); a&k != 0 {
+			kinds = append(kinds, k)
+		}
+	}
+	return
+}
+
+func (a Artifact) String() string {
+	if a == 0 {
+		return "clean"
+	}
+	var names []string
+	for i, name := range artifactNames {
+		if a&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ----------------------------------------------------------------- //
+// Configuration
+// ----------------------------------------------------------------- //
+
+// DetectorConfig holds the thresholds of a Detector. The
+// amplitudes are in the units of the channels, which are
+// volts for the AvatarEEG.
+type DetectorConfig struct {
+	Window             time.Duration // length of the windows that are assessed
+	SaturationMargin   float64       // fraction of the converter range, at either end, that counts as saturated
+	FlatlineDeviation  float64       // standard deviation below which a channel is flat
+	LineFrequency      float64       // mains frequency, in Hz
+	LineNoiseRatio     float64       // fraction of the power within LineBandwidth of the mains above which a channel is noisy
+	TransientAmplitude float64       // distance from the trend of the window above which a sample is a transient
+}
+
+// The width of the band around the mains frequency, in Hz.
+const LineBandwidth = 4
+
+// The default configuration assesses windows of one second
+// of EEG in volts, on 60 Hz mains.
+func DefaultDetectorConfig() DetectorConfig {
+	return DetectorConfig{
+		Window:             time.Second,
+		SaturationMargin:   0.001,
+		FlatlineDeviation:  0.5e-6,
+		LineFrequency:      60,
+		LineNoiseRatio:     0.5,
+		TransientAmplitude: 100e-6,
+	}
+}
+
+// ----------------------------------------------------------------- //
+// Assessments
+// ----------------------------------------------------------------- //
+
+// Assessment describes the artifacts found in each channel
+// during a window of time.
+type Assessment struct {
+	Timestamp int64      // timestamp of the first sample of the window
+	Duration  int64      // length of the window, in nanoseconds
+	Artifacts []Artifact // the artifacts, by channel
+}
+
+// Clean returns true if and only if no artifacts were
+// found in channel c.
+func (a *Assessment) Clean(c int) bool {
+	return a.Artifacts[c] == 0
+}
+
+// Events annotates the assessment with one event per
+// artifact per channel, spanning the window. The infos may
+// be nil, in which case the channels are labeled Ch1, ..., Chn.
+func (a *Assessment) Events(infos []*ChannelInfo) (events []*Event) {
+	for c, artifact := range a.Artifacts {
+		label := fmt.Sprintf("Ch%d", c+1)
+		if c < len(infos) {
+			label = infos[c].Label
+		}
+		for _, k := range artifact.Kinds() {
+			events = append(events, &Event{
+				Timestamp: a.Timestamp,
+				Code:      EventArtifact,
+				Label:     k.String() + " on " + label,
+				Source:    label,
+				Duration:  a.Duration,
+			})
+		}
+	}
+	return
+}
+
+// ----------------------------------------------------------------- //
+// Detector
+// ----------------------------------------------------------------- //
+
+// Detector finds artifacts in a stream of BlockBuffers. The
+// stream is cut into consecutive windows and every EEG channel
+// of every window is assessed for saturation (if the range of
+// the channel is known), flatlines, line noise and transients.
+// Samples that are NaN, like those standing in for a gap, are
+// ignored.
+type Detector struct {
+	cfg        DetectorConfig
+	sampleRate int
+	infos      []*ChannelInfo
+	window     *RingBuffer
+}
+
+// Create a Detector for a stream at the given sample rate,
+// whose channels are described by infos. If the infos are nil,
+// every channel is assumed to carry EEG.
+func NewDetector(sampleRate int, infos []*ChannelInfo, cfg DetectorConfig) *Detector {
+	if sampleRate < 1 {
+		panic("sample rate must be positive")
+	}
+	if cfg.Window <= 0 {
+		panic("window must be positive")
+	}
+	return &Detector{
+		cfg:        cfg,
+		sampleRate: sampleRate,
+		infos:      infos,
+	}
+}
+
+// The number of samples in each window.
+func (d *Detector) WindowSamples() int {
+	n := samplesIn(d.cfg.Window, d.sampleRate)
+	if n < 2 {
+		n = 2
+	}
+	return n
+}
+
+// Detect consumes the buffer and returns the assessments of
+// the windows that it completes, if any.
+func (d *Detector) Detect(b *BlockBuffer) (as []*Assessment) {
+	if d.window == nil {
+		d.window = NewRingBuffer(b.Channels(), d.WindowSamples(), OverwriteOldest)
+	}
+	for s := 0; s < b.Samples(); s++ {
+		d.window.AppendSample(b.Sample(s))
+		if d.window.Full() {
+			as = append(as, d.Assess(d.window.Slice(0, d.window.Samples())))
+			d.window.Reset()
+		}
+	}
+	return
+}
+
+// Forget the samples of the incomplete window, for instance
+// when the signal is discontinuous.
+func (d *Detector) Reset() {
+	if d.window != nil {
+		d.window.Reset()
+	}
+}
+
+// Assess a single window of samples.
+func (d *Detector) Assess(b *BlockBuffer) *Assessment {
+	var (
+		samples = b.Samples()
+		ts      = b.Timestamps()
+		a       = &Assessment{
+			Timestamp: ts[0],
+			Duration:  int64(samples) * int64(time.Second) / int64(d.sampleRate),
+			Artifacts: make([]Artifact, b.Channels()),
+		}
+		lines = d.lineNoise(b)
+	)
+	for c := range a.Artifacts {
+		if c < len(d.infos) && d.infos[c].Kind != KindEEG {
+			continue
+		}
+		v := b.Channel(c)
+		if c < len(d.infos) && d.infos[c].HasRange() {
+			info := d.infos[c]
+			if saturated(v, info.Min, info.Max, d.cfg.SaturationMargin) {
+				a.Artifacts[c] |= ArtifactSaturation
+			}
+		}
+		r, ok := residuals(v)
+		if !ok {
+			continue // nothing but gaps
+		}
+		if deviation(r) < d.cfg.FlatlineDeviation {
+			a.Artifacts[c] |= ArtifactFlatline
+		}
+		if peak(r) > d.cfg.TransientAmplitude {
+			a.Artifacts[c] |= ArtifactTransient
+		}
+		if lines != nil && lines[c] > d.cfg.LineNoiseRatio {
+			a.Artifacts[c] |= ArtifactLineNoise
+		}
+	}
+	return a
+}
+
+// The line noise ratio of every channel, or nil if the
+// sample rate is too low to see the mains.
+func (d *Detector) lineNoise(b *BlockBuffer) []float64 {
+	if d.cfg.LineFrequency+LineBandwidth/2 >= float64(d.sampleRate)/2 {
+		return nil
+	}
+	s := Welch(withoutNaN(b), d.sampleRate, WelchConfig{
+		Segment: b.Samples(),
+		Window:  Hann,
+	})
+	ratios := make([]float64, b.Channels())
+	for c := range ratios {
+		ratios[c] = LineNoiseRatio(s, c, d.cfg.LineFrequency)
+	}
+	return ratios
+}
+
+// LineNoiseRatio gives the fraction of the power of channel
+// c of the spectral density that lies within LineBandwidth of
+// the mains frequency, ignoring frequencies below 1 Hz.
+func LineNoiseRatio(s *Spectrum, c int, freq float64) float64 {
+	var (
+		line  = Band{Name: "line", Low: freq - LineBandwidth/2, High: freq + LineBandwidth/2}
+		all   = Band{Name: "all", Low: 1, High: float64(s.SampleRate) / 2}
+		total = s.BandPower(c, all)
+	)
+	if total <= 0 {
+		return 0
+	}
+	return s.BandPower(c, line) / total
+}
+
+// ----------------------------------------------------------------- //
+// Helpers
+// ----------------------------------------------------------------- //
+
+// Whether any value is within the margin of either end
+// of the range.
+func saturated(v []float64, min, max, margin float64) bool {
+	m := margin * (max - min)
+	for _, x := range v {
+		if x <= min+m || x >= max-m {
+			return true
+		}
+	}
+	return false
+}
+
+// The least-squares line through the values, with x being
+// the index of the sample, leaving out NaN. Returns false if
+// all are NaN.
+func linearFit(v []float64) (intercept, slope float64, ok bool) {
+	var n, sx, sy, sxx, sxy float64
+	for i, y := range v {
+		if math.IsNaN(y) {
+			continue
+		}
+		x := float64(i)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	if d := n*sxx - sx*sx; d != 0 {
+		slope = (n*sxy - sx*sy) / d
+	}
+	return (sy - slope*sx) / n, slope, true
+}
+
+// The distances of the values from their least-squares
+// line, leaving out NaN. Returns false if all are NaN.
+func residuals(v []float64) ([]float64, bool) {
+	intercept, slope, ok := linearFit(v)
+	if !ok {
+		return nil, false
+	}
+	r := make([]float64, 0, len(v))
+	for i, y := range v {
+		if !math.IsNaN(y) {
+			r = append(r, y-intercept-slope*float64(i))
+		}
+	}
+	return r, true
+}
+
+// The standard deviation of residuals, which have zero mean.
+func deviation(r []float64) float64 {
+	var ss float64
+	for _, x := range r {
+		ss += x * x
+	}
+	return math.Sqrt(ss / float64(len(r)))
+}
+
+// The largest magnitude.
+func peak(r []float64) (p float64) {
+	for _, x := range r {
+		p = math.Max(p, math.Abs(x))
+	}
+	return
+}
+
+// A copy of the buffer in which NaN is replaced by the
+// mean of the other values of its channel, so that gaps
+// do not spoil the spectrum.
+func withoutNaN(b *BlockBuffer) *BlockBuffer {
+	var (
+		samples  = b.Samples()
+		channels = b.Channels()
+		means    = make([]float64, channels)
+		nan      bool
+	)
+	for c := range means {
+		var sum, n float64
+		for _, x := range b.Channel(c) {
+			if math.IsNaN(x) {
+				nan = true
+				continue
+			}
+			sum += x
+			n++
+		}
+		if n > 0 {
+			means[c] = sum / n
+		}
+	}
+	if !nan {
+		return b
+	}
+	bb := NewBlockBuffer(channels, samples)
+	v := make([]float64, channels)
+	for s := 0; s < samples; s++ {
+		x, ts := b.Sample(s)
+		for c := range v {
+			v[c] = x[c]
+			if math.IsNaN(v[c]) {
+				v[c] = means[c]
+			}
+		}
+		bb.AppendSample(v, ts)
+	}
+	return bb
+}
@@ -0,0 +1,203 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package quality
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	. "github.com/jbrukh/goavatar/spectral"
+	"log"
+	"math"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Signal Quality
+// ----------------------------------------------------------------- //
+
+// Grades of signal quality.
+const (
+	GradeGood = "good"
+	GradeFair = "fair"
+	GradeBad  = "bad"
+)
+
+// ChannelQuality describes the recent signal of an EEG channel.
+type ChannelQuality struct {
+	Channel   int     `json:"channel"`    // index of the channel in the frames
+	Label     string  `json:"label"`      // label of the channel
+	Rms       float64 `json:"rms"`        // root mean square about the trend, in channel units
+	LineNoise float64 `json:"line_noise"` // fraction of the power at the mains frequency
+	Drift     float64 `json:"drift"`      // slope of the trend, in channel units per second
+	Grade     string  `json:"grade"`      // one of {"good", "fair", "bad"}
+}
+
+// QualityReport holds the quality of every EEG channel.
+type QualityReport struct {
+	Timestamp int64             `json:"timestamp"` // timestamp of the last sample assessed
+	Channels  []*ChannelQuality `json:"channels"`  // by EEG channel
+}
+
+// ----------------------------------------------------------------- //
+// Monitor
+// ----------------------------------------------------------------- //
+
+// Monitor periodically grades the contact quality of every
+// EEG channel of a device from its most recent data. A channel
+// is bad if it is flat, like a disconnected electrode, or if
+// any of its measures is beyond the bad threshold, and fair if
+// any is beyond the fair threshold. The amplitudes are in the
+// units of the channels, which are volts for the AvatarEEG.
+type Monitor struct {
+	Length        time.Duration // amount of data in each report
+	Interval      time.Duration // time between reports
+	LineFrequency float64       // mains frequency, in Hz
+
+	MinRms        float64 // RMS below which a channel is flat
+	FairRms       float64 // RMS above which a channel is fair
+	BadRms        float64 // RMS above which a channel is bad
+	FairLineNoise float64 // line noise ratio above which a channel is fair
+	BadLineNoise  float64 // line noise ratio above which a channel is bad
+	FairDrift     float64 // drift magnitude above which a channel is fair
+	BadDrift      float64 // drift magnitude above which a channel is bad
+}
+
+// Create a Monitor that reports on the last two seconds of
+// data every second, with thresholds for EEG in volts on 60 Hz
+// mains.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		Length:        2 * time.Second,
+		Interval:      time.Second,
+		LineFrequency: 60,
+		MinRms:        0.5e-6,
+		FairRms:       50e-6,
+		BadRms:        150e-6,
+		FairLineNoise: 0.3,
+		BadLineNoise:  0.6,
+		FairDrift:     100e-6,
+		BadDrift:      1e-3,
+	}
+}
+
+// Subscribe to the device under the given name and produce
+// a QualityReport every Interval, once Length of data has
+// arrived. The output channel closes when the subscription
+// closes. A slow reader of the reports loses the oldest
+// frames rather than holding up the device.
+func (m *Monitor) Subscribe(d Device, name string) (chan *QualityReport, error) {
+	if m.Interval <= 0 || m.Length <= 0 {
+		return nil, fmt.Errorf("bad monitor: length (%v); interval (%v)", m.Length, m.Interval)
+	}
+	in, err := d.SubscribeWithPolicy(name, DeliverDropOldest)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *QualityReport, DataFrameBufferSize)
+	go func() {
+		defer close(out)
+		m.run(in, out)
+		log.Printf("quality subscription '%s' closed", name)
+	}()
+	return out, nil
+}
+
+func (m *Monitor) run(in <-chan DataFrame, out chan<- *QualityReport) {
+	var (
+		b        *RingBuffer
+		rate     int
+		interval int // samples between reports
+		pending  int // samples since the last report
+	)
+	for df := range in {
+		if b == nil {
+			rate = df.SampleRate()
+			interval = samplesIn(m.Interval, rate)
+			b = NewRingBuffer(df.Buffer().Channels(), samplesIn(m.Length, rate), OverwriteOldest)
+		}
+		b.Append(df.Buffer())
+		pending += df.Buffer().Samples()
+
+		if !b.Full() || pending < interval {
+			continue
+		}
+		pending = 0
+		out <- m.Assess(b.Slice(0, b.Samples()), rate, df.ChannelInfos())
+	}
+}
+
+// Assess the quality of the EEG channels of the buffer,
+// whose channels are described by infos. If the infos are
+// nil, every channel is assumed to carry EEG.
+func (m *Monitor) Assess(b *BlockBuffer, sampleRate int, infos []*ChannelInfo) *QualityReport {
+	var (
+		ts    = b.Timestamps()
+		r     = &QualityReport{Timestamp: ts[len(ts)-1]}
+		lines []float64
+	)
+	if m.LineFrequency+LineBandwidth/2 < float64(sampleRate)/2 {
+		segment := sampleRate
+		if segment > b.Samples() {
+			segment = b.Samples()
+		}
+		s := Welch(withoutNaN(b), sampleRate, WelchConfig{
+			Segment: segment,
+			Overlap: 0.5,
+			Window:  Hann,
+		})
+		for c := 0; c < b.Channels(); c++ {
+			lines = append(lines, LineNoiseRatio(s, c, m.LineFrequency))
+		}
+	}
+
+	for c := 0; c < b.Channels(); c++ {
+		label := fmt.Sprintf("Ch%d", c+1)
+		if c < len(infos) {
+			if infos[c].Kind != KindEEG {
+				continue
+			}
+			label = infos[c].Label
+		}
+		v := b.Channel(c)
+		_, slope, ok := linearFit(v)
+		if !ok {
+			continue // nothing but gaps
+		}
+		resid, _ := residuals(v)
+		q := &ChannelQuality{
+			Channel: c,
+			Label:   label,
+			Rms:     deviation(resid),
+			Drift:   slope * float64(sampleRate),
+		}
+		if lines != nil {
+			q.LineNoise = lines[c]
+		}
+		q.Grade = m.grade(q)
+		r.Channels = append(r.Channels, q)
+	}
+	return r
+}
+
+func (m *Monitor) grade(q *ChannelQuality) string {
+	drift := math.Abs(q.Drift)
+	switch {
+	case q.Rms < m.MinRms, q.Rms > m.BadRms, q.LineNoise > m.BadLineNoise, drift > m.BadDrift:
+		return GradeBad
+	case q.Rms > m.FairRms, q.LineNoise > m.FairLineNoise, drift > m.FairDrift:
+		return GradeFair
+	}
+	return GradeGood
+}
+
+// The number of samples in the duration at the sample
+// rate, at least 1.
+func samplesIn(d time.Duration, sampleRate int) int {
+	n := int(d * time.Duration(sampleRate) / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,287 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package quality
+
+import (
+	"bytes"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/obf"
+	"math"
+	"testing"
+)
+
+const testRate = 256
+
+// The channels of the test signal, one per artifact, in
+// volts on a converter from 0 V to 1 V.
+const (
+	chClean = iota
+	chSaturated
+	chFlat
+	chNoisy
+	chBlink
+	chKeypad
+	testChannels
+)
+
+func testInfos() []*ChannelInfo {
+	infos := EEGChannelInfos(testChannels-1, "V", 1e-7)
+	for _, info := range infos {
+		info.Max = 1
+	}
+	return append(infos, &ChannelInfo{Label: "Keypad", Kind: KindTrigger, Scale: 1})
+}
+
+// Samples of the test signal, with 10 Hz EEG of 20 µV on
+// every channel but the flat one and the keypad.
+func testBuffer(samples int) *BlockBuffer {
+	b := NewBlockBuffer(testChannels, samples)
+	v := make([]float64, testChannels)
+	for s := 0; s < samples; s++ {
+		var (
+			t   = float64(s) / testRate
+			eeg = 0.5 + 20e-6*math.Sin(2*math.Pi*10*t)
+		)
+		v[chClean] = eeg
+		v[chSaturated] = math.Min(eeg+0.4999, 1)
+		v[chFlat] = 0.5
+		v[chNoisy] = eeg + 60e-6*math.Sin(2*math.Pi*60*t)
+		v[chBlink] = eeg
+		if s%testRate == testRate/2 {
+			v[chBlink] += 300e-6
+		}
+		v[chKeypad] = 0
+		b.AppendSample(v, int64(s)*1000000000/testRate)
+	}
+	return b
+}
+
+func TestArtifact__String(t *testing.T) {
+	if s := Artifact(0).String(); s != "clean" {
+		t.Errorf("wrong name: %s", s)
+	}
+	a := ArtifactFlatline | ArtifactTransient
+	if s := a.String(); s != "flatline|transient" {
+		t.Errorf("wrong name: %s", s)
+	}
+	if k := a.Kinds(); len(k) != 2 || k[0] != ArtifactFlatline || k[1] != ArtifactTransient {
+		t.Errorf("wrong kinds: %v", k)
+	}
+}
+
+func TestDetector(t *testing.T) {
+	var (
+		d  = NewDetector(testRate, testInfos(), DefaultDetectorConfig())
+		b  = testBuffer(2*testRate + 100)
+		as []*Assessment
+	)
+	// in uneven chunks
+	for from := 0; from < b.Samples(); from += 100 {
+		to := from + 100
+		if to > b.Samples() {
+			to = b.Samples()
+		}
+		as = append(as, d.Detect(b.Slice(from, to))...)
+	}
+	if len(as) != 2 {
+		t.Fatalf("expected 2 windows, got %d", len(as))
+	}
+	if as[1].Timestamp != 1000000000 || as[1].Duration != 1000000000 {
+		t.Errorf("wrong window: %d %d", as[1].Timestamp, as[1].Duration)
+	}
+
+	expected := []Artifact{
+		chClean:     0,
+		chSaturated: ArtifactSaturation,
+		chFlat:      ArtifactFlatline,
+		chNoisy:     ArtifactLineNoise,
+		chBlink:     ArtifactTransient,
+		chKeypad:    0,
+	}
+	for _, a := range as {
+		for c, x := range expected {
+			if a.Artifacts[c] != x {
+				t.Errorf("channel %d: expected %v, got %v", c, x, a.Artifacts[c])
+			}
+		}
+	}
+
+	// a higher threshold tolerates the blink
+	cfg := DefaultDetectorConfig()
+	cfg.TransientAmplitude = 400e-6
+	if a := NewDetector(testRate, testInfos(), cfg).Assess(b.Slice(0, testRate)); !a.Clean(chBlink) {
+		t.Errorf("expected no transient: %v", a.Artifacts[chBlink])
+	}
+}
+
+func TestDetector__NaN(t *testing.T) {
+	var (
+		d          = NewDetector(testRate, nil, DefaultDetectorConfig())
+		b          = testBuffer(testRate).SelectChannels(chClean, chNoisy)
+		values, ts = b.Arrays()
+		bb         = NewBlockBuffer(3, testRate)
+	)
+	for s := range ts {
+		v := []float64{values[0][s], values[1][s], math.NaN()}
+		if s < testRate/4 {
+			v[0], v[1] = math.NaN(), math.NaN()
+		}
+		bb.AppendSample(v, ts[s])
+	}
+	a := d.Assess(bb)
+	if !a.Clean(0) || a.Artifacts[1] != ArtifactLineNoise || !a.Clean(2) {
+		t.Errorf("wrong artifacts around NaN: %v", a.Artifacts)
+	}
+}
+
+func TestAssessment__Events(t *testing.T) {
+	a := &Assessment{
+		Timestamp: 42,
+		Duration:  1000,
+		Artifacts: []Artifact{0, ArtifactSaturation | ArtifactFlatline},
+	}
+	events := a.Events(nil)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	e := events[1]
+	if e.Code != EventArtifact || e.Timestamp != 42 || e.Duration != 1000 ||
+		e.Source != "Ch2" || e.Label != "flatline on Ch2" {
+		t.Errorf("wrong event: %+v", e)
+	}
+}
+
+func TestAnnotator(t *testing.T) {
+	var (
+		a      = NewAnnotator(DefaultDetectorConfig())
+		b      = testBuffer(testRate + 64)
+		first  = NewDataFrameWithChannels(b.Slice(0, testRate-64), testRate, testInfos())
+		second = NewDataFrameWithChannels(b.Slice(testRate-64, testRate+64), testRate, testInfos())
+	)
+	if df := a.AnnotateFrame(first); df != first {
+		t.Errorf("expected the frame to pass through")
+	}
+	df := a.AnnotateFrame(second)
+	var sources []string
+	for _, e := range df.Events() {
+		if e.Code != EventArtifact || e.Timestamp != 0 {
+			t.Errorf("wrong event: %+v", e)
+		}
+		sources = append(sources, e.Source)
+	}
+	if len(sources) != 4 || sources[0] != "Ch2" || sources[3] != "Ch5" {
+		t.Errorf("wrong annotations: %v", sources)
+	}
+	if df.Buffer() != second.Buffer() || df.SampleRate() != testRate {
+		t.Errorf("the frame was not kept")
+	}
+}
+
+func TestDetectObf(t *testing.T) {
+	var (
+		b = testBuffer(3 * testRate)
+		h = &ObfHeader{
+			DataType:      DataTypeRaw,
+			FormatVersion: FormatVersion2_2,
+			StorageMode:   StorageModeCombined,
+			Channels:      testChannels,
+			Samples:       uint32(b.Samples()),
+			SampleRate:    testRate,
+			Extensions:    2,
+		}
+		buf bytes.Buffer
+	)
+	// a gap in the middle of the second second
+	var (
+		ts  = ToTs64(ToTs32(b.Timestamps()[testRate+testRate/2]))
+		gap = &Event{Timestamp: ts, Code: EventGap, Duration: 1}
+	)
+	e1, _ := NewJsonExtension(ExtChannels, testInfos())
+	e2, _ := NewJsonExtension(ExtEvents, []*Event{gap})
+	WriteHeader(&buf, h)
+	WriteParallel(&buf, b, ToTs32)
+	WriteSequential(&buf, b, ToTs32)
+	WriteExtensions(&buf, []*ObfExtension{e1, e2})
+
+	r, err := NewObfReader(&buf)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	as, infos, err := DetectObf(r, DefaultDetectorConfig())
+	if err != nil {
+		t.Fatalf("could not detect: %v", err)
+	}
+	if len(infos) != testChannels || infos[chKeypad].Label != "Keypad" {
+		t.Errorf("channels not read")
+	}
+	if len(as) != 2 {
+		t.Fatalf("expected a window on either side of the gap, got %d", len(as))
+	}
+	if as[0].Artifacts[chSaturated] != ArtifactSaturation || as[1].Artifacts[chFlat] != ArtifactFlatline {
+		t.Errorf("wrong artifacts: %v %v", as[0].Artifacts, as[1].Artifacts)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	var (
+		m   = NewMonitor()
+		b   = testBuffer(3 * testRate)
+		in  = make(chan DataFrame)
+		out = make(chan *QualityReport, 10)
+	)
+	go func() {
+		for from := 0; from < b.Samples(); from += 64 {
+			in <- NewDataFrameWithChannels(b.Slice(from, from+64), testRate, testInfos())
+		}
+		close(in)
+	}()
+	m.run(in, out)
+	close(out)
+
+	var reports []*QualityReport
+	for r := range out {
+		reports = append(reports, r)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(reports))
+	}
+	r := reports[1]
+	if _, ts := b.Sample(b.Samples() - 1); r.Timestamp != ts {
+		t.Errorf("wrong timestamp: %d", r.Timestamp)
+	}
+	if len(r.Channels) != testChannels-1 {
+		t.Fatalf("expected only the EEG channels: %d", len(r.Channels))
+	}
+	expected := []string{GradeGood, GradeGood, GradeBad, GradeBad, GradeGood}
+	for c, q := range r.Channels {
+		if q.Channel != c || q.Grade != expected[c] {
+			t.Errorf("channel %d: expected %s, got %+v", c, expected[c], q)
+		}
+	}
+	if q := r.Channels[chClean]; !near(q.Rms, 20e-6/math.Sqrt2, 1e-6) || q.LineNoise > 0.01 {
+		t.Errorf("wrong measures: %+v", q)
+	}
+	if q := r.Channels[chNoisy]; q.LineNoise < 0.8 {
+		t.Errorf("wrong line noise: %+v", q)
+	}
+}
+
+func TestMonitor__Drift(t *testing.T) {
+	var (
+		m = NewMonitor()
+		b = NewBlockBuffer(1, 2*testRate)
+	)
+	for s := 0; s < 2*testRate; s++ {
+		t := float64(s) / testRate
+		b.AppendSample([]float64{20e-6*math.Sin(2*math.Pi*10*t) + 500e-6*t}, int64(s))
+	}
+	q := m.Assess(b, testRate, nil).Channels[0]
+	if !near(q.Drift, 500e-6, 1e-6) || q.Grade != GradeFair {
+		t.Errorf("wrong drift: %+v", q)
+	}
+}
+
+func near(x, y, tolerance float64) bool {
+	return math.Abs(x-y) <= tolerance
+}
@@ -5,6 +5,7 @@ package repo
 
 import (
 	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
 	. "github.com/jbrukh/goavatar/obf"
 	. "github.com/jbrukh/goavatar/util"
 	"os"
@@ -38,11 +39,12 @@ var (
 
 // Resource information from the repo.
 type ResourceInfo struct {
-	Id           string `json:"id"` // this is the resourceId
-	File         string `json:"file"`
-	SizeBytes    int64  `json:"size_bytes"`
-	LastModified int64  `json:"last_modified"`
-	Duration     int64  `json:"duration"`
+	Id           string          `json:"id"` // this is the resourceId
+	File         string          `json:"file"`
+	SizeBytes    int64           `json:"size_bytes"`
+	LastModified int64           `json:"last_modified"`
+	Duration     int64           `json:"duration"`
+	Stats        []*ChannelStats `json:"stats,omitempty"` // statistics of each channel, computed when recorded
 }
 
 // ----------------------------------------------------------------- //
@@ -199,14 +201,16 @@ func (r *Repository) ClearCache() (err error) {
 // List all the resources in a subdirectory.
 func (r *Repository) list(subdir string) (infos []*ResourceInfo, err error) {
 	err = r.forEach(subdir, func(path string, f os.FileInfo) error {
-		// best-effort duration here
+		// best-effort duration and statistics here
 		duration, _ := ApproxDurationMs(path)
+		stats, _ := readStats(path)
 		infos = append(infos, &ResourceInfo{
 			Id:           f.Name(),
 			File:         path,
 			SizeBytes:    f.Size(),
 			LastModified: f.ModTime().Unix(),
 			Duration:     int64(duration),
+			Stats:        stats,
 		})
 		return nil
 	})
@@ -285,6 +289,25 @@ func (r *Repository) subdirPath(subdir string) string {
 	return filepath.Join(r.basedir, subdir)
 }
 
+// Returns the channel statistics stored in an OBF file, if
+// it has them.
+func readStats(path string) ([]*ChannelStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	codec, err := NewObfCodec(file)
+	if err != nil {
+		return nil, err
+	}
+	exts, err := codec.Extensions()
+	if err != nil {
+		return nil, err
+	}
+	return StatsExtension(exts)
+}
+
 // Returns the full path of a resource id, given the subdir.
 func (r *Repository) resourcePath(subdir, resourceId string) string {
 	return filepath.Join(r.subdirPath(subdir), resourceId)
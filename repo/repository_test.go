@@ -4,6 +4,8 @@
 package repo
 
 import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/obf"
 	"os"
 	"path/filepath"
 	"testing"
@@ -245,6 +247,62 @@ func TestListing(t *testing.T) {
 	checkListing()
 }
 
+func TestListing__Stats(t *testing.T) {
+	r, err := NewRepository(testBaseDir)
+	if err != nil {
+		t.Fatalf("could not create the directories")
+	}
+	r.clear(SubdirDefault)
+
+	// a recording with statistics
+	var (
+		id, path = r.NewResourceId()
+		b        = NewBlockBuffer(1, 3)
+	)
+	for s, x := range []float64{1, 2, 6} {
+		b.AppendSample([]float64{x}, int64(s)*1000000)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("could not create the file: %v", err)
+	}
+	e, _ := NewJsonExtension(ExtStats, ComputeStats(b))
+	WriteHeader(file, &ObfHeader{
+		DataType:      DataTypeRaw,
+		FormatVersion: FormatVersion2_2,
+		StorageMode:   StorageModeCombined,
+		Channels:      1,
+		Samples:       3,
+		SampleRate:    1000,
+		Extensions:    1,
+	})
+	WriteParallel(file, b, ToTs32)
+	WriteSequential(file, b, ToTs32)
+	WriteExtensions(file, []*ObfExtension{e})
+	file.Close()
+
+	// and one without
+	if err := touchFile(r.resourcePath(SubdirDefault, "30dbbd1d-6426-baaf-9eab-29ad6e6740fc")); err != nil {
+		t.Errorf("could not touch test path")
+	}
+
+	infos, err := r.List()
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("could not get listing: %v", err)
+	}
+	for _, info := range infos {
+		if info.Id != id {
+			if info.Stats != nil {
+				t.Errorf("expected no stats for an empty file")
+			}
+			continue
+		}
+		if len(info.Stats) != 1 || info.Stats[0].Mean != 3 || info.Stats[0].Max != 6 {
+			t.Errorf("wrong stats: %+v", info.Stats)
+		}
+	}
+}
+
 func TestInvalidId(t *testing.T) {
 	resourceId := "invalid-id"
 	r, err := NewRepository(testBaseDir)
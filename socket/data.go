@@ -5,9 +5,15 @@ package socket
 
 import (
 	"code.google.com/p/go.net/websocket"
+	"context"
 	"fmt"
 	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	"github.com/jbrukh/goavatar/dsp"
+	. "github.com/jbrukh/goavatar/quality"
 	"log"
+	"math"
+	"strconv"
 )
 
 func sendData(dataConn *websocket.Conn, s *SocketSession) {
@@ -16,16 +22,28 @@ func sendData(dataConn *websocket.Conn, s *SocketSession) {
 	msg.Success = false
 	// we connect and begin to stream
 	if !s.device.Engaged() {
-		err := s.device.Engage()
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultEngageTimeout)
+		err := s.device.Engage(ctx)
+		cancel()
 		if err != nil {
 			log.Printf("could not connect: %v", err)
-			msg.Err = fmt.Sprintf("could not connect to the device")
-			msg.Status = "disarmed"
+			msg.Err = fmt.Sprintf("could not connect to the device: %v", err)
+			msg.Status = s.device.State().String()
+			Send(s.conn, msg)
+			return
+		}
+
+		// the sample rate may not have been known when
+		// the client connected
+		if err := checkPps(s.pps, s.ints, s.device.Info().SampleRate); err != nil {
+			s.device.Disengage()
+			msg.Err = err.Error()
+			msg.Status = s.device.State().String()
 			Send(s.conn, msg)
 			return
 		}
 		msg.Success = true
-		msg.Status = "streaming"
+		msg.Status = s.device.State().String()
 		Send(s.conn, msg)
 		stream(dataConn, s)
 	} else {
@@ -42,7 +60,19 @@ func stream(dataConn *websocket.Conn, s *SocketSession) {
 
 	// device stuff
 	defer s.device.Disengage()
-	out, err := s.device.Subscribe("datasocket")
+	// the client sees its own view of the stream: annotated,
+	// if asked, before any channels are left out
+	var pipeline Pipeline
+	if s.artifacts {
+		pipeline = pipeline.Then(NewAnnotator(DefaultDetectorConfig()))
+	}
+	if len(s.channels) > 0 {
+		pipeline = pipeline.Then(NewChannelSelector(s.channels...))
+	}
+
+	// a slow client loses its oldest frames rather than
+	// holding up the device and the recorders
+	out, err := s.device.SubscribeProcessed("datasocket", DeliverDropOldest, pipeline)
 	if err != nil {
 		log.Printf("could not subscribe to device: %s", err)
 		return
@@ -56,75 +86,128 @@ func stream(dataConn *websocket.Conn, s *SocketSession) {
 	var (
 		channels   = df.Buffer().Channels()
 		sampleRate = df.SampleRate()
+		infos      = df.ChannelInfos()
 	)
 
-	// check the parameters
-	if s.pps < 1 || s.pps > sampleRate {
-		s.pps = DefaultPps
-		log.Printf("WARNING: setting default PPS")
-	}
+	// check the parameters; pps has been checked
+	// against the sample rate already
 	if s.batchSize > s.pps || s.batchSize < 1 {
 		s.batchSize = DefaultBatchSize
 		log.Printf("WARNING: setting default batchSize")
 	}
 
-	streamLoop(dataConn, s, channels, sampleRate, out)
+	streamLoop(dataConn, s, channels, sampleRate, infos, out)
 }
 
-func streamLoop(dataConn *websocket.Conn, s *SocketSession, channels, sampleRate int, out <-chan DataFrame) {
+func streamLoop(dataConn *websocket.Conn, s *SocketSession, channels, sampleRate int, infos []*ChannelInfo, out <-chan DataFrame) {
 	var (
-		kill         = make(chan bool)
-		pluckRate    = sampleRate / s.pps      // now we need to sample every sampleRate/pps points
-		absBatchSize = s.batchSize * pluckRate // actual number of data points we must read in order to obtain a sampled batch of batchSize
-		b            = NewBlockBuffer(channels, sampleRate*s.batchSize*10)
-
-		shouldReturn = func() bool {
-			select {
-			case <-kill:
-				return true
-			default:
-			}
-			return false
-		}
+		rs     = dsp.NewResampler(sampleRate, s.pps) // deliver exactly pps points per second
+		b      = NewRingBuffer(channels, s.pps*s.batchSize*10, OverwriteOldest)
+		events []*Event // events not yet sent
+		data   [][]float64
+		counts [][]float64
+		lost   uint64 // samples dropped so far
+
+		// the raw device counts, if requested; they are only
+		// sent at the sample rate, where the resampler passes
+		// the values through and they match sample for sample
+		ib *RingBuffer
 	)
-
-	b.PluckRate(pluckRate)
+	if s.ints {
+		ib = NewRingBuffer(channels, b.Capacity(), OverwriteOldest)
+	}
 
 	for {
-		// break if there was an error sending
-		// a message over the socket
-		var (
-			df DataFrame
-			ok bool
-		)
-
-		if df, ok = <-out; !ok || shouldReturn() {
+		df, ok := <-out
+		if !ok {
 			return
 		}
 
-		// put the frame into our memory buffer
-		b.Append(df.Buffer())
+		// resample the frame to pps, then put it into our
+		// memory buffer; if the client falls too far behind, the
+		// oldest data is dropped
+		b.Append(rs.Resample(df.Buffer()))
+		if d := b.Dropped(); d > lost {
+			log.Printf("WARNING: stream buffer is full, dropped %d samples", d-lost)
+			lost = d
+		}
+		events = append(events, df.Events()...)
+		if ib != nil {
+			if ints := df.Ints(); ints != nil {
+				ib.Append(ints.BlockBuffer(df.Buffer().Timestamps()))
+			} else {
+				log.Printf("WARNING: device does not provide counts, not sending ints")
+				ib = nil
+			}
+		}
 
 		// while there are batches, return them
-		for b.Samples() > absBatchSize {
-			if shouldReturn() {
-				return
+		for b.Samples() > s.batchSize {
+			// the arrays are sent before the next batch
+			// is popped, so their storage is reused
+			msg := new(DataMessage)
+			data = b.PopArrays(s.batchSize, data)
+			msg.Data = Values(data)
+			if ib != nil {
+				counts = ib.PopArrays(s.batchSize, counts)
+				msg.Ints = toInts(counts)
 			}
 
-			var (
-				batch = b.PopDownSample(absBatchSize)
-				msg   = new(DataMessage)
-			)
+			// describe the channels once
+			msg.Channels = infos
+			infos = nil
+
+			// and the events as soon as possible
+			msg.Events = events
+			events = nil
 
-			msg.Data, _ = batch.Arrays()
 			if *verboseSocket {
 				log.Printf("sending data msg: %+v", msg)
 			}
 			err := websocket.JSON.Send(dataConn, msg)
 			if err != nil {
 				log.Printf("error sending data msg: %v\n", err)
-				kill <- true
+				return
 			}
 		}
 	}
 }
+
+// Encode the values, with null for the missing samples.
+func (v Values) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	buf := []byte{'['}
+	for c, values := range v {
+		if c > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '[')
+		for s, x := range values {
+			if s > 0 {
+				buf = append(buf, ',')
+			}
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				buf = append(buf, "null"...)
+			} else {
+				buf = strconv.AppendFloat(buf, x, 'g', -1, 64)
+			}
+		}
+		buf = append(buf, ']')
+	}
+	return append(buf, ']'), nil
+}
+
+// Convert the counts, which the ring buffer holds as floats,
+// back to integers.
+func toInts(counts [][]float64) [][]int64 {
+	ints := make([][]int64, len(counts))
+	for c, v := range counts {
+		ints[c] = make([]int64, len(v))
+		for s, x := range v {
+			ints[c][s] = int64(math.Floor(x + 0.5))
+		}
+	}
+	return ints
+}
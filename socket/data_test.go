@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package socket
+
+import (
+	"code.google.com/p/go.net/websocket"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+// Stream the frames to a websocket client, and return the
+// values of the first channel that it receives until the
+// stream ends; nil stands for a missing sample.
+func streamFrames(t *testing.T, s *SocketSession, sampleRate int, frames ...DataFrame) (values []*float64) {
+	out := make(chan DataFrame, len(frames))
+	for _, df := range frames {
+		out <- df
+	}
+	close(out)
+
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		streamLoop(conn, s, 1, sampleRate, nil, out)
+	}))
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws://"+server.Listener.Addr().String(), "", "http://localhost/")
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close()
+	for {
+		var msg struct {
+			Data [][]*float64 `json:"data"`
+		}
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return
+		}
+		values = append(values, msg.Data[0]...)
+	}
+}
+
+func TestStreamLoop__Gap(t *testing.T) {
+	var (
+		s = &SocketSession{pps: 125, batchSize: 5}
+		b = NewBlockBuffer(1, 200)
+	)
+	for i := 0; i < 200; i++ {
+		x := float64(i % 10)
+		if i >= 100 && i < 104 {
+			x = math.NaN() // a gap, as filled under GapNaN
+		}
+		b.AppendSample([]float64{x}, int64(i)*4000000)
+	}
+
+	var missing, after int
+	for _, x := range streamFrames(t, s, 250, NewDataFrame(b, 250)) {
+		switch {
+		case x == nil:
+			missing++
+		case missing > 0:
+			after++
+		}
+	}
+	if missing == 0 {
+		t.Errorf("the gap should be sent as null")
+	}
+	if after == 0 {
+		t.Errorf("the stream should go on after the gap")
+	}
+}
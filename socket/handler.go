@@ -12,7 +12,6 @@ import (
 	"fmt"
 	. "github.com/jbrukh/goavatar"
 	. "github.com/jbrukh/goavatar/device"
-	. "github.com/jbrukh/goavatar/obf/recorder"
 	. "github.com/jbrukh/goavatar/util"
 	"io"
 	"io/ioutil"
@@ -29,12 +28,14 @@ import (
 const (
 	DefaultControlEndpoint = "/control"
 	DefaultDataEndpoint    = "/device"
+	DefaultMetricsEndpoint = "/metrics"
 	DefaultListenPort      = 8000
 )
 
 var (
 	controlEndpoint *string = flag.String("controlEndpoint", DefaultControlEndpoint, "the websocket url for control messages")
 	dataEndpoint    *string = flag.String("dataEndpoint", DefaultDataEndpoint, "the websocket url for data messages")
+	metricsEndpoint *string = flag.String("metricsEndpoint", DefaultMetricsEndpoint, "the http url for device metrics, as text or, with ?format=json, as JSON")
 	listenPort      *int    = flag.Int("listenPort", DefaultListenPort, "the websocket port on which to listen")
 	verboseSocket   *bool   = flag.Bool("verboseSocket", false, "the websocket is verbose")
 )
@@ -46,6 +47,11 @@ var (
 const (
 	DefaultPps       = 125
 	DefaultBatchSize = 25
+	MaxPps           = 1000 // the highest sample rate of the supported devices
+
+	QualitySubscription      = "quality" // prefix of the subscription of each session
+	DefaultQualityIntervalMs = 1000
+	MinQualityIntervalMs     = 100
 )
 
 // The OctopusSocket.
@@ -86,6 +92,7 @@ Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
 	fmt.Printf("Device:   %v\n", s.device.Name())
 	fmt.Printf("Control:  http://localhost:%d%s\n", *listenPort, *controlEndpoint)
 	fmt.Printf("Data:     http://localhost:%d%s\n", *listenPort, *dataEndpoint)
+	fmt.Printf("Metrics:  http://localhost:%d%s\n", *listenPort, *metricsEndpoint)
 	fmt.Printf("Repo:     %v\n\n", absRepo)
 
 	// ensure the repository exists
@@ -95,6 +102,7 @@ Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
 
 	http.Handle(*controlEndpoint, wsControl)
 	http.Handle(*dataEndpoint, wsData)
+	http.HandleFunc(*metricsEndpoint, s.handleMetrics)
 
 	if err := http.ListenAndServe(port, nil); err != nil {
 		log.Fatalf("could not start OctopusSocket: %v", err)
@@ -111,15 +119,27 @@ func (s *OctopusSocket) handleControlConn(conn *websocket.Conn) {
 
 	uuid, _ := Uuid()
 	session := &SocketSession{
-		conn:      conn,
-		pairingId: uuid,
-		device:    s.device, // in the future we can instantiate device based on message
-		pps:       s.pps,
-		batchSize: s.batchSize,
-		kickoff:   s.kickoff,
-		recorder:  NewDeviceRecorder(s.device, NewObfRecorder(s.device.Repo())),
+		conn:       conn,
+		pairingId:  uuid,
+		device:     s.device, // in the future we can instantiate device based on message
+		pps:        s.pps,
+		batchSize:  s.batchSize,
+		kickoff:    s.kickoff,
+		recordings: make(map[string]*DeviceRecorder),
 	}
 	log.Printf("got session: %+v", session)
+
+	// the quality reports end with the session
+	defer s.device.Unsubscribe(session.qualitySubscription())
+
+	// tell the client about every change of state
+	if changes, err := s.device.SubscribeState(uuid); err != nil {
+		log.Printf("could not subscribe to device state: %v", err)
+	} else {
+		defer s.device.UnsubscribeState(uuid)
+		go session.pushState(changes)
+	}
+
 	// keep processing as long as we are connected
 	for {
 		msgBytes, msgBase, err := Receive(conn)
@@ -151,6 +171,30 @@ func (s *OctopusSocket) handleDataConn(conn *websocket.Conn) {
 	}
 }
 
+// --------------------------------------------------------- //
+// Metrics Handler
+// --------------------------------------------------------- //
+
+// Serve the metrics of the device as text, or as JSON if
+// the format parameter asks for it.
+func (s *OctopusSocket) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		m   = s.device.Metrics()
+		err error
+	)
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(m)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "device %s\nstatus %s\n", s.device.Name(), s.device.State())
+		err = m.WriteText(w)
+	}
+	if err != nil {
+		log.Printf("could not send metrics: %v", err)
+	}
+}
+
 // --------------------------------------------------------- //
 // Socket Helpers
 // --------------------------------------------------------- //
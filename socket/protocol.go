@@ -4,6 +4,9 @@
 package socket
 
 import (
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	. "github.com/jbrukh/goavatar/quality"
 	. "github.com/jbrukh/goavatar/repo"
 )
 
@@ -16,7 +19,7 @@ type (
 	// Base type for messages.
 	Message struct {
 		Id          string `json:"id"`           // should be non-empty
-		MessageType string `json:"message_type"` // will be one of {"info", connect", "record", "upload", "error"}
+		MessageType string `json:"message_type"` // will be one of {"info", connect", "record", "upload", "repository", "quality", "configure", "marker", "error"}
 	}
 
 	// Basic information about the server.
@@ -33,19 +36,46 @@ type (
 		Id          string `json:"id"`           // should be non-empty
 		MessageType string `json:"message_type"` // should be "connect"
 		Connect     bool   `json:"connect"`      // boolean to engage or disengage the device
-		Pps         int    `json:"pps"`          // points per second, one of 250, 125, 83, ..., 250/k
+		Pps         int    `json:"pps"`          // points per second, up to the sample rate of the device
 		BatchSize   int    `json:"batch_size"`   // points to return per batch
+		Ints        bool   `json:"ints"`         // whether to also send the raw device counts, if there are any; pps must be the sample rate
+		Artifacts   bool   `json:"artifacts"`    // whether to annotate the data and recordings with artifact events
+		Channels    []int  `json:"channels"`     // the channels to stream, counting from 0, or empty for all; recordings keep all of them
 	}
 
 	// RecordMessage is used to trigger recording on
 	// a device connection that is engaged. A RecordResponseMessage
 	// is sent to indicate success (if recording has commenced) or
-	// failure (if the device is off, or other errors).
+	// failure (if the device is off, or other errors). Several
+	// recordings may be in progress at once, each with its own
+	// RecordingId, which the response to their start gives.
 	RecordMessage struct {
 		Id           string `json:"id"`           // should be non-empty
 		MessageType  string `json:"message_type"` // should be "record"
-		Record       bool   `json:"record"`       // start or stop recording
+		Record       bool   `json:"record"`       // start a new recording, or stop one
+		Operation    string `json:"operation"`    // one of {"pause", "resume", "status"} to pause, resume or report on recording instead
+		RecordingId  string `json:"recording_id"` // the recording to stop, pause or resume, which may be left out when there is only one
 		Milliseconds int    `json:"milliseconds"` // number of milliseconds after which to cease recording
+		PreMs        int    `json:"pre_ms"`       // number of milliseconds before the message to record first, as far as the device keeps them
+		Channels     []int  `json:"channels"`     // the channels to record, counting from 0, or empty for all
+		Counts       bool   `json:"counts"`       // whether to record the raw counts of the device, if it has them, instead of the values
+
+		StartTrigger *TriggerSpec `json:"start_trigger"` // when to start recording, or null to start at once
+		StopTrigger  *TriggerSpec `json:"stop_trigger"`  // when to cease recording after the start, if ever
+		PostMs       int          `json:"post_ms"`       // number of milliseconds after the start at which to cease recording, if positive
+	}
+
+	// TriggerSpec describes a moment in the stream at which a
+	// recording starts or stops. The start of a recording is
+	// at the first sample at which its StartTrigger fires, and
+	// the Milliseconds of a fixed-time recording count from it.
+	TriggerSpec struct {
+		Kind    string  `json:"kind"`    // one of {"threshold", "edge", "marker"}
+		Channel int     `json:"channel"` // the channel of a "threshold" trigger, counting from 0
+		Level   float64 `json:"level"`   // the level that a "threshold" trigger crosses
+		Falling bool    `json:"falling"` // whether a "threshold" trigger fires when falling to the level, rather than rising
+		Source  string  `json:"source"`  // the trigger input of an "edge" trigger, like "Keypad" or "Optical", if the device streams it
+		Label   string  `json:"label"`   // the label of the markers of a "marker" trigger (see MarkerMessage)
 	}
 
 	// UploadMessage is used to trigger upload of a
@@ -81,10 +111,42 @@ type (
 		ResourceId  string `json:"resource_id"`  // delete a specific file, in the case of "delete" or "get"
 	}
 
+	// QualityMessage turns the signal quality reports of
+	// an engaged device on or off. While they are on, a
+	// QualityResponse is sent every IntervalMs.
+	QualityMessage struct {
+		Id          string `json:"id"`           // should be non-empty
+		MessageType string `json:"message_type"` // should be "quality"
+		Enable      bool   `json:"enable"`       // start or stop the reports
+		IntervalMs  int    `json:"interval_ms"`  // milliseconds between reports, DefaultQualityIntervalMs if 0
+	}
+
+	// ConfigureMessage chooses the settings of a device that
+	// is not engaged, which take effect when it is next connected.
+	// Without Configure, the settings are only reported. The zero
+	// values stand for the defaults of the device.
+	ConfigureMessage struct {
+		Id          string `json:"id"`           // should be non-empty
+		MessageType string `json:"message_type"` // should be "configure"
+		Configure   bool   `json:"configure"`    // whether to change the settings
+		SampleRate  int    `json:"sample_rate"`  // samples per second, per channel
+		Channels    []int  `json:"channels"`     // the data channels to stream, counting from 0
+		Trigger     bool   `json:"trigger"`      // whether to stream the trigger channels
+	}
+
+	// MarkerMessage marks the stream of an engaged device with
+	// a named marker, like the onset of a stimulus, which is
+	// recorded as an event and may start or stop recordings.
+	MarkerMessage struct {
+		Id          string `json:"id"`           // should be non-empty
+		MessageType string `json:"message_type"` // should be "marker"
+		Label       string `json:"label"`        // the name of the marker
+	}
+
 	// Base type for response messages.
 	Response struct {
 		Id          string `json:"id"`           // echo of your correlation id
-		MessageType string `json:"message_type"` // will be one of {"info", connect", "record", "upload", "error"}
+		MessageType string `json:"message_type"` // will be one of {"info", connect", "record", "upload", "repository", "quality", "configure", "marker", "state", "error"}
 		Success     bool   `json:"success"`      // whether or not the control message was successful
 		Err         string `json:"err"`          // error text, if any
 	}
@@ -96,7 +158,8 @@ type (
 		MessageType string `json:"message_type"` // will be "connect"
 		Success     bool   `json:"success"`      // whether or not the control message was successful
 		Err         string `json:"err"`          // error text, if any
-		Status      string `json:"status"`       // device status, one of {"armed", "busy", "disconnected"}
+		Status      string `json:"status"`       // device state, one of {"idle", "engaging", "streaming", "reconnecting", "disengaging", "error"}
+		Armed       bool   `json:"armed"`        // whether the data endpoint will stream once it is connected
 	}
 
 	// RecordResponseMessage is sent in response to a RecordMessage.
@@ -109,6 +172,9 @@ type (
 		ResourceId   string `json:"resource_id"`  // id of the resource
 		Milliseconds int    `json:"milliseconds"` // number of milliseconds recorder if this was a fixed-time recording
 		PairingId    string `json:"pairing_id"`   // the connector session that made this recording (see InfoResponse.PairingId)
+		Paused       bool   `json:"paused"`       // whether the recording is paused
+		RecordingId  string `json:"recording_id"` // the recording, which is one of several that may be in progress
+		Armed        bool   `json:"armed"`        // whether the recording is waiting for its start trigger
 	}
 
 	// UploadResponse is sent in response to an UploadMessage, providing
@@ -123,13 +189,15 @@ type (
 
 	// InfoResponse sends back information about the device and server.
 	InfoResponse struct {
-		Id          string `json:"id"`           // echo of your correlation id
-		MessageType string `json:"message_type"` // will be "info"
-		Success     bool   `json:"success"`      // whether or not the control message was successful
-		Err         string `json:"err"`          // error text, if any
-		Version     string `json:"version"`      // octopus server version
-		DeviceName  string `json:"device_name"`  // device name
-		PairingId   string `json:"pairing_id"`   // session id, lives for the life of control socket connection
+		Id          string           `json:"id"`           // echo of your correlation id
+		MessageType string           `json:"message_type"` // will be "info"
+		Success     bool             `json:"success"`      // whether or not the control message was successful
+		Err         string           `json:"err"`          // error text, if any
+		Version     string           `json:"version"`      // octopus server version
+		DeviceName  string           `json:"device_name"`  // device name
+		PairingId   string           `json:"pairing_id"`   // session id, lives for the life of control socket connection
+		Status      string           `json:"status"`       // device state, one of {"idle", "engaging", "streaming", "reconnecting", "disengaging", "error"}
+		Metrics     *MetricsSnapshot `json:"metrics"`      // the health of the link to the device, since it was connected
 	}
 
 	// RepositoryResponse sends back messages about repository operations.
@@ -142,15 +210,68 @@ type (
 		ResourceInfos []*ResourceInfo `json:"resource_infos"` // list of files and infos
 	}
 
+	// QualityResponse is sent in response to a QualityMessage,
+	// and then with every signal quality report, which grades each
+	// EEG channel as one of {"good", "fair", "bad"}.
+	QualityResponse struct {
+		Id          string            `json:"id"`                 // echo of your correlation id
+		MessageType string            `json:"message_type"`       // will be "quality"
+		Success     bool              `json:"success"`            // whether or not the control message was successful
+		Err         string            `json:"err"`                // error text, if any
+		Timestamp   int64             `json:"timestamp"`          // timestamp of the last sample of the report
+		Channels    []*ChannelQuality `json:"channels,omitempty"` // the quality of each EEG channel, in reports only
+	}
+
+	// ConfigureResponse is sent in response to a ConfigureMessage,
+	// with the settings that the device supports and the current
+	// ones, whether or not they changed.
+	ConfigureResponse struct {
+		Id           string              `json:"id"`                     // echo of your correlation id
+		MessageType  string              `json:"message_type"`           // will be "configure"
+		Success      bool                `json:"success"`                // whether or not the control message was successful
+		Err          string              `json:"err"`                    // error text, if any
+		Capabilities *DeviceCapabilities `json:"capabilities,omitempty"` // the supported settings, if the device can be configured
+		Config       DeviceConfig        `json:"config"`                 // the current settings
+	}
+
+	// MarkerResponse is sent in response to a MarkerMessage.
+	MarkerResponse struct {
+		Id          string `json:"id"`           // echo of your correlation id
+		MessageType string `json:"message_type"` // will be "marker"
+		Success     bool   `json:"success"`      // whether or not the control message was successful
+		Err         string `json:"err"`          // error text, if any
+	}
+
+	// StateResponse is pushed whenever the device changes state,
+	// without being asked for. The states are those of InfoResponse.
+	StateResponse struct {
+		Id          string `json:"id"`           // empty, since nothing was asked
+		MessageType string `json:"message_type"` // will be "state"
+		Success     bool   `json:"success"`      // always true
+		Err         string `json:"err"`          // error text, if any
+		From        string `json:"from"`         // the previous state
+		To          string `json:"to"`           // the new state
+		Reason      string `json:"reason"`       // what caused the change
+		Timestamp   int64  `json:"timestamp"`    // when the change happened, in nanoseconds
+	}
+
 	// DataMessage returns datapoints from the device across
 	// the channels. These data points represent incremental data
 	// that has not been seen before. The data messages come at a
-	// frequency specified in the initial control messages.
+	// frequency specified in the initial control messages. The
+	// first message of a stream describes the channels.
 	DataMessage struct {
-		Data      [][]float64 `json:"data"`       // the data for each channel, only first n relevant, n == # of channels
-		Ints      [][]int64   `json:"ints"`       // the data for each channel, as integers
-		LatencyMs float64     `json:"latency_ms"` // the running latency
+		Data      Values         `json:"data"`               // the data for each channel, only first n relevant, n == # of channels
+		Ints      [][]int64      `json:"ints"`               // the raw device counts for each channel, if requested, unresampled
+		Channels  []*ChannelInfo `json:"channels,omitempty"` // descriptions of the channels, in the first message only
+		Events    []*Event       `json:"events,omitempty"`   // events since the last message, like trigger edges
+		LatencyMs float64        `json:"latency_ms"`         // the running latency
 		//Timestamp int64      `json:"timestamp"` // timestamp corresponding to this data sample
 
 	}
+
+	// Values are the data of each channel. The samples that
+	// are missing (NaN, see GapNaN) are sent as null, since
+	// JSON has no NaN.
+	Values [][]float64
 )
@@ -9,9 +9,13 @@ import (
 	"fmt"
 	. "github.com/jbrukh/goavatar"
 	. "github.com/jbrukh/goavatar/device"
+	. "github.com/jbrukh/goavatar/obf/recorder"
+	. "github.com/jbrukh/goavatar/quality"
 	"log"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 )
 
 //---------------------------------------------------------//
@@ -27,8 +31,14 @@ type SocketSession struct {
 	pairingId string
 	pps       int
 	batchSize int
+	ints      bool
+	artifacts bool
+	channels  []int
 	kickoff   chan *SocketSession
-	recorder  *DeviceRecorder
+
+	// the recordings in progress, by recorder id
+	recordingsLock sync.Mutex
+	recordings     map[string]*DeviceRecorder
 }
 
 func (s *SocketSession) Process(msgBytes []byte, msgBase Message) {
@@ -51,6 +61,15 @@ func (s *SocketSession) Process(msgBytes []byte, msgBase Message) {
 	case "repository":
 		s.ProcessRepositoryMessage(msgBytes, msgBase.Id)
 
+	case "quality":
+		s.ProcessQualityMessage(msgBytes, msgBase.Id)
+
+	case "configure":
+		s.ProcessConfigureMessage(msgBytes, msgBase.Id)
+
+	case "marker":
+		s.ProcessMarkerMessage(msgBytes, msgBase.Id)
+
 	default:
 		errStr := fmt.Sprintf("unknown message type: '%s'", msgType)
 		SendError(s.conn, msgBase.Id, errStr)
@@ -70,6 +89,8 @@ func (s *SocketSession) ProcessInfoMessage(msgBytes []byte, id string) {
 	r.Version = Version()
 	r.DeviceName = s.device.Name()
 	r.PairingId = s.pairingId
+	r.Status = s.device.State().String()
+	r.Metrics = s.device.Metrics()
 
 	Send(s.conn, r)
 }
@@ -85,17 +106,18 @@ func (s *SocketSession) ProcessConnectMessage(msgBytes []byte, id string) {
 	r.MessageType = "connect"
 	r.Id = msg.Id
 	r.Success = false
-	defer Send(s.conn, r)
+	defer func() {
+		r.Status = s.device.State().String()
+		Send(s.conn, r)
+	}()
 
 	// should we disconnect?
 	if !msg.Connect {
 		err := s.device.Disengage()
 		if err != nil {
-			r.Status = "error"
 			r.Err = err.Error()
 		} else {
 			r.Success = true
-			r.Status = "disarmed"
 			// also, disarm the device
 			select {
 			case <-s.kickoff:
@@ -109,8 +131,8 @@ func (s *SocketSession) ProcessConnectMessage(msgBytes []byte, id string) {
 	if msg.Connect {
 
 		// are the parameters sane?
-		if msg.Pps < 1 || msg.Pps > 250 {
-			r.Err = "pps should be between 1 and 250"
+		if err := checkPps(msg.Pps, msg.Ints, s.sampleRate()); err != nil {
+			r.Err = err.Error()
 			return
 		}
 
@@ -119,9 +141,15 @@ func (s *SocketSession) ProcessConnectMessage(msgBytes []byte, id string) {
 			return
 		}
 
+		for _, c := range msg.Channels {
+			if c < 0 {
+				r.Err = fmt.Sprintf("bad channel: %d", c)
+				return
+			}
+		}
+
 		// maybe someone is already using it
 		if s.device.Engaged() {
-			r.Status = "busy"
 			r.Err = "device is already connected"
 			return
 		}
@@ -137,19 +165,22 @@ func (s *SocketSession) ProcessConnectMessage(msgBytes []byte, id string) {
 			// attempting to connect to the data endpoint
 			s.pps = msg.Pps
 			s.batchSize = msg.BatchSize
+			s.ints = msg.Ints
+			s.artifacts = msg.Artifacts
+			s.channels = msg.Channels
 
 			// device can accept a value, meaning
 			// no one request for connection is in
 			// an "armed" state, so we have succeeded
 			r.Success = true
-			r.Status = "armed"
+			r.Armed = true
 			return
 
 		default:
 			// the kickoff channel is blocked, so some
 			// other request has armed the device for
 			// streaming
-			r.Status = "armed"
+			r.Armed = true
 			r.Err = "device is already armed"
 			return
 		}
@@ -168,6 +199,7 @@ func (s *SocketSession) ProcessRecordMessage(msgBytes []byte, id string) {
 	r.Id = msg.Id
 	r.Success = false
 	r.PairingId = s.pairingId
+	r.RecordingId = msg.RecordingId
 	suppress := false
 
 	// by default, send the response
@@ -182,65 +214,198 @@ func (s *SocketSession) ProcessRecordMessage(msgBytes []byte, id string) {
 		return
 	}
 
-	if msg.Record {
-		if s.recorder.Recording() {
-			r.Err = "already recording"
+	// every start is a new recording, which runs
+	// alongside the others
+	if msg.Record && msg.Operation == "" {
+		recorder, err := s.newRecording(&msg)
+		if err != nil {
+			r.Err = err.Error()
 			return
 		}
+		r.RecordingId = recorder.Id()
+		r.Armed = recorder.Armed()
+		r.Success = true
+		return
+	}
 
-		// if this is a fixed-time session,
-		// then wait for the recording to stop
-		if msg.Milliseconds > 0 {
-			// calculate how many data points we need
-			points := msg.Milliseconds * s.device.Info().SampleRate / 1000
-			log.Printf("FIXED TIME RECORDING: %d milliseconds, %d points", msg.Milliseconds, points)
-
-			s.recorder.SetMax(points)
-			go func() {
-				ar := new(RecordResponse)
-				ar.MessageType = "record"
-				ar.Id = msg.Id
-				ar.Success = false
-
-				info, err := s.recorder.Wait()
-				if err != nil {
-					log.Printf("error during fixed-time recording: %v", err)
-					ar.Err = err.Error()
-				} else {
-					ar.Success = true
-				}
-
-				ar.ResourceId = info.ResourceId
-				ar.Milliseconds = int(info.DurationMs)
-				Send(s.conn, ar)
-			}()
-		}
+	// anything else is about a recording in progress
+	recorder, err := s.recording(msg.RecordingId)
+	if err != nil {
+		r.Err = err.Error()
+		return
+	}
+	r.RecordingId = recorder.Id()
 
-		// kick off the recording, always going to
-		// the local directory
-		err = s.recorder.RecordAsync()
+	// pause or resume the recording, which stays
+	// one resource, or tell how it is doing
+	switch msg.Operation {
+	case "pause":
+		err = recorder.Pause()
+	case "resume":
+		err = recorder.Resume()
+	case "status", "":
+	default:
+		err = fmt.Errorf("unknown operation: %s", msg.Operation)
+	}
+	if msg.Operation != "" {
 		if err != nil {
 			r.Err = err.Error()
-			return
+		} else {
+			r.Success = true
 		}
-		r.Success = true
+		r.Paused = recorder.Paused()
+		r.Armed = recorder.Armed()
+		return
+	}
 
-	} else if !msg.Record {
-		if s.recorder.RecordingTimed() {
-			s.recorder.Release()
-			// don't send a response in this case
-			suppress = true
-		} else {
-			info, err := s.recorder.Stop()
-			if err == nil {
-				r.Success = true
-				r.ResourceId = info.ResourceId
-				r.Milliseconds = int(info.DurationMs)
+	if recorder.RecordingFinite() {
+		recorder.Release()
+		// don't send a response in this case
+		suppress = true
+	} else {
+		info, err := recorder.Stop()
+		s.endRecording(recorder)
+		if err == nil {
+			r.Success = true
+			r.ResourceId = info.ResourceId
+			r.Milliseconds = int(info.DurationMs)
+		}
+	}
+}
+
+// Start a new recording as the message asks.
+func (s *SocketSession) newRecording(msg *RecordMessage) (*DeviceRecorder, error) {
+	if msg.PreMs < 0 {
+		return nil, fmt.Errorf("pre_ms should not be negative")
+	}
+	if msg.PostMs < 0 {
+		return nil, fmt.Errorf("post_ms should not be negative")
+	}
+	for _, c := range msg.Channels {
+		if c < 0 {
+			return nil, fmt.Errorf("bad channel: %d", c)
+		}
+	}
+	start, err := newTrigger(msg.StartTrigger)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := newTrigger(msg.StopTrigger)
+	if err != nil {
+		return nil, err
+	}
+
+	// recordings are annotated like the data
+	obf := NewObfRecorder(s.device.Repo())
+	obf.RecordCounts(msg.Counts)
+	if s.artifacts {
+		obf.Annotate(NewAnnotator(DefaultDetectorConfig()))
+	}
+
+	recorder := NewDeviceRecorder(s.device, obf)
+	recorder.SetPre(time.Duration(msg.PreMs) * time.Millisecond)
+	if len(msg.Channels) > 0 {
+		recorder.SetProcessor(NewChannelSelector(msg.Channels...))
+	}
+	recorder.Arm(start, stop, time.Duration(msg.PostMs)*time.Millisecond)
+
+	// if this is a fixed-time session, calculate
+	// how many data points we need
+	if msg.Milliseconds > 0 {
+		points := msg.Milliseconds * s.device.Info().SampleRate / 1000
+		log.Printf("FIXED TIME RECORDING: %d milliseconds, %d points", msg.Milliseconds, points)
+		recorder.SetMax(points)
+	}
+
+	// kick off the recording, always going to
+	// the local directory
+	if err := recorder.RecordAsync(); err != nil {
+		return nil, err
+	}
+	s.recordingsLock.Lock()
+	s.recordings[recorder.Id()] = recorder
+	s.recordingsLock.Unlock()
+
+	// a recording that stops by itself, like a fixed-time
+	// one, reports when it does
+	if recorder.RecordingFinite() {
+		go func() {
+			ar := new(RecordResponse)
+			ar.MessageType = "record"
+			ar.Id = msg.Id
+			ar.Success = false
+			ar.PairingId = s.pairingId
+			ar.RecordingId = recorder.Id()
+
+			info, err := recorder.Wait()
+			recorder.Release()
+			s.endRecording(recorder)
+			if err != nil {
+				log.Printf("error during recording: %v", err)
+				ar.Err = err.Error()
+			} else {
+				ar.Success = true
+				ar.ResourceId = info.ResourceId
+				ar.Milliseconds = int(info.DurationMs)
 			}
+			Send(s.conn, ar)
+		}()
+	}
+	return recorder, nil
+}
+
+// Create the Trigger of the spec, or nil if there is no spec.
+func newTrigger(spec *TriggerSpec) (Trigger, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	switch spec.Kind {
+	case "threshold":
+		if spec.Channel < 0 {
+			return nil, fmt.Errorf("bad channel: %d", spec.Channel)
+		}
+		return NewThresholdTrigger(spec.Channel, spec.Level, spec.Falling), nil
+	case "edge":
+		if spec.Source == "" {
+			return nil, fmt.Errorf("an edge trigger needs a source")
+		}
+		return NewEdgeTrigger(spec.Source), nil
+	case "marker":
+		if spec.Label == "" {
+			return nil, fmt.Errorf("a marker trigger needs a label")
+		}
+		return NewMarkerTrigger(spec.Label), nil
+	}
+	return nil, fmt.Errorf("unknown trigger: %s", spec.Kind)
+}
+
+// The recording in progress of the given id, which may
+// be left out when there is only one.
+func (s *SocketSession) recording(id string) (*DeviceRecorder, error) {
+	s.recordingsLock.Lock()
+	defer s.recordingsLock.Unlock()
+	if id != "" {
+		if recorder, ok := s.recordings[id]; ok {
+			return recorder, nil
+		}
+		return nil, fmt.Errorf("no recording %s", id)
+	}
+	switch len(s.recordings) {
+	case 0:
+		return nil, fmt.Errorf("not recording")
+	case 1:
+		for _, recorder := range s.recordings {
+			return recorder, nil
 		}
-		return
 	}
+	return nil, fmt.Errorf("recording_id is required with %d recordings in progress", len(s.recordings))
+}
 
+// Forget a recording that is over.
+func (s *SocketSession) endRecording(recorder *DeviceRecorder) {
+	s.recordingsLock.Lock()
+	defer s.recordingsLock.Unlock()
+	delete(s.recordings, recorder.Id())
 }
 
 func (s *SocketSession) ProcessUploadMessage(msgBytes []byte, id string) {
@@ -432,6 +597,177 @@ func (s *SocketSession) ProcessRepositoryMessage(msgBytes []byte, id string) {
 	}
 }
 
+func (s *SocketSession) ProcessQualityMessage(msgBytes []byte, id string) {
+	var msg QualityMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		SendError(s.conn, id, err.Error())
+		return
+	}
+
+	r := new(QualityResponse)
+	r.MessageType = "quality"
+	r.Id = msg.Id
+	r.Success = false
+	defer Send(s.conn, r)
+
+	// stop any reports of this session already underway;
+	// their channel closes and the reporter exits
+	s.device.Unsubscribe(s.qualitySubscription())
+	if !msg.Enable {
+		r.Success = true
+		return
+	}
+
+	if !s.device.Engaged() {
+		r.Err = "device is not streaming"
+		return
+	}
+
+	if msg.IntervalMs == 0 {
+		msg.IntervalMs = DefaultQualityIntervalMs
+	}
+	if msg.IntervalMs < MinQualityIntervalMs {
+		r.Err = fmt.Sprintf("interval_ms should be at least %d", MinQualityIntervalMs)
+		return
+	}
+
+	m := NewMonitor()
+	m.Interval = time.Duration(msg.IntervalMs) * time.Millisecond
+	reports, err := m.Subscribe(s.device, s.qualitySubscription())
+	if err != nil {
+		r.Err = err.Error()
+		return
+	}
+	r.Success = true
+
+	go func() {
+		for report := range reports {
+			Send(s.conn, &QualityResponse{
+				Id:          msg.Id,
+				MessageType: "quality",
+				Success:     true,
+				Timestamp:   report.Timestamp,
+				Channels:    report.Channels,
+			})
+		}
+	}()
+}
+
+// The sample rate at which the device will stream, or 0 if
+// it cannot be known until the device is engaged.
+func (s *SocketSession) sampleRate() int {
+	if caps := s.device.Capabilities(); caps != nil {
+		return caps.SampleRate(s.device.Config())
+	}
+	if info := s.device.Info(); info != nil {
+		return info.SampleRate
+	}
+	return 0
+}
+
+// Check the points per second that a client asks for against
+// the sample rate of the device, if it is known (nonzero). The
+// device cannot give more points than it samples, and its raw
+// counts are only sent when they need no resampling.
+func checkPps(pps int, ints bool, rate int) error {
+	max := MaxPps
+	if rate > 0 {
+		max = rate
+	}
+	if pps < 1 || pps > max {
+		return fmt.Errorf("pps should be between 1 and %d", max)
+	}
+	if ints && rate > 0 && pps != rate {
+		return fmt.Errorf("ints are only sent when pps is the sample rate, %d", rate)
+	}
+	return nil
+}
+
+// The name of the subscription of the quality reports of
+// this session, which are independent of those of others.
+func (s *SocketSession) qualitySubscription() string {
+	return QualitySubscription + "-" + s.pairingId
+}
+
+func (s *SocketSession) ProcessConfigureMessage(msgBytes []byte, id string) {
+	var msg ConfigureMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		SendError(s.conn, id, err.Error())
+		return
+	}
+
+	r := new(ConfigureResponse)
+	r.MessageType = "configure"
+	r.Id = msg.Id
+	r.Success = false
+	r.Capabilities = s.device.Capabilities()
+	defer func() {
+		r.Config = s.device.Config()
+		Send(s.conn, r)
+	}()
+
+	if !msg.Configure {
+		r.Success = true
+		return
+	}
+
+	if s.device.Engaged() {
+		r.Err = "device is connected; disconnect it first"
+		return
+	}
+
+	err := s.device.Configure(DeviceConfig{
+		SampleRate: msg.SampleRate,
+		Channels:   msg.Channels,
+		Trigger:    msg.Trigger,
+	})
+	if err != nil {
+		r.Err = err.Error()
+		return
+	}
+	r.Success = true
+}
+
+func (s *SocketSession) ProcessMarkerMessage(msgBytes []byte, id string) {
+	var msg MarkerMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		SendError(s.conn, id, err.Error())
+		return
+	}
+
+	r := new(MarkerResponse)
+	r.MessageType = "marker"
+	r.Id = msg.Id
+	r.Success = false
+	defer Send(s.conn, r)
+
+	if !s.device.Engaged() {
+		r.Err = "device is not streaming"
+		return
+	}
+	if msg.Label == "" {
+		r.Err = "a marker needs a label"
+		return
+	}
+	s.device.Mark(msg.Label)
+	r.Success = true
+}
+
+// Push the changes of state of the device to the control
+// client until the subscription closes.
+func (s *SocketSession) pushState(changes <-chan *StateChange) {
+	for sc := range changes {
+		Send(s.conn, &StateResponse{
+			MessageType: "state",
+			Success:     true,
+			From:        sc.From.String(),
+			To:          sc.To.String(),
+			Reason:      sc.Reason,
+			Timestamp:   sc.Timestamp,
+		})
+	}
+}
+
 func sendFile(conn *websocket.Conn, path, correlationId string) error {
 	id, err := strconv.ParseInt(correlationId, 10, 32)
 	if err != nil {
@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/device"
+	. "github.com/jbrukh/goavatar/obf"
+	"log"
+	"math"
+	"time"
+)
+
+// ----------------------------------------------------------------- //
+// Offline Analysis
+// ----------------------------------------------------------------- //
+
+// WelchObf estimates the power spectral density of an entire
+// OBF file. The channel descriptions are taken from the file,
+// if it has them, and no segment spans a gap in the recording.
+func WelchObf(r ObfReader, cfg WelchConfig) (*Spectrum, error) {
+	b, err := r.Parallel()
+	if err != nil {
+		return nil, err
+	}
+	if b.Samples() < 1 {
+		return nil, fmt.Errorf("the file has no samples")
+	}
+
+	exts, err := r.Extensions()
+	if err != nil {
+		return nil, err
+	}
+	events, err := EventsExtension(exts)
+	if err != nil {
+		return nil, err
+	}
+	runs := SplitAtGaps(b, events)
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("the file has no samples outside of gaps")
+	}
+
+	s := WelchRuns(runs, int(r.Header().SampleRate), cfg)
+	if s.Channels, err = ChannelInfosExtension(exts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ----------------------------------------------------------------- //
+// Online Analysis
+// ----------------------------------------------------------------- //
+
+// Analyzer periodically estimates the power spectral density
+// of the most recent data from a device.
+type Analyzer struct {
+	Length   time.Duration // amount of data in each estimate
+	Interval time.Duration // time between estimates
+	Segment  time.Duration // length of the Welch segments
+	Overlap  float64       // overlap of the Welch segments
+	Window   Window        // window applied to the Welch segments
+}
+
+// Create an Analyzer that estimates the spectrum of the
+// last four seconds of data every second.
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		Length:   4 * time.Second,
+		Interval: time.Second,
+		Segment:  2 * time.Second,
+		Overlap:  0.5,
+		Window:   Hann,
+	}
+}
+
+// Subscribe to the device under the given name and produce
+// a Spectrum every Interval, once Length of data has arrived.
+// The output channel closes when the subscription closes.
+func (a *Analyzer) Subscribe(d Device, name string) (chan *Spectrum, error) {
+	if a.Interval <= 0 || a.Length < a.Segment || a.Segment <= 0 {
+		return nil, fmt.Errorf("bad analyzer: length (%v); interval (%v); segment (%v)",
+			a.Length, a.Interval, a.Segment)
+	}
+	in, err := d.Subscribe(name)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *Spectrum, DataFrameBufferSize)
+	go func() {
+		defer close(out)
+		a.run(in, out)
+		log.Printf("spectral subscription '%s' closed", name)
+	}()
+	return out, nil
+}
+
+func (a *Analyzer) run(in <-chan DataFrame, out chan<- *Spectrum) {
+	var (
+		b        *RingBuffer
+		cfg      WelchConfig
+		rate     int
+		interval int // samples between estimates
+		pending  int // samples since the last estimate
+	)
+	for df := range in {
+		if b == nil {
+			rate = df.SampleRate()
+			cfg = WelchConfig{
+				Segment: samplesIn(a.Segment, rate),
+				Overlap: a.Overlap,
+				Window:  a.Window,
+			}
+			interval = samplesIn(a.Interval, rate)
+			b = NewRingBuffer(df.Buffer().Channels(), samplesIn(a.Length, rate), OverwriteOldest)
+		}
+		b.Append(df.Buffer())
+		pending += df.Buffer().Samples()
+
+		if !b.Full() || pending < interval {
+			continue
+		}
+		pending = 0
+
+		// no segment spans the samples that stand in for a
+		// gap, and there is no estimate until one fits
+		runs := splitAtNaN(b.Slice(0, b.Samples()))
+		if longest(runs) < cfg.Segment {
+			continue
+		}
+		s := WelchRuns(runs, rate, cfg)
+		s.Channels = df.ChannelInfos()
+		out <- s
+	}
+}
+
+// Cut the buffer into the runs of samples without a NaN,
+// which stand in for missing samples (see GapNaN).
+func splitAtNaN(b *BlockBuffer) (runs []*BlockBuffer) {
+	from := 0
+	for s := 0; s <= b.Samples(); s++ {
+		if s < b.Samples() {
+			if v, _ := b.Sample(s); !hasNaN(v) {
+				continue
+			}
+		}
+		if s > from {
+			runs = append(runs, b.Slice(from, s))
+		}
+		from = s + 1
+	}
+	return
+}
+
+// The number of samples in the longest of the runs.
+func longest(runs []*BlockBuffer) (n int) {
+	for _, b := range runs {
+		if b.Samples() > n {
+			n = b.Samples()
+		}
+	}
+	return
+}
+
+func hasNaN(v []float64) bool {
+	for _, x := range v {
+		if math.IsNaN(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// The number of samples in the duration at the sample
+// rate, at least 1.
+func samplesIn(d time.Duration, sampleRate int) int {
+	n := int(d * time.Duration(sampleRate) / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
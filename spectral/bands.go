@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+// ----------------------------------------------------------------- //
+// EEG Bands
+// ----------------------------------------------------------------- //
+
+// Band is a range of frequencies, [Low, High) in Hz.
+type Band struct {
+	Name string  `json:"name"`
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// The classic EEG bands. Gamma stops short of the
+// mains frequencies.
+var (
+	Delta = Band{"delta", 0.5, 4}
+	Theta = Band{"theta", 4, 8}
+	Alpha = Band{"alpha", 8, 13}
+	Beta  = Band{"beta", 13, 30}
+	Gamma = Band{"gamma", 30, 45}
+
+	ClassicBands = []Band{Delta, Theta, Alpha, Beta, Gamma}
+)
+
+// BandPower integrates a power spectral density (see Welch)
+// over the bins whose frequencies fall within the band,
+// giving the power of channel c in the band, in units^2.
+func (s *Spectrum) BandPower(c int, band Band) (p float64) {
+	for k, v := range s.Values[c] {
+		f := float64(k) * s.Resolution
+		if f >= band.Low && f < band.High {
+			p += v
+		}
+	}
+	return p * s.Resolution
+}
+
+// BandPowers computes the power of every channel in every
+// band, indexed by channel then by band.
+func (s *Spectrum) BandPowers(bands []Band) [][]float64 {
+	powers := make([][]float64, len(s.Values))
+	for c := range powers {
+		powers[c] = make([]float64, len(bands))
+		for i, band := range bands {
+			powers[c][i] = s.BandPower(c, band)
+		}
+	}
+	return powers
+}
+
+// RelativeBandPowers is like BandPowers, but each power is
+// given as a fraction of the total power in all the bands.
+func (s *Spectrum) RelativeBandPowers(bands []Band) [][]float64 {
+	powers := s.BandPowers(bands)
+	for _, p := range powers {
+		var total float64
+		for _, x := range p {
+			total += x
+		}
+		if total == 0 {
+			continue
+		}
+		for i := range p {
+			p[i] /= total
+		}
+	}
+	return powers
+}
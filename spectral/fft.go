@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// ----------------------------------------------------------------- //
+// FFT
+// ----------------------------------------------------------------- //
+
+// FFT computes the discrete Fourier transform of x in place
+// with the iterative radix-2 algorithm. The length of x must
+// be a power of 2; see NextPow2.
+func FFT(x []complex128) {
+	n := len(x)
+	if n == 0 || n&(n-1) != 0 {
+		panic(fmt.Sprintf("length must be a power of 2: %d", n))
+	}
+
+	// bit-reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	// butterflies
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], wk*x[start+k+size/2]
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wk *= w
+			}
+		}
+	}
+}
+
+// NextPow2 returns the smallest power of 2 that
+// is at least n.
+func NextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// Transform the real values v, multiplied by the window
+// coefficients w and zero-padded to nfft, into buf and
+// return it.
+func transform(buf []complex128, v, w []float64, nfft int) []complex128 {
+	if cap(buf) < nfft {
+		buf = make([]complex128, nfft)
+	}
+	buf = buf[:nfft]
+	for i := range buf {
+		buf[i] = 0
+	}
+	for i, x := range v {
+		buf[i] = complex(x*w[i], 0)
+	}
+	FFT(buf)
+	return buf
+}
@@ -0,0 +1,306 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+import (
+	"bytes"
+	. "github.com/jbrukh/goavatar/datastruct"
+	. "github.com/jbrukh/goavatar/obf"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+const testRate = 256
+
+// A buffer of samples on every channel, each the sum of
+// sines given as frequency, amplitude pairs.
+func sineBuffer(channels, samples int, sines ...float64) *BlockBuffer {
+	b := NewBlockBuffer(channels, samples)
+	v := make([]float64, channels)
+	for s := 0; s < samples; s++ {
+		t := float64(s) / testRate
+		x := 0.0
+		for i := 0; i+1 < len(sines); i += 2 {
+			x += sines[i+1] * math.Sin(2*math.Pi*sines[i]*t)
+		}
+		for c := range v {
+			v[c] = x
+		}
+		b.AppendSample(v, int64(s)*1000000000/testRate)
+	}
+	return b
+}
+
+func near(x, y, tolerance float64) bool {
+	return math.Abs(x-y) <= tolerance
+}
+
+func TestFFT(t *testing.T) {
+	var (
+		x = []float64{1, -2, 3, 0.5, 0, 7, -1, 2}
+		n = len(x)
+		y = make([]complex128, n)
+	)
+	for i, v := range x {
+		y[i] = complex(v, 0)
+	}
+	FFT(y)
+
+	// compare to the naive transform
+	for k := 0; k < n; k++ {
+		var expected complex128
+		for i, v := range x {
+			expected += complex(v, 0) * cmplx.Exp(complex(0, -2*math.Pi*float64(k*i)/float64(n)))
+		}
+		if cmplx.Abs(y[k]-expected) > 1e-9 {
+			t.Errorf("wrong bin %d: %v, expected %v", k, y[k], expected)
+		}
+	}
+
+	AssertPanic(t, func() {
+		FFT(make([]complex128, 6))
+	})
+}
+
+func TestNextPow2(t *testing.T) {
+	for n, expected := range map[int]int{1: 1, 2: 2, 3: 4, 250: 256, 256: 256, 500: 512} {
+		if p := NextPow2(n); p != expected {
+			t.Errorf("wrong power for %d: %d", n, p)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	for _, w := range []Window{Hann, Hamming, Blackman} {
+		coef := w.Coefficients(65)
+		if !near(coef[32], 1, 1e-9) || coef[0] > 0.1 || coef[0] != coef[64] {
+			t.Errorf("bad %v window: %v %v", w, coef[0], coef[32])
+		}
+	}
+	if coef := Rectangular.Coefficients(4); coef[0] != 1 || coef[3] != 1 {
+		t.Errorf("bad rectangular window")
+	}
+}
+
+func TestMagnitude(t *testing.T) {
+	s := Magnitude(sineBuffer(2, 256, 10, 2, 40, 0.5), testRate, Rectangular)
+	if s.Bins() != 129 || s.Resolution != 1 {
+		t.Fatalf("wrong dimensions: %d, %v", s.Bins(), s.Resolution)
+	}
+	if v := s.Values[1][s.Bin(10)]; !near(v, 2, 1e-6) {
+		t.Errorf("wrong amplitude at 10 Hz: %v", v)
+	}
+	if v := s.Values[1][s.Bin(40)]; !near(v, 0.5, 1e-6) {
+		t.Errorf("wrong amplitude at 40 Hz: %v", v)
+	}
+	if v := s.Values[1][s.Bin(25)]; v > 1e-6 {
+		t.Errorf("leakage at 25 Hz: %v", v)
+	}
+}
+
+func TestWelch__BandPowers(t *testing.T) {
+	var (
+		b   = sineBuffer(1, 8*testRate, 10, 1, 20, 0.5)
+		cfg = DefaultWelchConfig(testRate)
+		s   = Welch(b, testRate, cfg)
+	)
+	if s.Resolution != 0.5 {
+		t.Errorf("wrong resolution: %v", s.Resolution)
+	}
+
+	// a sinusoid of amplitude A has power A^2/2
+	p := s.BandPowers(ClassicBands)[0]
+	if !near(p[2], 0.5, 0.01) || !near(p[3], 0.125, 0.01) {
+		t.Errorf("wrong band powers: %v", p)
+	}
+	if p[0] > 0.001 || p[1] > 0.001 || p[4] > 0.001 {
+		t.Errorf("power outside the bands: %v", p)
+	}
+
+	r := s.RelativeBandPowers(ClassicBands)[0]
+	if !near(r[2], 0.8, 0.01) {
+		t.Errorf("wrong relative power: %v", r)
+	}
+}
+
+func TestWelch__Overlap(t *testing.T) {
+	b := sineBuffer(1, 4*testRate, 10, 1)
+	for _, overlap := range []float64{0, 0.5, 0.9} {
+		cfg := WelchConfig{Segment: testRate, Overlap: overlap, Window: Hamming}
+		if p := Welch(b, testRate, cfg).BandPower(0, Alpha); !near(p, 0.5, 0.01) {
+			t.Errorf("wrong power with overlap %v: %v", overlap, p)
+		}
+	}
+	AssertPanic(t, func() {
+		Welch(b, testRate, WelchConfig{Segment: testRate, Overlap: 1})
+	})
+}
+
+func TestWelchObf(t *testing.T) {
+	var (
+		b = sineBuffer(2, 4*testRate, 10, 1)
+		h = &ObfHeader{
+			DataType:      DataTypeRaw,
+			FormatVersion: FormatVersion2_2,
+			StorageMode:   StorageModeCombined,
+			Channels:      2,
+			Samples:       uint32(b.Samples()),
+			SampleRate:    testRate,
+			Extensions:    1,
+		}
+		buf bytes.Buffer
+	)
+	e, _ := NewJsonExtension(ExtChannels, EEGChannelInfos(2, "V", 1))
+	WriteHeader(&buf, h)
+	WriteParallel(&buf, b, ToTs32)
+	WriteSequential(&buf, b, ToTs32)
+	WriteExtensions(&buf, []*ObfExtension{e})
+
+	r, err := NewObfReader(&buf)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	s, err := WelchObf(r, DefaultWelchConfig(testRate))
+	if err != nil {
+		t.Fatalf("could not analyze: %v", err)
+	}
+	if len(s.Channels) != 2 || s.Channels[1].Label != "Ch2" {
+		t.Errorf("channels not read")
+	}
+	if p := s.BandPower(1, Alpha); !near(p, 0.5, 0.01) {
+		t.Errorf("wrong power: %v", p)
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	var (
+		a   = NewAnalyzer()
+		in  = make(chan DataFrame)
+		out = make(chan *Spectrum, 100)
+		b   = sineBuffer(1, 10*testRate, 10, 1)
+	)
+	go func() {
+		for from := 0; from < b.Samples(); from += 64 {
+			in <- NewDataFrameWithChannels(b.Slice(from, from+64), testRate, EEGChannelInfos(1, "V", 1))
+		}
+		close(in)
+	}()
+	a.run(in, out)
+	close(out)
+
+	// one after four seconds, then one every second
+	if len(out) != 7 {
+		t.Errorf("wrong number of estimates: %d", len(out))
+	}
+	for s := range out {
+		if p := s.BandPower(0, Alpha); !near(p, 0.5, 0.01) || len(s.Channels) != 1 {
+			t.Errorf("wrong estimate: %v", p)
+		}
+	}
+}
+
+func TestAnalyzer__Gaps(t *testing.T) {
+	var (
+		a   = NewAnalyzer()
+		in  = make(chan DataFrame)
+		out = make(chan *Spectrum, 100)
+		b   = sineBuffer(1, 10*testRate, 10, 1)
+	)
+	// a gap of 3 samples, filled with NaN, in the middle
+	for s := 5 * testRate; s < 5*testRate+3; s++ {
+		v, _ := b.Sample(s)
+		v[0] = math.NaN()
+	}
+	go func() {
+		for from := 0; from < b.Samples(); from += 64 {
+			in <- NewDataFrame(b.Slice(from, from+64), testRate)
+		}
+		close(in)
+	}()
+	a.run(in, out)
+	close(out)
+
+	if len(out) == 0 {
+		t.Fatalf("no estimates")
+	}
+	for s := range out {
+		if p := s.BandPower(0, Alpha); !near(p, 0.5, 0.01) {
+			t.Errorf("should not analyze the gap: %v", p)
+		}
+	}
+}
+
+func AssertPanic(t *testing.T, f func()) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("should have panicked")
+		}
+	}()
+	f()
+}
+
+func TestWelchRuns(t *testing.T) {
+	var (
+		b    = sineBuffer(1, 4*testRate, 10, 1)
+		cfg  = DefaultWelchConfig(testRate)
+		runs = []*BlockBuffer{b.Slice(0, 3*testRate), b.Slice(3*testRate, 4*testRate)}
+	)
+
+	// the short run has no whole segment
+	s := WelchRuns(runs, testRate, cfg)
+	if p := s.BandPower(0, Alpha); !near(p, 0.5, 0.01) {
+		t.Errorf("wrong power: %v", p)
+	}
+
+	// nothing spans a segment
+	runs = []*BlockBuffer{b.Slice(0, testRate/2), b.Slice(testRate, 2*testRate)}
+	if s = WelchRuns(runs, testRate, cfg); s.Timestamp != 2*1000000000-1000000000/testRate {
+		t.Errorf("wrong timestamp: %v", s.Timestamp)
+	}
+}
+
+func TestWelchObf__Gaps(t *testing.T) {
+	var (
+		b   = sineBuffer(1, 6*testRate, 10, 1)
+		buf bytes.Buffer
+	)
+	// a gap of 3 samples, in milliseconds like the recorder
+	const at = 3 * testRate
+	var (
+		ts  = b.Timestamps()
+		gap = NewGapEvent(ts[at-1], 3, 1000000000/testRate, "test", "dropped")
+	)
+	gap.Timestamp = ToTs64(ToTs32(gap.Timestamp))
+	for s := at; s < at+3; s++ {
+		v, _ := b.Sample(s)
+		v[0] = math.NaN()
+	}
+
+	h := &ObfHeader{
+		DataType:      DataTypeRaw,
+		FormatVersion: FormatVersion2_2,
+		StorageMode:   StorageModeParallel,
+		Channels:      1,
+		Samples:       uint32(b.Samples()),
+		SampleRate:    testRate,
+		Extensions:    1,
+	}
+	e, _ := NewJsonExtension(ExtEvents, []*Event{gap})
+	WriteHeader(&buf, h)
+	WriteParallel(&buf, b, ToTs32)
+	WriteExtensions(&buf, []*ObfExtension{e})
+
+	r, err := NewObfReader(&buf)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	s, err := WelchObf(r, DefaultWelchConfig(testRate))
+	if err != nil {
+		t.Fatalf("could not analyze: %v", err)
+	}
+	if p := s.BandPower(0, Alpha); !near(p, 0.5, 0.01) {
+		t.Errorf("should not analyze the gap: %v", p)
+	}
+}
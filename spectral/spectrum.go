@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+import (
+	"fmt"
+	. "github.com/jbrukh/goavatar/datastruct"
+	"math"
+	"math/cmplx"
+)
+
+// ----------------------------------------------------------------- //
+// Spectrum
+// ----------------------------------------------------------------- //
+
+// Spectrum holds per-channel values at evenly spaced
+// frequencies, from 0 Hz up to the Nyquist frequency.
+type Spectrum struct {
+	SampleRate int            // sample rate of the data, in Hz
+	Resolution float64        // width of a frequency bin, in Hz
+	Timestamp  int64          // timestamp of the last sample analyzed
+	Channels   []*ChannelInfo // channel descriptions, if known
+	Values     [][]float64    // values, by channel then by bin
+}
+
+// Create an empty Spectrum for the given transform size.
+func newSpectrum(channels, sampleRate, nfft int) *Spectrum {
+	s := &Spectrum{
+		SampleRate: sampleRate,
+		Resolution: float64(sampleRate) / float64(nfft),
+		Values:     make([][]float64, channels),
+	}
+	for c := range s.Values {
+		s.Values[c] = make([]float64, nfft/2+1)
+	}
+	return s
+}
+
+// The number of frequency bins.
+func (s *Spectrum) Bins() int {
+	if len(s.Values) == 0 {
+		return 0
+	}
+	return len(s.Values[0])
+}
+
+// The center frequency of each bin, in Hz.
+func (s *Spectrum) Frequencies() []float64 {
+	f := make([]float64, s.Bins())
+	for k := range f {
+		f[k] = float64(k) * s.Resolution
+	}
+	return f
+}
+
+// The bin closest to the given frequency.
+func (s *Spectrum) Bin(freq float64) int {
+	k := int(math.Floor(freq/s.Resolution + 0.5))
+	if k < 0 {
+		return 0
+	}
+	if k >= s.Bins() {
+		return s.Bins() - 1
+	}
+	return k
+}
+
+// Magnitude computes the amplitude spectrum of every channel
+// of the buffer, multiplied by the window and zero-padded to
+// a power of 2. The values are scaled so that a sinusoid of
+// amplitude A at a bin frequency has the value A.
+func Magnitude(b *BlockBuffer, sampleRate int, w Window) *Spectrum {
+	samples := b.Samples()
+	if samples < 1 {
+		panic("cannot analyze an empty buffer")
+	}
+	var (
+		nfft      = NextPow2(samples)
+		s         = newSpectrum(b.Channels(), sampleRate, nfft)
+		coef      = w.Coefficients(samples)
+		values, _ = b.Arrays()
+		buf       []complex128
+		sum       float64
+	)
+	for _, x := range coef {
+		sum += x
+	}
+	for c, v := range values {
+		buf = transform(buf, v, coef, nfft)
+		for k := range s.Values[c] {
+			a := cmplx.Abs(buf[k]) / sum
+			if k != 0 && k != nfft/2 {
+				a *= 2
+			}
+			s.Values[c][k] = a
+		}
+	}
+	if ts := b.Timestamps(); len(ts) > 0 {
+		s.Timestamp = ts[len(ts)-1]
+	}
+	return s
+}
+
+// ----------------------------------------------------------------- //
+// Welch PSD
+// ----------------------------------------------------------------- //
+
+// WelchConfig describes how the data is cut into segments
+// for Welch's method.
+type WelchConfig struct {
+	Segment int     // samples per segment; the resolution is sampleRate/NextPow2(Segment)
+	Overlap float64 // fraction of each segment shared with the next, in [0, 1)
+	Window  Window  // window applied to every segment
+}
+
+// The default configuration: Hann-windowed segments of
+// about two seconds, overlapping by half.
+func DefaultWelchConfig(sampleRate int) WelchConfig {
+	return WelchConfig{
+		Segment: 2 * sampleRate,
+		Overlap: 0.5,
+		Window:  Hann,
+	}
+}
+
+func (cfg WelchConfig) validate() {
+	if cfg.Segment < 1 || cfg.Overlap < 0 || cfg.Overlap >= 1 {
+		panic(fmt.Sprintf("bad welch configuration: segment (%d); overlap (%v)", cfg.Segment, cfg.Overlap))
+	}
+}
+
+// The number of samples between the starts of segments.
+func (cfg WelchConfig) hop() int {
+	hop := cfg.Segment - int(cfg.Overlap*float64(cfg.Segment))
+	if hop < 1 {
+		hop = 1
+	}
+	return hop
+}
+
+// Welch estimates the one-sided power spectral density of
+// every channel of the buffer, in units^2/Hz, by averaging
+// the periodograms of overlapping, windowed segments. The
+// mean of each segment is removed before it is transformed.
+// A buffer shorter than one segment is analyzed whole.
+func Welch(b *BlockBuffer, sampleRate int, cfg WelchConfig) *Spectrum {
+	return WelchRuns([]*BlockBuffer{b}, sampleRate, cfg)
+}
+
+// WelchRuns is like Welch for data that is broken into
+// separate runs, like the runs between gaps in a recording
+// (see SplitAtGaps). No segment spans two runs. If every run
+// is shorter than a segment, the longest run is analyzed
+// whole.
+func WelchRuns(runs []*BlockBuffer, sampleRate int, cfg WelchConfig) *Spectrum {
+	cfg.validate()
+	var longest *BlockBuffer
+	for _, b := range runs {
+		if longest == nil || b.Samples() > longest.Samples() {
+			longest = b
+		}
+	}
+	if longest == nil || longest.Samples() < 1 {
+		panic("cannot analyze an empty buffer")
+	}
+	seg := cfg.Segment
+	if seg > longest.Samples() {
+		seg = longest.Samples()
+	}
+	var (
+		nfft    = NextPow2(cfg.Segment)
+		s       = newSpectrum(longest.Channels(), sampleRate, nfft)
+		coef    = cfg.Window.Coefficients(seg)
+		hop     = cfg.hop()
+		segment = make([]float64, seg)
+		buf     []complex128
+		power   float64
+		count   int
+	)
+	for _, x := range coef {
+		power += x * x
+	}
+	scale := 1 / (float64(sampleRate) * power)
+
+	for _, b := range runs {
+		values, ts := b.Arrays()
+		for from := 0; from+seg <= len(ts); from += hop {
+			for c, v := range values {
+				detrend(segment, v[from:from+seg])
+				buf = transform(buf, segment, coef, nfft)
+				for k := range s.Values[c] {
+					p := real(buf[k])*real(buf[k]) + imag(buf[k])*imag(buf[k])
+					p *= scale
+					if k != 0 && k != nfft/2 {
+						p *= 2
+					}
+					s.Values[c][k] += p
+				}
+			}
+			count++
+		}
+		if len(ts) > 0 && ts[len(ts)-1] > s.Timestamp {
+			s.Timestamp = ts[len(ts)-1]
+		}
+	}
+	for _, v := range s.Values {
+		for k := range v {
+			v[k] /= float64(count)
+		}
+	}
+	return s
+}
+
+// Copy v into dst with its mean removed.
+func detrend(dst, v []float64) {
+	var mean float64
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	for i, x := range v {
+		dst[i] = x - mean
+	}
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2013 Jake Brukhman/Octopus. All rights reserved.
+//
+package spectral
+
+import (
+	"fmt"
+	"math"
+)
+
+// ----------------------------------------------------------------- //
+// Windows
+// ----------------------------------------------------------------- //
+
+// Window is a tapering function that is applied to a
+// segment of data before it is transformed, in order to
+// reduce spectral leakage.
+type Window int
+
+const (
+	Rectangular Window = iota // no tapering, the best resolution
+	Hann                      // a good default
+	Hamming                   // lower first sidelobe than Hann
+	Blackman                  // the least leakage, the widest peaks
+)
+
+func (w Window) String() string {
+	switch w {
+	case Rectangular:
+		return "rectangular"
+	case Hann:
+		return "hann"
+	case Hamming:
+		return "hamming"
+	case Blackman:
+		return "blackman"
+	}
+	return fmt.Sprintf("Window(%d)", int(w))
+}
+
+// Coefficients returns the n coefficients of the window.
+func (w Window) Coefficients(n int) []float64 {
+	if n < 1 {
+		panic(fmt.Sprintf("bad window length: %d", n))
+	}
+	coef := make([]float64, n)
+	if n == 1 {
+		coef[0] = 1
+		return coef
+	}
+	for i := range coef {
+		x := 2 * math.Pi * float64(i) / float64(n-1)
+		switch w {
+		case Rectangular:
+			coef[i] = 1
+		case Hann:
+			coef[i] = 0.5 - 0.5*math.Cos(x)
+		case Hamming:
+			coef[i] = 0.54 - 0.46*math.Cos(x)
+		case Blackman:
+			coef[i] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		default:
+			panic(fmt.Sprintf("unknown window: %v", w))
+		}
+	}
+	return coef
+}
@@ -9,22 +9,6 @@ import (
 	"time"
 )
 
-// return the average of an array
-func AverageFloat64(arr []float64) float64 {
-	if len(arr) < 1 {
-		return float64(0)
-	}
-	return SumFloat64(arr) / float64(len(arr))
-}
-
-// return the sum of an array
-func SumFloat64(arr []float64) (result float64) {
-	for _, v := range arr {
-		result += v
-	}
-	return
-}
-
 func SumInt64(arr []int64) (result int64) {
 	for _, v := range arr {
 		result += v